@@ -3,15 +3,21 @@ package internal
 import (
 	"context"
 	"log/slog"
+	"time"
 
 	"github.com/go-redis/redis/v8"
+	redigo "github.com/gomodule/redigo/redis"
+
+	"github.com/spacesedan/go-sequence/internal/config"
 )
 
-func NewRedis(logger *slog.Logger) (*redis.Client, error) {
+func NewRedis(cfg config.Redis, logger *slog.Logger) (*redis.Client, error) {
 	var err error
 	rdb := redis.NewClient(&redis.Options{
-		Addr: "localhost:6379",
-
+		Addr:     cfg.Addr,
+		Username: cfg.Username,
+		Password: cfg.Password,
+		DB:       cfg.DB,
 	})
 
 	res := rdb.Ping(context.Background())
@@ -19,6 +25,7 @@ func NewRedis(logger *slog.Logger) (*redis.Client, error) {
 		err = res.Err()
 		logger.Error("internal.NewRedis",
 			slog.Group("failed to ping redis",
+				slog.String("addr", cfg.Addr),
 				slog.String("reason", err.Error())))
 
 		return nil, err
@@ -27,3 +34,31 @@ func NewRedis(logger *slog.Logger) (*redis.Client, error) {
 
 	return rdb, nil
 }
+
+// NewRedisPool creates the redigo pool used by the session store
+func NewRedisPool(cfg config.Redis, logger *slog.Logger) (*redigo.Pool, error) {
+	pool := &redigo.Pool{
+		MaxIdle:     10,
+		IdleTimeout: 240 * time.Second,
+		Dial: func() (redigo.Conn, error) {
+			return redigo.Dial("tcp", cfg.Addr,
+				redigo.DialUsername(cfg.Username),
+				redigo.DialPassword(cfg.Password),
+				redigo.DialDatabase(cfg.DB))
+		},
+	}
+
+	conn := pool.Get()
+	defer conn.Close()
+
+	if _, err := conn.Do("PING"); err != nil {
+		logger.Error("internal.NewRedisPool",
+			slog.Group("failed to ping redis",
+				slog.String("addr", cfg.Addr),
+				slog.String("reason", err.Error())))
+
+		return nil, err
+	}
+
+	return pool, nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/gob"
 	"errors"
+	"flag"
 	"log"
 	"log/slog"
 	"math/rand"
@@ -15,12 +16,19 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-redis/redis/v8"
+	redigo "github.com/gomodule/redigo/redis"
 
 	"github.com/spacesedan/go-sequence/cmd/internal"
 	"github.com/spacesedan/go-sequence/internal/client"
+	"github.com/spacesedan/go-sequence/internal/config"
+	"github.com/spacesedan/go-sequence/internal/db"
 	"github.com/spacesedan/go-sequence/internal/handlers"
 	"github.com/spacesedan/go-sequence/internal/lobby"
+	"github.com/spacesedan/go-sequence/internal/metrics"
+	"github.com/spacesedan/go-sequence/internal/pubsub"
+	"github.com/spacesedan/go-sequence/internal/ratelimit"
 	"github.com/spacesedan/go-sequence/internal/services"
+	"github.com/spacesedan/go-sequence/internal/tracing"
 )
 
 func init() {
@@ -32,7 +40,15 @@ func main() {
 	gob.Register(lobby.WsPayload{})
 	gob.Register(lobby.WsResponse{})
 
-	errC, err := run()
+	cfg, err := config.Load(os.Args[0], os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Error when loading config: %v", err)
+	}
+
+	errC, err := run(cfg)
 	if err != nil {
 		log.Fatalf("Error when starting server: %v", err)
 	}
@@ -44,19 +60,70 @@ func main() {
 }
 
 type ServerConfig struct {
-	address string
-	logger  *slog.Logger
-	redis   *redis.Client
+	config     config.Config
+	logger     *slog.Logger
+	redis      *redis.Client
+	repos      db.Repos
+	pubsub     pubsub.PubSub
+	chatPolicy lobby.ChatPolicy
+	invites    *lobby.InviteSigner
+	sessions   *handlers.Sessions
+	store      db.Store
 }
 
-func run() (<-chan error, error) {
+func run(cfg config.Config) (<-chan error, error) {
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.LevelDebug,
+		Level: cfg.LogLevel,
 	}))
 
-	rdb, err := internal.NewRedis(logger)
+	chatPolicy := lobby.DefaultChatPolicy
+	if cfg.BlockedWordsPath != "" {
+		words, err := lobby.LoadBlockedWords(cfg.BlockedWordsPath)
+		if err != nil {
+			return nil, services.WrapErrorf(err, services.ErrorCodeInvalidArgument, "lobby.LoadBlockedWords")
+		}
+		chatPolicy.BlockedWords = words
+	}
+
+	invites, err := lobby.NewInviteSigner([]byte(cfg.InviteSecret), cfg.InviteTTL)
 	if err != nil {
-		return nil, services.WrapErrorf(err, services.ErrorCodeUnknown, "internal.NewRedis")
+		return nil, services.WrapErrorf(err, services.ErrorCodeUnknown, "lobby.NewInviteSigner")
+	}
+
+	// the memory backend runs without redis, it can only be used by a
+	// single replica
+	var rdb *redis.Client
+	var pool *redigo.Pool
+	repos := db.NewMemoryRepos(logger)
+	ps := pubsub.NewMemory()
+	sessionStore := handlers.NewMemorySessionStore()
+
+	if cfg.Backend == db.BackendRedis {
+		rdb, err = internal.NewRedis(cfg.Redis, logger)
+		if err != nil {
+			return nil, services.WrapErrorf(err, services.ErrorCodeUnknown, "internal.NewRedis")
+		}
+		rdb.AddHook(metrics.RedisHook{})
+		rdb.AddHook(tracing.RedisHook{})
+
+		pool, err = internal.NewRedisPool(cfg.Redis, logger)
+		if err != nil {
+			return nil, services.WrapErrorf(err, services.ErrorCodeUnknown, "internal.NewRedisPool")
+		}
+
+		repos = db.NewRedisRepos(rdb, logger)
+		ps = pubsub.NewRedis(rdb)
+		sessionStore = handlers.NewRedisSessionStore(pool)
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := db.NewSQLiteStore(cfg.DBPath, logger)
+	if err != nil {
+		return nil, services.WrapErrorf(err, services.ErrorCodeUnknown, "db.NewSQLiteStore")
 	}
 
 	errC := make(chan error, 1)
@@ -67,20 +134,31 @@ func run() (<-chan error, error) {
 		syscall.SIGKILL)
 
 	serverConfig := ServerConfig{
-		address: ":42069",
-		logger:  logger,
-		redis:   rdb,
+		config:     cfg,
+		logger:     logger,
+		redis:      rdb,
+		repos:      repos,
+		pubsub:     ps,
+		chatPolicy: chatPolicy,
+		invites:    invites,
+		sessions:   handlers.NewSessions(sessionStore, cfg.SessionLifetime, cfg.SecureCookies()),
+		store:      store,
 	}
 
-	srv, _ := newServer(serverConfig)
+	srv, lm, _ := newServer(serverConfig)
 
 	go func() {
 		<-ctx.Done()
 
-		ctxTimeout, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		ctxTimeout, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 
 		defer func() {
-            rdb.Close()
+			if rdb != nil {
+				rdb.Close()
+				pool.Close()
+			}
+			store.Close()
+			shutdownTracing(ctxTimeout)
 
 			cancel()
 			stop()
@@ -89,7 +167,9 @@ func run() (<-chan error, error) {
 
 		srv.SetKeepAlivesEnabled(false)
 
-		if err := srv.Shutdown(ctxTimeout); err != nil {
+		err := srv.Shutdown(ctxTimeout)
+		// the lobbies save their state while redis is still there
+		if err := errors.Join(err, lm.Shutdown(ctxTimeout)); err != nil {
 			errC <- err
 		}
 
@@ -97,7 +177,7 @@ func run() (<-chan error, error) {
 	}()
 
 	go func() {
-		logger.Info("Listening and serving to:", slog.String("addr", serverConfig.address))
+		logger.Info("Listening and serving to:", slog.String("addr", cfg.Address), slog.String("base_url", cfg.BaseURL))
 
 		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			errC <- err
@@ -108,29 +188,59 @@ func run() (<-chan error, error) {
 
 }
 
-func newServer(sc ServerConfig) (*http.Server, error) {
+func newServer(sc ServerConfig) (*http.Server, *lobby.LobbyManager, error) {
 	r := chi.NewRouter()
+	r.Use(tracing.Middleware)
+	r.Use(sc.sessions.LoadAndSave)
 
 	// start services
-	lm := lobby.NewLobbyManager(sc.redis, sc.logger)
+	lm := lobby.NewLobbyManager(sc.repos, sc.pubsub, sc.logger, sc.chatPolicy, sc.invites, sc.store)
+	lm.ReconnectTTL = sc.config.ReconnectTTL
+	lm.MaxLobbies = sc.config.Limits.MaxLobbies
+	lm.IdlePolicy = lobby.IdlePolicy(sc.config.LobbyIdle)
+
+	// pick up the lobbies and games that were running before a restart
+	recovered, err := lm.Recover()
+	if err != nil {
+		sc.logger.Error("newServer", slog.Group("failed to recover lobbies", slog.String("reason", err.Error())))
+	}
+	sc.logger.Info("newServer", slog.String("replica_id", lm.ReplicaID), slog.Int("recovered_lobbies", recovered))
+
+	if sc.config.DevLobbies {
+		lm.NewDevLobbies()
+	}
 	go lm.Run()
 
+	limits := &handlers.Limits{
+		CreateLobby:    ratelimit.NewLimiter(sc.config.Limits.CreateLobby),
+		JoinLobby:      ratelimit.NewLimiter(sc.config.Limits.JoinLobby),
+		WsMessages:     ratelimit.NewLimiter(sc.config.Limits.WsMessages),
+		MaxMessageSize: sc.config.Limits.MaxMessageSize,
+		AllowedOrigins: sc.config.Limits.AllowedOrigins,
+		TrustProxy:     sc.config.Limits.TrustProxy,
+	}
+
 	// Register handlers
-	handlers.NewLobbyHandler(sc.redis, lm, sc.logger).Register(r)
-	handlers.NewViewHandler(sc.redis, lm).Register(r)
+	handlers.NewLobbyHandler(sc.repos.Client, sc.pubsub, lm, sc.sessions, sc.logger, limits, sc.config.URL).Register(r)
+	handlers.NewViewHandler(sc.redis, lm, sc.sessions, sc.store, sc.config.WebsocketURL).Register(r)
+	handlers.NewHealthHandler(sc.redis, lm).Register(r)
+	handlers.NewAdminHandler(lm, sc.config.AdminToken).Register(r)
+	handlers.NewAPIHandler(lm, sc.sessions, sc.logger, limits, sc.config.WebsocketURL).Register(r)
+
+	r.Handle("/metrics", metrics.Handler(metrics.NewRegistry(lm)))
 
 	// handler static files
-	fs := http.FileServer(http.Dir("assets"))
-	bundle := http.FileServer(http.Dir("dist"))
+	fs := http.FileServer(http.Dir(sc.config.AssetsDir))
+	bundle := http.FileServer(http.Dir(sc.config.BundleDir))
 	r.Handle("/static/*", http.StripPrefix("/static/", fs))
 	r.Handle("/bundle/*", http.StripPrefix("/bundle/", bundle))
 
 	return &http.Server{
 		Handler:           r,
-		Addr:              sc.address,
-		ReadTimeout:       1 * time.Second,
-		WriteTimeout:      1 * time.Second,
-		IdleTimeout:       1 * time.Second,
-		ReadHeaderTimeout: 1 * time.Second,
-	}, nil
+		Addr:              sc.config.Address,
+		ReadTimeout:       sc.config.ReadTimeout,
+		WriteTimeout:      sc.config.WriteTimeout,
+		IdleTimeout:       sc.config.IdleTimeout,
+		ReadHeaderTimeout: sc.config.ReadTimeout,
+	}, lm, nil
 }
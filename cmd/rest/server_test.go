@@ -0,0 +1,1462 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/spacesedan/go-sequence/internal"
+	"github.com/spacesedan/go-sequence/internal/config"
+	"github.com/spacesedan/go-sequence/internal/db"
+	"github.com/spacesedan/go-sequence/internal/game"
+	"github.com/spacesedan/go-sequence/internal/handlers"
+	"github.com/spacesedan/go-sequence/internal/lobby"
+	"github.com/spacesedan/go-sequence/internal/pubsub"
+	"github.com/spacesedan/go-sequence/internal/ratelimit"
+	"github.com/spacesedan/go-sequence/internal/services"
+	"github.com/spacesedan/go-sequence/internal/tracing"
+)
+
+// the server reads the board cells and assets relative to the repo root
+func TestMain(m *testing.M) {
+	if err := os.Chdir("../.."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// newTestServer starts the whole server on the in-memory backend, options
+// change the default config. Session cookies are secure so it is served over
+// tls.
+func newTestServer(t *testing.T, options ...func(*config.Config)) *httptest.Server {
+	t.Helper()
+
+	cfg := config.Default()
+	// simulated players play a whole game in milliseconds
+	cfg.Limits.WsMessages = ratelimit.Rule{}
+	for _, o := range options {
+		o(&cfg)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	store, err := db.NewSQLiteStore(filepath.Join(t.TempDir(), "sequence.db"), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invites, err := lobby.NewInviteSigner([]byte("test secret"), lobby.DefaultInviteTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv, lm, err := newServer(ServerConfig{
+		config:     cfg,
+		logger:     logger,
+		repos:      db.NewMemoryRepos(logger),
+		pubsub:     pubsub.NewMemory(),
+		chatPolicy: lobby.DefaultChatPolicy,
+		invites:    invites,
+		sessions:   handlers.NewSessions(handlers.NewMemorySessionStore(), time.Hour, true),
+		store:      store,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewTLSServer(srv.Handler)
+	t.Cleanup(func() {
+		ts.Close()
+		lm.Shutdown(context.Background())
+		store.Close()
+	})
+
+	return ts
+}
+
+// testEvent is an event sent over the sequence.v1+json subprotocol
+type testEvent struct {
+	Version string          `json:"version"`
+	Type    lobby.EventType `json:"type"`
+	Data    json.RawMessage `json:"data"`
+}
+
+func (e testEvent) decode(t *testing.T, v any) {
+	t.Helper()
+	if err := json.Unmarshal(e.Data, v); err != nil {
+		t.Fatalf("failed to decode %v event: %v", e.Type, err)
+	}
+}
+
+// testPlayer is a simulated player, it holds its own session and websocket
+type testPlayer struct {
+	t        *testing.T
+	ts       *httptest.Server
+	http     *http.Client
+	PlayerID string
+	Username string
+
+	ws       *websocket.Conn
+	messages chan []byte
+
+	// game state built from the events
+	color string
+	board map[game.CellPosition]lobby.CellData
+	hand  []game.Card
+	turn  string
+}
+
+// newAnonymousPlayer is a player with a session but no identity yet
+func newAnonymousPlayer(t *testing.T, ts *httptest.Server) *testPlayer {
+	t.Helper()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := *ts.Client()
+	client.Jar = jar
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	return &testPlayer{t: t, ts: ts, http: &client, messages: make(chan []byte, 256)}
+}
+
+func newTestPlayer(t *testing.T, ts *httptest.Server, name string) *testPlayer {
+	t.Helper()
+
+	p := newAnonymousPlayer(t, ts)
+
+	res := p.post("/lobby/display-name", url.Values{"display_name": {name}})
+	p.PlayerID = res.Header.Get("X-Player-Id")
+	p.Username = res.Header.Get("X-Username")
+	if p.PlayerID == "" || p.Username != name {
+		t.Fatalf("Expected an identity for %v, got %q %q", name, p.PlayerID, p.Username)
+	}
+
+	return p
+}
+
+func (p *testPlayer) post(path string, form url.Values) *http.Response {
+	p.t.Helper()
+
+	res, err := p.http.PostForm(p.ts.URL+path, form)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	res.Body.Close()
+
+	return res
+}
+
+// api calls the JSON api and decodes the response into v, v is left alone
+// for errors and empty responses
+func (p *testPlayer) api(method, path string, body, v any) (*http.Response, lobby.ErrorData) {
+	p.t.Helper()
+
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			p.t.Fatal(err)
+		}
+		r = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, p.ts.URL+handlers.APIPrefix+path, r)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := p.http.Do(req)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	var e handlers.ErrorResponse
+	switch {
+	case res.StatusCode >= http.StatusBadRequest:
+		err = json.NewDecoder(res.Body).Decode(&e)
+	case v != nil:
+		err = json.NewDecoder(res.Body).Decode(v)
+	}
+	if err != nil {
+		p.t.Fatalf("failed to decode %v %v: %v", method, path, err)
+	}
+
+	return res, e.Error
+}
+
+// createLobby creates a lobby and returns its id
+func (p *testPlayer) createLobby(numOfPlayers int) string {
+	p.t.Helper()
+
+	res := p.post("/lobby/create", url.Values{
+		"num_of_players": {strconv.Itoa(numOfPlayers)},
+		"max_hand_size":  {"7"},
+		"visibility":     {string(internal.VisibilityPublic)},
+	})
+
+	id := strings.TrimPrefix(res.Header.Get("HX-Redirect"), "/lobby/")
+	if len(id) != 4 {
+		p.t.Fatalf("Expected to be sent to the new lobby, got %q", res.Header.Get("HX-Redirect"))
+	}
+
+	return id
+}
+
+func (p *testPlayer) joinLobby(lobbyID string) {
+	p.t.Helper()
+
+	res := p.post("/lobby/join", url.Values{"lobby-id": {lobbyID}})
+	if res.Header.Get("HX-Redirect") != "/lobby/"+lobbyID {
+		p.t.Fatalf("Expected %v to join %v, got %q", p.Username, lobbyID, res.Header.Get("HX-Redirect"))
+	}
+}
+
+// connect opens the lobby websocket, protocol is empty for a browser
+func (p *testPlayer) connect(lobbyID, protocol string) {
+	p.t.Helper()
+
+	u, _ := url.Parse(p.ts.URL)
+
+	header := http.Header{}
+	for _, c := range p.http.Jar.Cookies(u) {
+		header.Add("Cookie", c.String())
+	}
+
+	dialer := websocket.Dialer{
+		TLSClientConfig: p.ts.Client().Transport.(*http.Transport).TLSClientConfig,
+	}
+	if protocol != "" {
+		dialer.Subprotocols = []string{protocol}
+	}
+
+	ws, _, err := dialer.Dial("wss://"+u.Host+"/lobby/ws?lobby-id="+lobbyID, header)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	p.ws = ws
+	p.t.Cleanup(func() { ws.Close() })
+
+	// players that reconnect read from a new connection
+	messages := make(chan []byte, 256)
+	p.messages = messages
+
+	go func() {
+		defer close(messages)
+		for {
+			_, msg, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			messages <- msg
+		}
+	}()
+}
+
+func (p *testPlayer) send(action lobby.PayloadEvent, message string) {
+	p.t.Helper()
+
+	if err := p.ws.WriteJSON(lobby.WsPayload{Action: action, Message: message}); err != nil {
+		p.t.Fatal(err)
+	}
+}
+
+// next returns the next message sent to the player
+func (p *testPlayer) next() []byte {
+	p.t.Helper()
+
+	select {
+	case msg, ok := <-p.messages:
+		if !ok {
+			p.t.Fatalf("%v was disconnected", p.Username)
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		p.t.Fatalf("%v is still waiting for a message", p.Username)
+		return nil
+	}
+}
+
+// read returns the next event sent to the player and updates its game state
+func (p *testPlayer) read() testEvent {
+	p.t.Helper()
+
+	var e testEvent
+	if err := json.Unmarshal(p.next(), &e); err != nil {
+		p.t.Fatal(err)
+	}
+	if e.Version != lobby.SchemaVersion {
+		p.t.Fatalf("Unexpected event version %q", e.Version)
+	}
+
+	p.apply(e)
+	return e
+}
+
+// expect reads the next events and fails unless they are of the given types in
+// that order
+func (p *testPlayer) expect(types ...lobby.EventType) []testEvent {
+	p.t.Helper()
+
+	events := make([]testEvent, 0, len(types))
+	for _, want := range types {
+		e := p.read()
+		if e.Type != want {
+			p.t.Fatalf("%v expected a %v event, got %v %s", p.Username, want, e.Type, e.Data)
+		}
+		events = append(events, e)
+	}
+
+	return events
+}
+
+func (p *testPlayer) apply(e testEvent) {
+	switch e.Type {
+	case lobby.BoardEvent:
+		var b lobby.BoardData
+		e.decode(p.t, &b)
+		if b.Full {
+			p.board = make(map[game.CellPosition]lobby.CellData)
+		}
+		for _, c := range b.Cells {
+			p.board[game.CellPosition{X: c.X, Y: c.Y}] = c
+		}
+	case lobby.HandEvent:
+		var h lobby.HandData
+		e.decode(p.t, &h)
+		p.hand = h.Cards
+	case lobby.TurnEvent:
+		var turn lobby.TurnData
+		e.decode(p.t, &turn)
+		p.turn = turn.PlayerID
+	}
+}
+
+// expectClosed fails unless the server closes the connection
+func (p *testPlayer) expectClosed() {
+	p.t.Helper()
+
+	select {
+	case msg, ok := <-p.messages:
+		if ok {
+			p.t.Fatalf("Expected %v to be disconnected, got %s", p.Username, msg)
+		}
+	case <-time.After(5 * time.Second):
+		p.t.Fatalf("%v is still connected", p.Username)
+	}
+}
+
+// waitFragment reads html fragments until one contains every given snippet
+func (p *testPlayer) waitFragment(snippets ...string) string {
+	p.t.Helper()
+
+	for {
+		msg := string(p.next())
+
+		found := true
+		for _, s := range snippets {
+			found = found && strings.Contains(msg, s)
+		}
+		if found {
+			return msg
+		}
+	}
+}
+
+func TestLobbyFlowJSON(t *testing.T) {
+	ts := newTestServer(t)
+
+	ada := newTestPlayer(t, ts, "ada")
+	grace := newTestPlayer(t, ts, "grace")
+
+	lobbyID := ada.createLobby(2)
+	grace.joinLobby(lobbyID)
+
+	ada.connect(lobbyID, lobby.ProtocolJSONV1)
+	events := ada.expect(lobby.RosterEvent)
+
+	var roster lobby.RosterData
+	events[0].decode(t, &roster)
+	if roster.LobbyID != lobbyID || len(roster.Players) != 1 || roster.Players[0].Username != "ada" {
+		t.Errorf("Expected ada alone in the roster, got %+v", roster)
+	}
+
+	// the chat history is only sent once there is something in it
+	ada.send(lobby.ChatPayloadEvent, "hello")
+	ada.expect(lobby.ChatEvent)
+
+	grace.connect(lobbyID, lobby.ProtocolJSONV1)
+	events = ada.expect(lobby.PlayerStatusEvent, lobby.RosterEvent)
+
+	var status lobby.StatusData
+	events[0].decode(t, &status)
+	if status.Message != "grace joined" {
+		t.Errorf("Expected ada to see grace join, got %q", status.Message)
+	}
+	events[1].decode(t, &roster)
+	if len(roster.Players) != 2 {
+		t.Errorf("Expected both players in the roster, got %+v", roster.Players)
+	}
+	events = grace.expect(lobby.RosterEvent, lobby.ChatHistoryEvent)
+
+	var history lobby.ChatHistoryData
+	events[1].decode(t, &history)
+	if len(history.Messages) != 1 || history.Messages[0].Message != "hello" || history.Messages[0].Sender != "ada" {
+		t.Errorf("Expected grace to get the chat history, got %+v", history)
+	}
+
+	// readying up without a color is rejected
+	ada.send(lobby.SetReadyStatusPayloadEvent, "")
+	var rejected lobby.ErrorData
+	ada.expect(lobby.ErrorEvent)[0].decode(t, &rejected)
+	if rejected.Code != services.ErrorCodeInvalidArgument || rejected.Message == "" {
+		t.Errorf("Expected an invalid argument error, got %+v", rejected)
+	}
+
+	for _, p := range []struct {
+		player *testPlayer
+		color  string
+	}{{ada, "red"}, {grace, "blue"}} {
+		p.player.color = p.color
+		p.player.send(lobby.ChooseColorPayloadEvent, p.color)
+
+		for _, watcher := range []*testPlayer{ada, grace} {
+			var updated lobby.PlayerData
+			watcher.expect(lobby.PlayerUpdatedEvent)[0].decode(t, &updated)
+			if updated.Player.ID != p.player.PlayerID || updated.Player.Color != p.color {
+				t.Errorf("Expected %v to be %v, got %+v", p.player.Username, p.color, updated.Player)
+			}
+		}
+	}
+
+	ada.send(lobby.SetReadyStatusPayloadEvent, "")
+	ada.expect(lobby.PlayerUpdatedEvent)
+	grace.expect(lobby.PlayerUpdatedEvent)
+
+	// the last player to get ready starts the game
+	grace.send(lobby.SetReadyStatusPayloadEvent, "")
+	for _, p := range []*testPlayer{ada, grace} {
+		p.expect(lobby.PlayerUpdatedEvent, lobby.BoardEvent, lobby.HandEvent, lobby.TurnEvent)
+
+		if len(p.board) != game.BoardSize*game.BoardSize || len(p.hand) != 7 {
+			t.Fatalf("Expected %v to get the board and a full hand, got %v cells and %v cards", p.Username, len(p.board), len(p.hand))
+		}
+	}
+
+	if ada.turn != grace.turn {
+		t.Fatal("Expected both players to agree on whose turn it is")
+	}
+
+	winner := playUntilWon(t, ada, grace)
+	if winner != "red" {
+		t.Errorf("Expected red to win, got %v", winner)
+	}
+}
+
+func TestRematch(t *testing.T) {
+	ts := newTestServer(t)
+
+	ada := newTestPlayer(t, ts, "ada")
+	grace := newTestPlayer(t, ts, "grace")
+
+	res := ada.post("/lobby/create", url.Values{
+		"num_of_players": {"2"},
+		"max_hand_size":  {"7"},
+		"best_of":        {"3"},
+	})
+	lobbyID := strings.TrimPrefix(res.Header.Get("HX-Redirect"), "/lobby/")
+	grace.joinLobby(lobbyID)
+
+	ada.connect(lobbyID, lobby.ProtocolJSONV1)
+	ada.expect(lobby.RosterEvent)
+	grace.connect(lobbyID, lobby.ProtocolJSONV1)
+	ada.expect(lobby.PlayerStatusEvent, lobby.RosterEvent)
+	grace.expect(lobby.RosterEvent)
+
+	ada.color, grace.color = "red", "blue"
+	for _, p := range []*testPlayer{ada, grace} {
+		p.send(lobby.ChooseColorPayloadEvent, p.color)
+		ada.expect(lobby.PlayerUpdatedEvent)
+		grace.expect(lobby.PlayerUpdatedEvent)
+	}
+
+	// a rematch can only be asked for once a game ended
+	ada.send(lobby.RematchPayloadEvent, "")
+
+	ada.send(lobby.SetReadyStatusPayloadEvent, "")
+	ada.expect(lobby.PlayerUpdatedEvent)
+	grace.expect(lobby.PlayerUpdatedEvent)
+	grace.send(lobby.SetReadyStatusPayloadEvent, "")
+	ada.expect(lobby.PlayerUpdatedEvent, lobby.BoardEvent, lobby.HandEvent, lobby.TurnEvent)
+	grace.expect(lobby.PlayerUpdatedEvent, lobby.BoardEvent, lobby.HandEvent, lobby.TurnEvent)
+
+	first := ada.turn
+	playUntilWon(t, ada, grace)
+
+	var details handlers.LobbyDetails
+	ada.api(http.MethodGet, "/lobbies/"+lobbyID, nil, &details)
+	if details.State != internal.Finished.String() || details.Series == nil || details.Series.BestOf != 3 || details.Series.Games != 1 {
+		t.Fatalf("Expected the first game of a best of 3 to be recorded, got %v %+v", details.State, details.Series)
+	}
+
+	// wins are counted by color, nobody changes theirs during the series
+	grace.send(lobby.ChooseColorPayloadEvent, "green")
+	grace.expect(lobby.ErrorEvent)
+
+	ada.send(lobby.RematchPayloadEvent, "")
+	for _, p := range []*testPlayer{ada, grace} {
+		var status lobby.StatusData
+		p.expect(lobby.PlayerStatusEvent)[0].decode(t, &status)
+		if status.Message != "ada wants a rematch (1/2)" {
+			t.Errorf("Expected %v to see ada's vote, got %q", p.Username, status.Message)
+		}
+	}
+
+	// the last vote starts the next game without readying up
+	grace.send(lobby.RematchPayloadEvent, "")
+	for _, p := range []*testPlayer{ada, grace} {
+		p.expect(lobby.PlayerStatusEvent, lobby.BoardEvent, lobby.HandEvent, lobby.TurnEvent)
+		if len(p.hand) != 7 {
+			t.Errorf("Expected %v to get a new hand, got %v", p.Username, p.hand)
+		}
+	}
+	if ada.turn == first {
+		t.Error("Expected the seats to rotate so the other player goes first")
+	}
+
+	playUntilWon(t, ada, grace)
+
+	ada.api(http.MethodGet, "/lobbies/"+lobbyID, nil, &details)
+	if s := details.Series; s == nil || s.Games != 2 || s.Wins["red"]+s.Wins["blue"] != 2 || (s.Winner != "") != (s.Wins["red"] == 2 || s.Wins["blue"] == 2) {
+		t.Errorf("Expected two games in the series, got %+v", details.Series)
+	}
+}
+
+// playUntilWon plays the game out, red goes for sequences while the other
+// player stays out of its way. It returns the winning color.
+func playUntilWon(t *testing.T, players ...*testPlayer) string {
+	t.Helper()
+
+	byID := make(map[string]*testPlayer)
+	for _, p := range players {
+		byID[p.PlayerID] = p
+	}
+
+	for turn := 0; turn < 400; turn++ {
+		mover := byID[players[0].turn]
+		if mover == nil {
+			t.Fatalf("Unknown player %q has the turn", players[0].turn)
+		}
+
+		card, pos, ok := chooseMove(mover.board, mover.hand, mover.color, "red")
+		if !ok {
+			t.Fatalf("%v has no move to play with %v", mover.Username, mover.hand)
+		}
+		mover.send(lobby.PlayCardPayloadEvent, fmt.Sprintf("%v:%v:%v", card, pos.X, pos.Y))
+
+		var winner string
+		for _, p := range players {
+			events := []lobby.EventType{lobby.BoardEvent, lobby.PlayerStatusEvent}
+			if p == mover {
+				events = append(events, lobby.HandEvent)
+			}
+
+			var board lobby.BoardData
+			p.expect(events...)[0].decode(t, &board)
+			if board.Full || len(board.Cells) == 0 || board.Cells[0].X != pos.X || board.Cells[0].Y != pos.Y {
+				t.Fatalf("Expected %v to get the played cell %v, got %+v", p.Username, pos, board)
+			}
+
+			// the winning move is followed by the result instead of a turn
+			e := p.read()
+			switch e.Type {
+			case lobby.TurnEvent:
+			case lobby.GameOverEvent:
+				var result lobby.GameOverData
+				e.decode(t, &result)
+				winner = result.WinnerColor
+			default:
+				t.Fatalf("%v expected a turn or game_over event, got %v %s", p.Username, e.Type, e.Data)
+			}
+		}
+
+		if winner != "" {
+			return winner
+		}
+	}
+
+	t.Fatal("Expected the game to be won within 400 turns")
+	return ""
+}
+
+// chooseMove picks the card and cell to play, the attacker plays the cell that
+// brings it closest to a sequence and everyone else the cell that helps the
+// attacker and itself least
+func chooseMove(board map[game.CellPosition]lobby.CellData, hand []game.Card, color, attacker string) (int, game.CellPosition, bool) {
+	best, bestCard, bestPos := -1<<31, -1, game.CellPosition{}
+
+	for i, card := range hand {
+		for pos, cell := range board {
+			var value int
+			switch {
+			case cell.IsCorner:
+				continue
+			case game.IsOneEyedJack(card):
+				// only when nothing else can be played
+				if !cell.ChipPlaced || cell.ChipColor == color || cell.CellLocked {
+					continue
+				}
+				value = -1000
+			case cell.ChipPlaced:
+				continue
+			case game.IsTwoEyedJack(card):
+				value = -1
+			case cell.Type != card.Type || cell.Suit != card.Suit:
+				continue
+			}
+
+			if color == attacker {
+				value += sequenceScore(board, pos, attacker) * 4
+			} else {
+				value -= sequenceScore(board, pos, attacker)*4 + sequenceScore(board, pos, color)*16
+			}
+
+			if value > best {
+				best, bestCard, bestPos = value, i, pos
+			}
+		}
+	}
+
+	return bestCard, bestPos, bestCard >= 0
+}
+
+// sequenceScore is the most cells color would own in a window of five cells
+// going through pos if it placed a chip there
+func sequenceScore(board map[game.CellPosition]lobby.CellData, pos game.CellPosition, color string) int {
+	var best int
+
+	for _, d := range []game.CellPosition{{X: 1, Y: 0}, {X: 0, Y: 1}, {X: 1, Y: 1}, {X: 1, Y: -1}} {
+		for start := -(game.SequenceSize - 1); start <= 0; start++ {
+			owned, locked := 0, 0
+			for i := start; i < start+game.SequenceSize; i++ {
+				cell, ok := board[game.CellPosition{X: pos.X + i*d.X, Y: pos.Y + i*d.Y}]
+				switch {
+				case !ok || (cell.ChipPlaced && cell.ChipColor != color):
+					owned = -1
+				case owned < 0:
+				case i == 0 || cell.IsCorner:
+					owned++
+				case cell.ChipPlaced:
+					owned++
+					if cell.CellLocked {
+						locked++
+					}
+				}
+			}
+
+			// a new sequence can share a single cell with an older one
+			if owned > best && locked <= 1 {
+				best = owned
+			}
+		}
+	}
+
+	return best
+}
+
+func TestScoreAttack(t *testing.T) {
+	ts := newTestServer(t)
+
+	ada := newTestPlayer(t, ts, "ada")
+
+	res := ada.post("/lobby/create", url.Values{
+		"num_of_players": {"1"},
+		"max_hand_size":  {"7"},
+		"mode":           {game.ModeScoreAttack},
+	})
+	lobbyID := strings.TrimPrefix(res.Header.Get("HX-Redirect"), "/lobby/")
+
+	ada.connect(lobbyID, lobby.ProtocolJSONV1)
+	ada.expect(lobby.RosterEvent)
+
+	ada.color = "green"
+	ada.send(lobby.ChooseColorPayloadEvent, ada.color)
+	ada.expect(lobby.PlayerUpdatedEvent)
+
+	// a single player starts the game on their own
+	ada.send(lobby.SetReadyStatusPayloadEvent, "")
+	ada.expect(lobby.PlayerUpdatedEvent, lobby.BoardEvent, lobby.HandEvent, lobby.TurnEvent)
+
+	if len(ada.hand) != 7 || ada.turn != ada.PlayerID {
+		t.Errorf("Expected ada to play with 7 cards, got %v cards and the turn of %q", len(ada.hand), ada.turn)
+	}
+
+	var details handlers.LobbyDetails
+	ada.api(http.MethodGet, "/lobbies/"+lobbyID, nil, &details)
+	if details.State != internal.InGame.String() || details.Settings.Mode != game.ModeScoreAttack {
+		t.Errorf("Expected a score attack game, got %v %+v", details.State, details.Settings)
+	}
+}
+
+func TestLeaveDuringGame(t *testing.T) {
+	ts := newTestServer(t)
+
+	ada := newTestPlayer(t, ts, "ada")
+	grace := newTestPlayer(t, ts, "grace")
+
+	lobbyID := ada.createLobby(2)
+	grace.joinLobby(lobbyID)
+
+	ada.connect(lobbyID, lobby.ProtocolJSONV1)
+	ada.expect(lobby.RosterEvent)
+	grace.connect(lobbyID, lobby.ProtocolJSONV1)
+	ada.expect(lobby.PlayerStatusEvent, lobby.RosterEvent)
+	grace.expect(lobby.RosterEvent)
+
+	ada.color, grace.color = "red", "blue"
+	for _, p := range []*testPlayer{ada, grace} {
+		p.send(lobby.ChooseColorPayloadEvent, p.color)
+		ada.expect(lobby.PlayerUpdatedEvent)
+		grace.expect(lobby.PlayerUpdatedEvent)
+	}
+	for _, p := range []*testPlayer{ada, grace} {
+		p.send(lobby.SetReadyStatusPayloadEvent, "")
+		ada.expect(lobby.PlayerUpdatedEvent)
+		grace.expect(lobby.PlayerUpdatedEvent)
+	}
+	ada.expect(lobby.BoardEvent, lobby.HandEvent, lobby.TurnEvent)
+	grace.expect(lobby.BoardEvent, lobby.HandEvent, lobby.TurnEvent)
+
+	// the last player left at the table wins
+	grace.send(lobby.LeavePayloadEvent, "")
+	events := ada.expect(lobby.PlayerStatusEvent, lobby.BoardEvent, lobby.PlayerStatusEvent, lobby.GameOverEvent)
+
+	var over lobby.GameOverData
+	events[3].decode(t, &over)
+	if over.WinnerColor != "red" {
+		t.Errorf("Expected red to win once blue left, got %+v", over)
+	}
+}
+
+func TestReconnectDuringGame(t *testing.T) {
+	ts := newTestServer(t, func(c *config.Config) { c.ReconnectTTL = 500 * time.Millisecond })
+
+	ada := newTestPlayer(t, ts, "ada")
+	grace := newTestPlayer(t, ts, "grace")
+	carol := newTestPlayer(t, ts, "carol")
+
+	lobbyID := ada.createLobby(2)
+	grace.joinLobby(lobbyID)
+
+	ada.connect(lobbyID, lobby.ProtocolJSONV1)
+	ada.expect(lobby.RosterEvent)
+	grace.connect(lobbyID, lobby.ProtocolJSONV1)
+	ada.expect(lobby.PlayerStatusEvent, lobby.RosterEvent)
+	grace.expect(lobby.RosterEvent)
+
+	ada.color, grace.color = "red", "blue"
+	for _, p := range []*testPlayer{ada, grace} {
+		p.send(lobby.ChooseColorPayloadEvent, p.color)
+		ada.expect(lobby.PlayerUpdatedEvent)
+		grace.expect(lobby.PlayerUpdatedEvent)
+	}
+	for _, p := range []*testPlayer{ada, grace} {
+		p.send(lobby.SetReadyStatusPayloadEvent, "")
+		ada.expect(lobby.PlayerUpdatedEvent)
+		grace.expect(lobby.PlayerUpdatedEvent)
+	}
+	ada.expect(lobby.BoardEvent, lobby.HandEvent, lobby.TurnEvent)
+	grace.expect(lobby.BoardEvent, lobby.HandEvent, lobby.TurnEvent)
+	hand := grace.hand
+
+	// the seat of a player that lost their connection is kept for them
+	grace.ws.Close()
+	time.Sleep(50 * time.Millisecond)
+	res := carol.post("/lobby/join", url.Values{"lobby-id": {lobbyID}})
+	if res.Header.Get("HX-Redirect") != "" {
+		t.Fatal("Expected the seat of grace to be kept")
+	}
+
+	grace.connect(lobbyID, lobby.ProtocolJSONV1)
+	grace.expect(lobby.BoardEvent, lobby.HandEvent, lobby.TurnEvent)
+	if !slices.Equal(grace.hand, hand) {
+		t.Errorf("Expected grace to get her hand back, got %v", grace.hand)
+	}
+
+	// and given up once they stay away
+	grace.ws.Close()
+	for {
+		e := ada.read()
+		if e.Type != lobby.GameOverEvent {
+			continue
+		}
+		var over lobby.GameOverData
+		e.decode(t, &over)
+		if over.WinnerColor != "red" {
+			t.Errorf("Expected red to win once blue forfeited, got %+v", over)
+		}
+		break
+	}
+}
+
+func TestColorSelection(t *testing.T) {
+	ts := newTestServer(t)
+
+	ada := newTestPlayer(t, ts, "ada")
+	grace := newTestPlayer(t, ts, "grace")
+
+	lobbyID := ada.createLobby(2)
+	grace.joinLobby(lobbyID)
+
+	ada.connect(lobbyID, lobby.ProtocolJSONV1)
+	ada.expect(lobby.RosterEvent)
+	grace.connect(lobbyID, lobby.ProtocolJSONV1)
+	ada.expect(lobby.PlayerStatusEvent, lobby.RosterEvent)
+	grace.expect(lobby.RosterEvent)
+
+	ada.send(lobby.ChooseColorPayloadEvent, "red")
+	ada.expect(lobby.PlayerUpdatedEvent)
+	grace.expect(lobby.PlayerUpdatedEvent)
+
+	for _, color := range []string{"red", "purple"} {
+		grace.send(lobby.ChooseColorPayloadEvent, color)
+		var e lobby.ErrorData
+		grace.expect(lobby.ErrorEvent)[0].decode(t, &e)
+		if e.Code != services.ErrorCodeInvalidArgument {
+			t.Errorf("Expected %v to be rejected, got %+v", color, e)
+		}
+	}
+
+	// changing colors frees the old one
+	ada.send(lobby.ChooseColorPayloadEvent, "blue")
+	ada.expect(lobby.PlayerUpdatedEvent)
+	grace.expect(lobby.PlayerUpdatedEvent)
+	grace.send(lobby.ChooseColorPayloadEvent, "red")
+	ada.expect(lobby.PlayerUpdatedEvent)
+	grace.expect(lobby.PlayerUpdatedEvent)
+
+	// and so does leaving
+	grace.send(lobby.LeavePayloadEvent, "")
+	ada.expect(lobby.PlayerStatusEvent)
+	ada.send(lobby.ChooseColorPayloadEvent, "red")
+	ada.expect(lobby.PlayerUpdatedEvent)
+}
+
+func TestLobbyFlowHTML(t *testing.T) {
+	ts := newTestServer(t)
+
+	ada := newTestPlayer(t, ts, "ada")
+	grace := newTestPlayer(t, ts, "grace")
+
+	lobbyID := ada.createLobby(2)
+	grace.joinLobby(lobbyID)
+
+	ada.connect(lobbyID, "")
+	ada.waitFragment("ada")
+
+	grace.connect(lobbyID, "")
+	grace.waitFragment("ada", "grace")
+	ada.waitFragment("grace joined")
+	ada.waitFragment("ada", "grace")
+}
+
+func TestLobbyListWS(t *testing.T) {
+	ts := newTestServer(t)
+	ada := newTestPlayer(t, ts, "ada")
+
+	u, _ := url.Parse(ts.URL)
+	dialer := websocket.Dialer{
+		TLSClientConfig: ts.Client().Transport.(*http.Transport).TLSClientConfig,
+	}
+
+	var viewers []*websocket.Conn
+	for i := 0; i < 2; i++ {
+		ws, _, err := dialer.Dial("wss://"+u.Host+"/lobby/list/ws", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { ws.Close() })
+
+		// the current list is sent right away
+		if _, _, err := ws.ReadMessage(); err != nil {
+			t.Fatal(err)
+		}
+		viewers = append(viewers, ws)
+	}
+
+	lobbyID := ada.createLobby(2)
+
+	for i, ws := range viewers {
+		ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for {
+			_, msg, err := ws.ReadMessage()
+			if err != nil {
+				t.Fatalf("Expected viewer %v to see lobby %v: %v", i, lobbyID, err)
+			}
+			if bytes.Contains(msg, []byte(lobbyID)) {
+				break
+			}
+		}
+	}
+}
+
+func TestJoinMissingLobby(t *testing.T) {
+	ts := newTestServer(t)
+
+	ada := newTestPlayer(t, ts, "ada")
+
+	res, err := ada.http.PostForm(ts.URL+"/lobby/join", url.Values{"lobby-id": {"NOPE"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, _ := io.ReadAll(res.Body)
+	if res.Header.Get("HX-Redirect") != "" || !strings.Contains(string(body), "Lobby not found") {
+		t.Errorf("Expected a lobby not found toast, got %q", body)
+	}
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected a not found status, got %v", res.Status)
+	}
+}
+
+func TestHTTPErrors(t *testing.T) {
+	ts := newTestServer(t)
+
+	ada := newTestPlayer(t, ts, "ada")
+	grace := newTestPlayer(t, ts, "grace")
+	alan := newTestPlayer(t, ts, "alan")
+
+	lobbyID := ada.createLobby(2)
+	grace.joinLobby(lobbyID)
+	ada.connect(lobbyID, lobby.ProtocolJSONV1)
+	ada.expect(lobby.RosterEvent)
+	grace.connect(lobbyID, lobby.ProtocolJSONV1)
+	grace.expect(lobby.RosterEvent)
+
+	postJSON := func(p *testPlayer, path string, form url.Values) (*http.Response, lobby.ErrorData) {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodPost, ts.URL+path, strings.NewReader(form.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Accept", "application/json")
+
+		res, err := p.http.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		var body struct {
+			Error lobby.ErrorData `json:"error"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		return res, body.Error
+	}
+
+	tests := map[string]struct {
+		path   string
+		form   url.Values
+		status int
+		code   services.ErrorCode
+	}{
+		"missing lobby":    {"/lobby/join", url.Values{"lobby-id": {"NOPE"}}, http.StatusNotFound, services.ErrorCodeNotFound},
+		"full lobby":       {"/lobby/join", url.Values{"lobby-id": {lobbyID}}, http.StatusConflict, services.ErrorCodeLobbyFull},
+		"bad settings":     {"/lobby/create", url.Values{"num_of_players": {"two"}, "max_hand_size": {"7"}}, http.StatusBadRequest, services.ErrorCodeInvalidArgument},
+		"bad rules":        {"/lobby/create", url.Values{"num_of_players": {"2"}, "max_hand_size": {"7"}, "rules": {"anything goes"}}, http.StatusBadRequest, services.ErrorCodeInvalidArgument},
+		"bad mode":         {"/lobby/create", url.Values{"num_of_players": {"2"}, "max_hand_size": {"7"}, "mode": {"score_attack"}}, http.StatusBadRequest, services.ErrorCodeInvalidArgument},
+		"bad quick match":  {"/lobby/quick-match", url.Values{"num_of_players": {"two"}}, http.StatusBadRequest, services.ErrorCodeInvalidArgument},
+		"huge quick match": {"/lobby/quick-match", url.Values{"num_of_players": {"99"}}, http.StatusBadRequest, services.ErrorCodeInvalidArgument},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			res, e := postJSON(alan, test.path, test.form)
+			if res.StatusCode != test.status || e.Code != test.code || e.Message == "" {
+				t.Errorf("Expected %v %v, got %v %+v", test.status, test.code, res.Status, e)
+			}
+		})
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	ts := newTestServer(t)
+
+	ada := newTestPlayer(t, ts, "ada")
+	lobbyID := ada.createLobby(2)
+	ada.connect(lobbyID, lobby.ProtocolJSONV1)
+	ada.expect(lobby.RosterEvent)
+
+	res, err := ada.http.Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, _ := io.ReadAll(res.Body)
+	for _, want := range []string{
+		`sequence_lobbies{state="lobby"} 1`,
+		`sequence_lobbies{state="game"} 0`,
+		`sequence_responses_total{action="join_lobby"}`,
+		`sequence_response_delivery_seconds_count{action="join_lobby"}`,
+		"sequence_websocket_clients",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("Expected %q in the metrics", want)
+		}
+	}
+}
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(trace.NewNoopTracerProvider()) })
+
+	if _, err := tracing.Setup(context.Background(), config.Default().Tracing); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := newTestServer(t)
+
+	ada := newTestPlayer(t, ts, "ada")
+	lobbyID := ada.createLobby(2)
+	ada.connect(lobbyID, lobby.ProtocolJSONV1)
+	ada.expect(lobby.RosterEvent)
+
+	ada.send(lobby.ChatPayloadEvent, "hello")
+	ada.expect(lobby.ChatEvent)
+
+	// the chat message is a single trace from the websocket to the response
+	// being written back
+	var delivered sdktrace.ReadOnlySpan
+	for deadline := time.Now().Add(5 * time.Second); delivered == nil; {
+		for _, s := range recorder.Ended() {
+			if s.Name() == "wsClient.new_chat_message" {
+				delivered = s
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the chat response to be traced")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	names := make(map[string]bool)
+	for _, s := range recorder.Ended() {
+		if s.SpanContext().TraceID() == delivered.SpanContext().TraceID() {
+			names[s.Name()] = true
+		}
+	}
+
+	for _, want := range []string{"wsClient.publishToLobby", "lobby.payloadChannel", "lobby.publishResponse", "wsClient.new_chat_message"} {
+		if !names[want] {
+			t.Errorf("Expected a %v span in the chat trace, got %v", want, names)
+		}
+	}
+
+	var routes []string
+	for _, s := range recorder.Ended() {
+		if s.SpanKind() == trace.SpanKindServer {
+			routes = append(routes, s.Name())
+		}
+	}
+	if !strings.Contains(strings.Join(routes, ","), "POST /lobby/create") {
+		t.Errorf("Expected the requests to be traced by route, got %v", routes)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	ts := newTestServer(t)
+
+	res, err := ts.Client().Get(ts.URL + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected the server to be healthy, got %v", res.Status)
+	}
+
+	// the lobby manager is started in the background
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		res, err := ts.Client().Get(ts.URL + "/readyz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode == http.StatusOK {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the server to be ready, got %v", res.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	ts := newTestServer(t, func(c *config.Config) { c.AdminToken = "admin secret" })
+
+	admin := func(method, path, token string) (*http.Response, []byte) {
+		t.Helper()
+
+		req, err := http.NewRequest(method, ts.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		res, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		body, _ := io.ReadAll(res.Body)
+		return res, body
+	}
+
+	for _, token := range []string{"", "guess"} {
+		if res, _ := admin(http.MethodGet, "/admin/lobbies", token); res.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected token %q to be turned away, got %v", token, res.Status)
+		}
+	}
+
+	ada := newTestPlayer(t, ts, "ada")
+	grace := newTestPlayer(t, ts, "grace")
+
+	lobbyID := ada.createLobby(2)
+	ada.connect(lobbyID, lobby.ProtocolJSONV1)
+	ada.expect(lobby.RosterEvent)
+	grace.connect(lobbyID, lobby.ProtocolJSONV1)
+	grace.expect(lobby.RosterEvent)
+	ada.expect(lobby.PlayerStatusEvent, lobby.RosterEvent)
+
+	res, body := admin(http.MethodGet, "/admin/lobbies", "admin secret")
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the lobbies to be listed, got %v %s", res.Status, body)
+	}
+
+	var list struct {
+		Lobbies []lobby.AdminLobby `json:"lobbies"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Lobbies) != 1 || list.Lobbies[0].ID != lobbyID || len(list.Lobbies[0].Players) != 2 {
+		t.Fatalf("Expected %v with both players, got %s", lobbyID, body)
+	}
+	if l := list.Lobbies[0]; l.State != "lobby" || l.CreatedAt.IsZero() || l.LastActivity.Before(l.CreatedAt) {
+		t.Errorf("Unexpected lobby listing %+v", l)
+	}
+
+	if res, body := admin(http.MethodGet, "/admin/lobbies/"+lobbyID, "admin secret"); !strings.Contains(string(body), grace.PlayerID) {
+		t.Errorf("Expected the lobby state, got %v %s", res.Status, body)
+	}
+
+	res, _ = admin(http.MethodPost, "/admin/lobbies/"+lobbyID+"/players/"+grace.PlayerID+"/kick", "admin secret")
+	if res.StatusCode != http.StatusAccepted {
+		t.Fatalf("Expected grace to be kicked, got %v", res.Status)
+	}
+	grace.expect(lobby.ToastEvent)
+	grace.expectClosed()
+	ada.expect(lobby.PlayerStatusEvent)
+
+	res, _ = admin(http.MethodPost, "/admin/lobbies/"+lobbyID+"/close", "admin secret")
+	if res.StatusCode != http.StatusAccepted {
+		t.Fatalf("Expected the lobby to be closed, got %v", res.Status)
+	}
+	ada.expect(lobby.ToastEvent)
+	ada.expectClosed()
+
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		if res, _ := admin(http.MethodGet, "/admin/lobbies/"+lobbyID, "admin secret"); res.StatusCode == http.StatusNotFound {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the closed lobby to be gone")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAdminDisabled(t *testing.T) {
+	ts := newTestServer(t)
+
+	res, err := ts.Client().Get(ts.URL + "/admin/lobbies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected no admin area without a token, got %v", res.Status)
+	}
+}
+
+func TestAPI(t *testing.T) {
+	ts := newTestServer(t)
+
+	ada := newAnonymousPlayer(t, ts)
+	grace := newAnonymousPlayer(t, ts)
+
+	settings := handlers.CreateLobbyRequest{Settings: internal.Settings{
+		NumOfPlayers: 2,
+		MaxHandSize:  7,
+		Visibility:   internal.VisibilityPublic,
+	}}
+
+	if res, e := ada.api(http.MethodPost, "/lobbies", settings, nil); res.StatusCode != http.StatusUnauthorized || e.Code != services.ErrorCodeUnauthorized {
+		t.Fatalf("Expected a lobby to need an identity, got %v %+v", res.Status, e)
+	}
+
+	for _, p := range []struct {
+		player *testPlayer
+		name   string
+	}{{ada, "ada"}, {grace, "grace"}} {
+		var id handlers.Identity
+		if res, e := p.player.api(http.MethodPost, "/identity", handlers.IdentityRequest{DisplayName: p.name}, &id); res.StatusCode != http.StatusOK {
+			t.Fatalf("Expected an identity for %v, got %v %+v", p.name, res.Status, e)
+		}
+		if id.PlayerID == "" || id.Username != p.name {
+			t.Fatalf("Unexpected identity %+v", id)
+		}
+		p.player.PlayerID, p.player.Username = id.PlayerID, id.Username
+	}
+
+	if res, e := ada.api(http.MethodPost, "/identity", handlers.IdentityRequest{DisplayName: "<b>"}, nil); res.StatusCode != http.StatusBadRequest || e.Code != services.ErrorCodeInvalidArgument {
+		t.Errorf("Expected the display name to be rejected, got %v %+v", res.Status, e)
+	}
+
+	invalid := handlers.CreateLobbyRequest{Settings: internal.Settings{NumOfPlayers: 7, MaxHandSize: 1, Teams: true, Visibility: "hidden"}}
+	res, e := ada.api(http.MethodPost, "/lobbies", invalid, nil)
+	if res.StatusCode != http.StatusBadRequest || e.Code != services.ErrorCodeInvalidArgument || strings.Count(e.Message, ";") != 2 {
+		t.Errorf("Expected every bad setting to be reported, got %v %+v", res.Status, e)
+	}
+
+	var created handlers.LobbyDetails
+	if res, e := ada.api(http.MethodPost, "/lobbies", settings, &created); res.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected a lobby, got %v %+v", res.Status, e)
+	}
+	if len(created.ID) != 4 || created.State != internal.Created.String() || created.Settings != settings.Settings {
+		t.Fatalf("Unexpected lobby %+v", created)
+	}
+
+	var list handlers.LobbyList
+	grace.api(http.MethodGet, "/lobbies", nil, &list)
+	if len(list.Lobbies) != 1 || list.Lobbies[0].ID != created.ID || !list.Lobbies[0].Open {
+		t.Errorf("Expected the lobby to be listed, got %+v", list)
+	}
+
+	if res, e := grace.api(http.MethodGet, "/lobbies/NOPE", nil, nil); res.StatusCode != http.StatusNotFound || e.Code != services.ErrorCodeNotFound {
+		t.Errorf("Expected a missing lobby, got %v %+v", res.Status, e)
+	}
+	if res, e := grace.api(http.MethodGet, "/lobbies/"+created.ID+"/game", nil, nil); res.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected no game before it started, got %v %+v", res.Status, e)
+	}
+
+	for _, p := range []*testPlayer{ada, grace} {
+		var joined handlers.JoinedLobby
+		if res, e := p.api(http.MethodPost, "/lobbies/"+created.ID+"/join", handlers.JoinLobbyRequest{}, &joined); res.StatusCode != http.StatusOK {
+			t.Fatalf("Expected %v to join, got %v %+v", p.Username, res.Status, e)
+		}
+		if !strings.Contains(joined.WebsocketURL, created.ID) || joined.Protocol != lobby.ProtocolJSONV1 {
+			t.Errorf("Expected a websocket to connect to, got %+v", joined)
+		}
+		p.connect(created.ID, joined.Protocol)
+		p.expect(lobby.RosterEvent)
+	}
+	ada.expect(lobby.PlayerStatusEvent, lobby.RosterEvent)
+
+	alan := newAnonymousPlayer(t, ts)
+	alan.api(http.MethodPost, "/identity", nil, nil)
+	if res, e := alan.api(http.MethodPost, "/lobbies/"+created.ID+"/join", nil, nil); res.StatusCode != http.StatusConflict || e.Code != services.ErrorCodeLobbyFull {
+		t.Errorf("Expected the lobby to be full, got %v %+v", res.Status, e)
+	}
+
+	for _, p := range []struct {
+		player *testPlayer
+		color  string
+	}{{ada, "red"}, {grace, "blue"}} {
+		p.player.send(lobby.ChooseColorPayloadEvent, p.color)
+		ada.expect(lobby.PlayerUpdatedEvent)
+		grace.expect(lobby.PlayerUpdatedEvent)
+	}
+	ada.send(lobby.SetReadyStatusPayloadEvent, "")
+	ada.expect(lobby.PlayerUpdatedEvent)
+	grace.expect(lobby.PlayerUpdatedEvent)
+	grace.send(lobby.SetReadyStatusPayloadEvent, "")
+	for _, p := range []*testPlayer{ada, grace} {
+		p.expect(lobby.PlayerUpdatedEvent, lobby.BoardEvent, lobby.HandEvent, lobby.TurnEvent)
+	}
+
+	var state handlers.GameState
+	if res, e := alan.api(http.MethodGet, "/lobbies/"+created.ID+"/game", nil, &state); res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the game state, got %v %+v", res.Status, e)
+	}
+	if len(state.Board) != game.BoardSize*game.BoardSize || state.Turn != ada.turn || len(state.Players) != 2 {
+		t.Errorf("Unexpected game state %+v", state)
+	}
+
+	var hand lobby.HandData
+	if res, e := ada.api(http.MethodGet, "/lobbies/"+created.ID+"/hand", nil, &hand); res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected ada's hand, got %v %+v", res.Status, e)
+	}
+	if fmt.Sprint(hand.Cards) != fmt.Sprint(ada.hand) {
+		t.Errorf("Expected the hand ada was dealt, got %v and %v", hand.Cards, ada.hand)
+	}
+	if res, e := alan.api(http.MethodGet, "/lobbies/"+created.ID+"/hand", nil, nil); res.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected alan to have no hand, got %v %+v", res.Status, e)
+	}
+
+	if res, e := grace.api(http.MethodPost, "/lobbies/"+created.ID+"/leave", nil, nil); res.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected grace to leave, got %v %+v", res.Status, e)
+	}
+	grace.expect(lobby.ToastEvent)
+	grace.expectClosed()
+	ada.expect(lobby.PlayerStatusEvent)
+
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		var details handlers.LobbyDetails
+		ada.api(http.MethodGet, "/lobbies/"+created.ID, nil, &details)
+		if len(details.Players) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected grace to be gone, got %+v", details)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	ts := newTestServer(t)
+
+	var doc struct {
+		OpenAPI    string                               `json:"openapi"`
+		Paths      map[string]map[string]map[string]any `json:"paths"`
+		Components struct {
+			Schemas map[string]map[string]any `json:"schemas"`
+		} `json:"components"`
+	}
+	res, _ := newAnonymousPlayer(t, ts).api(http.MethodGet, "/openapi.json", nil, &doc)
+	if res.StatusCode != http.StatusOK || doc.OpenAPI == "" {
+		t.Fatalf("Expected the OpenAPI document, got %v", res.Status)
+	}
+
+	for path, method := range map[string]string{
+		"/api/v1/lobbies":                "post",
+		"/api/v1/lobbies/{lobbyID}":      "get",
+		"/api/v1/lobbies/{lobbyID}/join": "post",
+		"/api/v1/lobbies/{lobbyID}/hand": "get",
+	} {
+		if _, ok := doc.Paths[path][method]; !ok {
+			t.Errorf("Expected %v %v to be documented", method, path)
+		}
+	}
+
+	for _, name := range []string{"CreateLobbyRequest", "LobbyDetails", "Settings", "ErrorData", "GameState"} {
+		if doc.Components.Schemas[name] == nil {
+			t.Errorf("Expected a %v schema", name)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	ts := newTestServer(t, func(c *config.Config) {
+		c.Limits.CreateLobby.Session = ratelimit.Rate{Burst: 2, Every: time.Hour}
+		c.Limits.WsMessages.Session = ratelimit.Rate{Burst: 2, Every: time.Hour}
+		c.Limits.MaxMessageSize = 256
+		c.Limits.MaxLobbies = 2
+		c.Limits.AllowedOrigins = []string{"https://friend.example"}
+	})
+
+	ada := newTestPlayer(t, ts, "ada")
+	grace := newTestPlayer(t, ts, "grace")
+	lobbyID := ada.createLobby(2)
+
+	// grace may create a lobby but the cap was reached after that
+	settings := handlers.CreateLobbyRequest{Settings: lobby.DefaultQuickMatchSettings}
+	if res, e := grace.api(http.MethodPost, "/lobbies", settings, nil); res.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected grace to create a lobby, got %v %+v", res.Status, e)
+	}
+	if res, e := ada.api(http.MethodPost, "/lobbies", settings, nil); res.StatusCode != http.StatusServiceUnavailable || e.Code != services.ErrorCodeUnavailable {
+		t.Errorf("Expected the lobby cap to be reached, got %v %+v", res.Status, e)
+	}
+	if res, e := ada.api(http.MethodPost, "/lobbies", settings, nil); res.StatusCode != http.StatusTooManyRequests || e.Code != services.ErrorCodeRateLimited {
+		t.Errorf("Expected ada to be rate limited, got %v %+v", res.Status, e)
+	}
+
+	u, _ := url.Parse(ts.URL)
+	dial := func(p *testPlayer, origin string) (*websocket.Conn, *http.Response, error) {
+		header := http.Header{"Origin": {origin}}
+		for _, c := range p.http.Jar.Cookies(u) {
+			header.Add("Cookie", c.String())
+		}
+		dialer := websocket.Dialer{
+			TLSClientConfig: ts.Client().Transport.(*http.Transport).TLSClientConfig,
+			Subprotocols:    []string{lobby.ProtocolJSONV1},
+		}
+		return dialer.Dial("wss://"+u.Host+"/lobby/ws?lobby-id="+lobbyID, header)
+	}
+
+	if _, res, err := dial(grace, "https://evil.example"); err == nil || res.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected a foreign origin to be turned away, got %v", err)
+	}
+	ws, _, err := dial(grace, "https://friend.example")
+	if err != nil {
+		t.Fatalf("Expected an allowed origin to connect, got %v", err)
+	}
+	ws.Close()
+
+	ada.connect(lobbyID, lobby.ProtocolJSONV1)
+	ada.expect(lobby.RosterEvent)
+
+	for i := 0; i < 2; i++ {
+		ada.send(lobby.ChatPayloadEvent, "hello")
+		ada.expect(lobby.ChatEvent)
+	}
+	ada.send(lobby.ChatPayloadEvent, "hello")
+	var limited lobby.ErrorData
+	ada.expect(lobby.ErrorEvent)[0].decode(t, &limited)
+	if limited.Code != services.ErrorCodeRateLimited {
+		t.Errorf("Expected the third message to be rate limited, got %+v", limited)
+	}
+
+	if err := ada.ws.WriteJSON(lobby.WsPayload{Action: lobby.ChatPayloadEvent, Message: strings.Repeat("a", 512)}); err != nil {
+		t.Fatal(err)
+	}
+	ada.expectClosed()
+}
@@ -0,0 +1,325 @@
+// tui is a terminal client for go-sequence. It talks to the server the same
+// way the browser does but asks for the sequence.v1+json subprotocol so it
+// receives typed JSON events instead of htmx fragments.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/spacesedan/go-sequence/internal/lobby"
+)
+
+func main() {
+	server := flag.String("server", "http://localhost:42069", "base url of the sequence server")
+	name := flag.String("name", "", "display name to play as, a random one is generated when empty")
+	join := flag.String("join", "", "id of the lobby to join")
+	players := flag.Int("players", 2, "number of players when creating a lobby")
+	handSize := flag.Int("hand-size", 7, "max hand size when creating a lobby")
+	private := flag.Bool("private", false, "keep a created lobby out of the public lobby list")
+	quick := flag.Bool("quick", false, "join the fullest open public lobby or create one")
+	password := flag.String("password", "", "password of a private lobby, or the password to protect a created lobby with")
+	invite := flag.String("invite", "", "invite token from an invite link, skips the lobby password")
+	flag.Parse()
+
+	base, err := url.Parse(*server)
+	if err != nil {
+		log.Fatalf("invalid server url: %v", err)
+	}
+
+	api := newAPIClient(base)
+
+	if err := api.startSession(*name); err != nil {
+		log.Fatalf("could not pick a display name: %v", err)
+	}
+
+	lobbyID := strings.ToUpper(strings.TrimSpace(*join))
+	switch {
+	case *quick:
+		lobbyID, err = api.quickMatch(*players)
+	case lobbyID == "":
+		lobbyID, err = api.createLobby(*players, *handSize, *private, *password)
+	default:
+		err = api.joinLobby(lobbyID, *password, *invite)
+	}
+	if err != nil {
+		log.Fatalf("could not enter lobby: %v", err)
+	}
+
+	conn, err := api.dial(lobbyID, *invite)
+	if err != nil {
+		log.Fatalf("could not connect to lobby %v: %v", lobbyID, err)
+	}
+	defer conn.Close()
+
+	ui := newScreen(os.Stdout, api.playerID, api.username, lobbyID)
+	ui.render()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		readEvents(conn, ui)
+	}()
+
+	go readCommands(os.Stdin, conn, ui)
+
+	<-done
+	fmt.Println("disconnected")
+}
+
+// readEvents decodes events from the server until the connection closes
+func readEvents(conn *websocket.Conn, ui *screen) {
+	for {
+		var e event
+		if err := conn.ReadJSON(&e); err != nil {
+			ui.setStatus(fmt.Sprintf("connection closed: %v", err))
+			return
+		}
+		if err := ui.apply(e); err != nil {
+			ui.setStatus(fmt.Sprintf("bad %v event: %v", e.Type, err))
+		}
+		ui.render()
+	}
+}
+
+// readCommands turns lines typed by the player into payloads. Anything that
+// isn't a command is sent as a chat message.
+func readCommands(f *os.File, conn *websocket.Conn, ui *screen) {
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			ui.render()
+			continue
+		}
+
+		payload, err := parseCommand(line)
+		if err != nil {
+			ui.setStatus(err.Error())
+			ui.render()
+			continue
+		}
+		if payload == nil {
+			conn.WriteMessage(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			return
+		}
+
+		if err := conn.WriteJSON(payload); err != nil {
+			ui.setStatus(fmt.Sprintf("failed to send: %v", err))
+		}
+		ui.render()
+	}
+}
+
+// parseCommand converts a line into a payload, a nil payload means quit
+func parseCommand(line string) (*lobby.WsPayload, error) {
+	if !strings.HasPrefix(line, "/") {
+		return &lobby.WsPayload{Action: lobby.ChatPayloadEvent, Message: line}, nil
+	}
+
+	fields := strings.Fields(line)
+	switch fields[0] {
+	case "/quit", "/q":
+		return nil, nil
+	case "/color":
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("usage: /color red|blue|green")
+		}
+		return &lobby.WsPayload{Action: lobby.ChooseColorPayloadEvent, Message: fields[1]}, nil
+	case "/ready":
+		return &lobby.WsPayload{Action: lobby.SetReadyStatusPayloadEvent, Message: "ready"}, nil
+	case "/mute", "/unmute":
+		// display names can contain spaces so everything after the command is
+		// the name
+		target := strings.TrimSpace(strings.TrimPrefix(line, fields[0]))
+		if target == "" {
+			return nil, fmt.Errorf("usage: %v <name>", fields[0])
+		}
+		action := lobby.PayloadEvent(lobby.MutePayloadEvent)
+		if fields[0] == "/unmute" {
+			action = lobby.UnmutePayloadEvent
+		}
+		return &lobby.WsPayload{Action: action, Message: target}, nil
+	case "/name":
+		name := strings.TrimSpace(strings.TrimPrefix(line, fields[0]))
+		if name == "" {
+			return nil, fmt.Errorf("usage: /name <new name>")
+		}
+		return &lobby.WsPayload{Action: lobby.ChangeNamePayloadEvent, Message: name}, nil
+	case "/play":
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("usage: /play <card> <x> <y>")
+		}
+		return &lobby.WsPayload{Action: lobby.PlayCardPayloadEvent, Message: strings.Join(fields[1:], ":")}, nil
+	default:
+		return nil, fmt.Errorf("unknown command %v, try /color, /ready, /play, /name, /mute, /unmute or /quit", fields[0])
+	}
+}
+
+// apiClient drives the same http endpoints the browser uses
+type apiClient struct {
+	base     *url.URL
+	playerID string
+	username string
+	session  string
+	http     *http.Client
+}
+
+func newAPIClient(base *url.URL) *apiClient {
+	return &apiClient{
+		base: base,
+		http: &http.Client{
+			// the server answers htmx requests with HX-Redirect headers, we
+			// want to read those instead of following regular redirects
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// the session cookie is marked secure so a cookie jar would drop it on plain
+// http, it is attached by hand instead
+func (a *apiClient) do(req *http.Request) (*http.Response, error) {
+	if a.session != "" {
+		req.AddCookie(&http.Cookie{Name: "session", Value: a.session})
+	}
+	return a.http.Do(req)
+}
+
+// startSession picks the display name, or generates one when name is empty,
+// which also gives us a session
+func (a *apiClient) startSession(name string) error {
+	var req *http.Request
+	var err error
+	if name == "" {
+		req, err = http.NewRequest(http.MethodGet, a.base.JoinPath("/lobby/generate_username").String(), nil)
+	} else {
+		form := url.Values{}
+		form.Set("display_name", name)
+		req, err = http.NewRequest(http.MethodPost, a.base.JoinPath("/lobby/display-name").String(), strings.NewReader(form.Encode()))
+	}
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := a.do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	for _, c := range res.Cookies() {
+		if c.Name == "session" {
+			a.session = c.Value
+		}
+	}
+	a.playerID = res.Header.Get("X-Player-Id")
+	a.username = res.Header.Get("X-Username")
+
+	if a.session == "" || a.playerID == "" {
+		// the form comes back with the validation error when the name is rejected
+		if name != "" {
+			return fmt.Errorf("%v", toastText(res))
+		}
+		return fmt.Errorf("server did not start a session")
+	}
+	return nil
+}
+
+func (a *apiClient) createLobby(players, handSize int, private bool, password string) (string, error) {
+	form := url.Values{}
+	form.Set("num_of_players", fmt.Sprint(players))
+	form.Set("max_hand_size", fmt.Sprint(handSize))
+	form.Set("visibility", "public")
+	if private {
+		form.Set("visibility", "private")
+	}
+	form.Set("password", password)
+
+	return a.postForHXRedirect("/lobby/create", form)
+}
+
+func (a *apiClient) quickMatch(players int) (string, error) {
+	form := url.Values{}
+	form.Set("num_of_players", fmt.Sprint(players))
+
+	return a.postForHXRedirect("/lobby/quick-match", form)
+}
+
+func (a *apiClient) joinLobby(lobbyID, password, invite string) error {
+	form := url.Values{}
+	form.Set("lobby-id", lobbyID)
+	form.Set("password", password)
+	form.Set("invite", invite)
+
+	_, err := a.postForHXRedirect("/lobby/join", form)
+	return err
+}
+
+// postForHXRedirect posts a form and returns the lobby id from the HX-Redirect
+// header, the toast sent back on failure is turned into the error
+func (a *apiClient) postForHXRedirect(path string, form url.Values) (string, error) {
+	req, err := http.NewRequest(http.MethodPost, a.base.JoinPath(path).String(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := a.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	redirect := res.Header.Get("HX-Redirect")
+	if !strings.HasPrefix(redirect, "/lobby/") {
+		return "", fmt.Errorf("%v", toastText(res))
+	}
+
+	return strings.TrimPrefix(redirect, "/lobby/"), nil
+}
+
+func (a *apiClient) dial(lobbyID, invite string) (*websocket.Conn, error) {
+	u := *a.base
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	default:
+		u.Scheme = "ws"
+	}
+	u.Path = "/lobby/ws"
+	q := u.Query()
+	q.Set("lobby-id", lobbyID)
+	if invite != "" {
+		q.Set("invite", invite)
+	}
+	u.RawQuery = q.Encode()
+
+	dialer := websocket.Dialer{Subprotocols: []string{lobby.ProtocolJSONV1}}
+
+	header := http.Header{}
+	header.Set("Cookie", (&http.Cookie{Name: "session", Value: a.session}).String())
+
+	conn, _, err := dialer.Dial(u.String(), header)
+	if err != nil {
+		return nil, err
+	}
+
+	if conn.Subprotocol() != lobby.ProtocolJSONV1 {
+		conn.Close()
+		return nil, fmt.Errorf("server does not speak %v", lobby.ProtocolJSONV1)
+	}
+
+	return conn, nil
+}
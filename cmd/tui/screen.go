@@ -0,0 +1,314 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spacesedan/go-sequence/internal"
+	"github.com/spacesedan/go-sequence/internal/game"
+	"github.com/spacesedan/go-sequence/internal/lobby"
+)
+
+// number of chat lines kept on screen
+const chatLines = 8
+
+const (
+	ansiClear = "\033[H\033[2J"
+	ansiReset = "\033[0m"
+	ansiBold  = "\033[1m"
+	ansiDim   = "\033[2m"
+)
+
+// chipColors background colors used to draw chips on the board
+var chipColors = map[string]string{
+	"red":   "\033[41m",
+	"blue":  "\033[44m",
+	"green": "\033[42m",
+	"Any":   "\033[43m",
+}
+
+// textColors foreground colors used for player names
+var textColors = map[string]string{
+	"red":   "\033[31m",
+	"blue":  "\033[34m",
+	"green": "\033[32m",
+}
+
+// event mirrors lobby.Event but keeps the data raw until the type is known
+type event struct {
+	Version string          `json:"version"`
+	Type    lobby.EventType `json:"type"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// screen holds everything the client knows about the lobby and draws it
+type screen struct {
+	mu sync.Mutex
+	w  io.Writer
+
+	playerID string
+	username string
+	lobbyID  string
+	// players are keyed by player id
+	players map[string]*internal.Player
+	board   [game.BoardSize][game.BoardSize]*lobby.CellData
+	hand    []game.Card
+	// turn is the id of the player that plays next
+	turn   string
+	chat   []string
+	status string
+}
+
+func newScreen(w io.Writer, playerID, username, lobbyID string) *screen {
+	return &screen{
+		w:        w,
+		playerID: playerID,
+		username: username,
+		lobbyID:  lobbyID,
+		players:  make(map[string]*internal.Player),
+	}
+}
+
+func (s *screen) setStatus(msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = msg
+}
+
+// apply updates the screen state using an event from the server
+func (s *screen) apply(e event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch e.Type {
+	case lobby.RosterEvent:
+		var d lobby.RosterData
+		if err := json.Unmarshal(e.Data, &d); err != nil {
+			return err
+		}
+		s.players = make(map[string]*internal.Player)
+		for _, p := range d.Players {
+			s.players[p.ID] = p
+		}
+	case lobby.PlayerUpdatedEvent:
+		var d lobby.PlayerData
+		if err := json.Unmarshal(e.Data, &d); err != nil {
+			return err
+		}
+		if d.Player != nil {
+			s.players[d.Player.ID] = d.Player
+		}
+	case lobby.PlayerStatusEvent:
+		var d lobby.StatusData
+		if err := json.Unmarshal(e.Data, &d); err != nil {
+			return err
+		}
+		s.addChat(ansiDim + d.Message + ansiReset)
+	case lobby.ChatEvent:
+		var d lobby.ChatData
+		if err := json.Unmarshal(e.Data, &d); err != nil {
+			return err
+		}
+		s.addChat(s.chatLine(d))
+	case lobby.ChatHistoryEvent:
+		var d lobby.ChatHistoryData
+		if err := json.Unmarshal(e.Data, &d); err != nil {
+			return err
+		}
+		for _, m := range d.Messages {
+			s.addChat(s.chatLine(m))
+		}
+	case lobby.BoardEvent:
+		var d lobby.BoardData
+		if err := json.Unmarshal(e.Data, &d); err != nil {
+			return err
+		}
+		if d.Full {
+			s.board = [game.BoardSize][game.BoardSize]*lobby.CellData{}
+		}
+		for i := range d.Cells {
+			c := d.Cells[i]
+			if c.X < 0 || c.X >= game.BoardSize || c.Y < 0 || c.Y >= game.BoardSize {
+				continue
+			}
+			s.board[c.X][c.Y] = &c
+		}
+	case lobby.HandEvent:
+		var d lobby.HandData
+		if err := json.Unmarshal(e.Data, &d); err != nil {
+			return err
+		}
+		s.hand = d.Cards
+	case lobby.TurnEvent:
+		var d lobby.TurnData
+		if err := json.Unmarshal(e.Data, &d); err != nil {
+			return err
+		}
+		s.turn = d.PlayerID
+	case lobby.GameOverEvent:
+		var d lobby.GameOverData
+		if err := json.Unmarshal(e.Data, &d); err != nil {
+			return err
+		}
+		s.turn = ""
+		s.hand = nil
+		s.status = d.Message
+	case lobby.ToastEvent:
+		var d lobby.ToastData
+		if err := json.Unmarshal(e.Data, &d); err != nil {
+			return err
+		}
+		s.status = fmt.Sprintf("%v: %v", d.Title, d.Content)
+	}
+
+	return nil
+}
+
+func (s *screen) addChat(line string) {
+	s.chat = append(s.chat, line)
+	if len(s.chat) > chatLines {
+		s.chat = s.chat[len(s.chat)-chatLines:]
+	}
+}
+
+func (s *screen) chatLine(m lobby.ChatData) string {
+	return fmt.Sprintf("%v%v%v %v: %v", ansiDim, m.SentAt.Local().Format(time.Kitchen), ansiReset, s.playerName(m.SenderID, m.Sender), m.Message)
+}
+
+// playerName returns the display name of a player colored with their chip
+// color, fallback is used for players that are no longer in the lobby
+func (s *screen) playerName(playerID, fallback string) string {
+	p, ok := s.players[playerID]
+	if !ok {
+		return fallback
+	}
+	if c, ok := textColors[p.Color]; ok {
+		return c + p.Username + ansiReset
+	}
+	return p.Username
+}
+
+func (s *screen) render() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var b strings.Builder
+
+	b.WriteString(ansiClear)
+	fmt.Fprintf(&b, "%vlobby %v%v   you are %v\n\n", ansiBold, s.lobbyID, ansiReset, s.playerName(s.playerID, s.username))
+
+	s.drawBoard(&b)
+	s.drawHand(&b)
+	if s.turn == s.playerID {
+		fmt.Fprintf(&b, "\n%vyour turn%v\n", ansiBold, ansiReset)
+	} else if s.turn != "" {
+		fmt.Fprintf(&b, "\n%v is playing\n", s.playerName(s.turn, "someone"))
+	}
+	s.drawPlayers(&b)
+
+	b.WriteString("\nchat\n")
+	for _, line := range s.chat {
+		fmt.Fprintf(&b, "  %v\n", line)
+	}
+
+	if s.status != "" {
+		fmt.Fprintf(&b, "\n%v%v%v\n", ansiBold, s.status, ansiReset)
+	}
+
+	b.WriteString("\n/color red|blue|green  /ready  /play <card> <x> <y>  /mute  /unmute  /quit  anything else is chat\n> ")
+
+	io.WriteString(s.w, b.String())
+}
+
+func (s *screen) drawBoard(b *strings.Builder) {
+	if s.board[0][0] == nil {
+		b.WriteString(ansiDim + "waiting for the game to start" + ansiReset + "\n")
+		return
+	}
+
+	// rows are X and columns are Y, the same way the browser lays it out
+	b.WriteString("    ")
+	for y := 0; y < game.BoardSize; y++ {
+		fmt.Fprintf(b, " %-3d", y)
+	}
+	b.WriteString("\n")
+
+	for x := 0; x < game.BoardSize; x++ {
+		fmt.Fprintf(b, " %-2d ", x)
+		for y := 0; y < game.BoardSize; y++ {
+			c := s.board[x][y]
+			if c == nil {
+				b.WriteString("    ")
+				continue
+			}
+
+			label := cardLabel(c.Type, c.Suit)
+			if c.IsCorner {
+				label = "**"
+			}
+
+			if bg, ok := chipColors[c.ChipColor]; ok && c.ChipPlaced {
+				fmt.Fprintf(b, " %v%-3s%v", bg, label, ansiReset)
+			} else {
+				fmt.Fprintf(b, " %-3s", label)
+			}
+		}
+		b.WriteString("\n")
+	}
+}
+
+func (s *screen) drawHand(b *strings.Builder) {
+	if len(s.hand) == 0 {
+		return
+	}
+
+	b.WriteString("\nhand ")
+	for i, c := range s.hand {
+		fmt.Fprintf(b, " [%d]%v", i, cardLabel(c.Type, c.Suit))
+	}
+	b.WriteString("\n")
+}
+
+func (s *screen) drawPlayers(b *strings.Builder) {
+	b.WriteString("\nplayers\n")
+	for id, p := range s.players {
+		ready := "not ready"
+		if p.Ready {
+			ready = "ready"
+		}
+		fmt.Fprintf(b, "  %v (%v)\n", s.playerName(id, p.Username), ready)
+	}
+}
+
+var cardTypes = map[string]string{
+	"Two": "2", "Three": "3", "Four": "4", "Five": "5", "Six": "6",
+	"Seven": "7", "Eight": "8", "Nine": "9", "Ten": "10",
+	"Jack": "J", "Queen": "Q", "King": "K", "Ace": "A",
+}
+
+var cardSuits = map[string]string{
+	"Spade": "♠", "Heart": "♥", "Club": "♣", "Diamond": "♦",
+}
+
+// cardLabel returns a short label like 10♥
+func cardLabel(t, suit string) string {
+	return cardTypes[t] + cardSuits[suit]
+}
+
+var tags = regexp.MustCompile(`<[^>]*>`)
+
+// toastText pulls the readable text out of a toast fragment
+func toastText(res *http.Response) string {
+	body, err := io.ReadAll(res.Body)
+	if err != nil || len(body) == 0 {
+		return res.Status
+	}
+
+	return strings.Join(strings.Fields(tags.ReplaceAllString(string(body), " ")), " ")
+}
@@ -0,0 +1,11 @@
+package internal
+
+import "time"
+
+// ChatMessage a single message sent to the lobby chat
+type ChatMessage struct {
+	SenderID string    `json:"sender_id"`
+	Sender   string    `json:"sender"`
+	Message  string    `json:"message"`
+	SentAt   time.Time `json:"sent_at"`
+}
@@ -7,11 +7,18 @@ import (
 	"net/url"
 	"time"
 
-	"github.com/go-redis/redis/v8"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
 	"github.com/spacesedan/go-sequence/internal"
 	"github.com/spacesedan/go-sequence/internal/db"
 	"github.com/spacesedan/go-sequence/internal/lobby"
+	"github.com/spacesedan/go-sequence/internal/metrics"
+	"github.com/spacesedan/go-sequence/internal/pubsub"
+	"github.com/spacesedan/go-sequence/internal/ratelimit"
+	"github.com/spacesedan/go-sequence/internal/services"
+	"github.com/spacesedan/go-sequence/internal/tracing"
 )
 
 const (
@@ -23,67 +30,75 @@ const (
 
 	// Send pings to peer with this period. Must be less than pongWait.
 	pingPeriod = (pongWait * 9) / 10
+
+	// Maximum message size allowed from peer when the limits don't set one.
+	maxMessageSize = 4096
 )
 
+// Limits are what a connection is allowed to send
+type Limits struct {
+	// MaxMessageSize is the largest message, larger messages close the
+	// connection
+	MaxMessageSize int64
+	// Messages limits the messages of the player and of their address
+	Messages *ratelimit.Limiter
+	// RemoteIP is the address the player connected from
+	RemoteIP string
+}
+
 type WsClient struct {
-	Conn     *websocket.Conn
+	Conn *websocket.Conn
+	// PlayerID identifies the player, Username is the display name they asked
+	// for which the lobby may change to keep names unique
+	PlayerID string
 	Username string
 	LobbyID  string
+	// Protocol is the subprotocol negotiated during the upgrade, empty for
+	// browsers that expect htmx fragments
+	Protocol string
 
 	Color   string
 	IsReady bool
 
 	playerState *internal.Player
 	clientRepo  db.ClientRepo
-	redisClient *redis.Client
+	ps          pubsub.PubSub
 	logger      *slog.Logger
 	errorChan   chan error
+	limits      Limits
+	// rejected holds the messages the read pump turned away, the rejection
+	// is written by the subscriber which owns the writes to the connection
+	rejected chan lobby.WsResponse
+	// subscribed is closed once the client listens to the lobby responses,
+	// the player only registers after that so they don't miss their join
+	subscribed chan struct{}
+	// delivering is the response being handled, the time it took to reach
+	// the player is observed on its first write
+	delivering *lobby.WsResponse
 }
 
-type PublishChannel uint
-
-const (
-	UnknownChannel PublishChannel = iota
-	StateChannel
-	PayloadChannel
-	PingChannel
-	RegisterChannel
-	UnregisterChannel
-)
-
-func (p PublishChannel) String() string {
-	switch p {
-	case PayloadChannel:
-		return "payloadChannel"
-	case RegisterChannel:
-		return "registerChannel"
-	case UnregisterChannel:
-		return "unregisterChannel"
-	case UnknownChannel:
-		return "unknown"
-	case PingChannel:
-		return "pingChannel"
-	case StateChannel:
-		return "stateChannel"
-	default:
-		return "unknown"
+func NewWsClient(ws *websocket.Conn, repo db.ClientRepo, ps pubsub.PubSub, logger *slog.Logger, playerID, username, lobbyId string, limits Limits) *WsClient {
+	if limits.MaxMessageSize <= 0 {
+		limits.MaxMessageSize = maxMessageSize
 	}
-}
-
-func NewWsClient(ws *websocket.Conn, r *redis.Client, logger *slog.Logger, username, lobbyId string) *WsClient {
 
 	// how should i get the redis client
 	// passed it to the redis client to the lobbyHandler.
 	return &WsClient{
 		Conn:     ws,
+		PlayerID: playerID,
 		Username: username,
 		LobbyID:  lobbyId,
+		Protocol: ws.Subprotocol(),
 
 		playerState: &internal.Player{},
-		clientRepo:  db.NewClientRepo(r, logger),
-		redisClient: r,
+		clientRepo:  repo,
+		ps:          ps,
 		logger:      logger,
 		errorChan:   make(chan error, 1),
+		limits:      limits,
+		rejected:    make(chan lobby.WsResponse, 1),
+		subscribed:  make(chan struct{}),
 	}
 }
 
@@ -96,30 +111,37 @@ func (s *WsClient) ReadPump() {
 
 	var payload lobby.WsPayload
 
+	metrics.WsClients.Inc()
 	defer func() {
+		metrics.WsClients.Dec()
 		s.logger.Info("wsClient.ReadPump",
 			slog.Group("Read Pump closing",
 				slog.String("username", s.Username)))
 
 		// unregister the connection when the ws connection closes
-		s.publishToLobby(UnregisterChannel, lobby.WsPayload{
+		s.publishToLobby(pubsub.UnregisterChannel, lobby.WsPayload{
 			Action:   "unregister",
+			PlayerID: s.PlayerID,
 			Username: s.Username,
 		})
 		s.Conn.Close()
 
 	}()
 
+	s.Conn.SetReadLimit(s.limits.MaxMessageSize)
 	s.Conn.SetReadDeadline(time.Now().Add(pongWait))
 	s.Conn.SetPongHandler(func(string) error { s.Conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
 
 	// register the session to the lobby
-	s.publishToLobby(RegisterChannel, lobby.WsPayload{
+	<-s.subscribed
+	s.publishToLobby(pubsub.RegisterChannel, lobby.WsPayload{
 		Action:   "register",
+		PlayerID: s.PlayerID,
 		Username: s.Username,
 	})
 
 	for {
+		payload = lobby.WsPayload{}
 		err := s.Conn.ReadJSON(&payload)
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
@@ -130,9 +152,19 @@ func (s *WsClient) ReadPump() {
 			return
 		}
 
+		if !s.limits.Messages.Allow(s.PlayerID, s.limits.RemoteIP, time.Now()) {
+			metrics.RateLimited.WithLabelValues("ws_message").Inc()
+			s.reject(lobby.WsResponse{
+				Code:    services.ErrorCodeRateLimited,
+				Message: "You're sending messages too fast; that one was dropped",
+			})
+			continue
+		}
+
+		payload.PlayerID = s.PlayerID
 		payload.Username = s.Username
 
-		if err := s.publishToLobby(PayloadChannel, payload); err != nil {
+		if err := s.publishToLobby(pubsub.PayloadChannel, payload); err != nil {
 			s.logger.Error("wsClient.ReadPump",
 				slog.Group("error publishing to lobby",
 					slog.String("lobby_id", s.LobbyID),
@@ -150,9 +182,10 @@ func (s *WsClient) SubscribeToLobby() {
 			slog.String("lobby_id", s.LobbyID),
 			slog.String("username", s.Username)))
 
-	responseChannel := fmt.Sprintf("lobby.%v.responseChannel", s.LobbyID)
+	responseChannel := pubsub.LobbyTopic(s.LobbyID, pubsub.ResponseChannel)
 	ctx, cancel := context.WithCancel(context.Background())
-	sub := s.redisClient.Subscribe(ctx, responseChannel)
+	sub := s.ps.Subscribe(ctx, responseChannel)
+	close(s.subscribed)
 	ch := sub.Channel()
 	ticker := time.NewTicker(time.Minute)
 
@@ -177,7 +210,15 @@ func (s *WsClient) SubscribeToLobby() {
 				return
 			}
 
-			switch msg.Channel {
+			var closed bool
+			s.delivering = &response
+			_, span := tracing.Start(tracing.Extract(ctx, response.Trace), "wsClient."+string(response.Action),
+				trace.WithSpanKind(trace.SpanKindConsumer),
+				trace.WithAttributes(
+					attribute.String("lobby.id", s.LobbyID),
+					attribute.String("player.id", s.PlayerID)))
+
+			switch msg.Topic {
 			case responseChannel:
 				switch response.Action {
 				case lobby.JoinLobbyPayloadEvent:
@@ -190,12 +231,50 @@ func (s *WsClient) SubscribeToLobby() {
 					s.handleChooseColor(response)
 				case lobby.SetReadyStatusResponseEvent:
 					s.handlePlayerReady(response)
+				case lobby.ChatHistoryResponseEvent:
+					s.handleChatHistory(response)
+				case lobby.ChatRejectedResponseEvent:
+					s.handleChatRejected(response)
+				case lobby.PlayerMutedResponseEvent, lobby.PlayerUnmutedResponseEvent, lobby.RematchVoteResponseEvent:
+					s.handleLobbyNotice(response)
+				case lobby.PlayerRenamedResponseEvent:
+					s.handlePlayerRenamed(response)
+				case lobby.NameRejectedResponseEvent:
+					s.handleNameRejected(response)
+				case lobby.ReadyRejectedResponseEvent:
+					s.handleReadyRejected(response)
+				case lobby.ColorRejectedResponseEvent:
+					s.handleColorRejected(response)
+				case lobby.MoveResponseEvent:
+					s.handleMove(response)
+				case lobby.MoveRejectedResponseEvent:
+					s.handleMoveRejected(response)
+				case lobby.GameOverResponseEvent:
+					s.handleGameOver(response)
+				case lobby.LobbyClosedResponseEvent:
+					s.sendToast("Lobby closed", response.Message)
+					closed = true
+				case lobby.LeftResponseEvent:
+					closed = s.handlePlayerRemoved("Left the lobby", response)
+				case lobby.PlayerKickedResponseEvent:
+					closed = s.handlePlayerRemoved("Removed from the lobby", response)
 				}
 			}
+			span.End()
+
+			if closed {
+				s.Conn.WriteMessage(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseNormalClosure, response.Message))
+				s.Conn.Close()
+				return
+			}
 
 		case <-s.errorChan:
 			return
 
+		case r := <-s.rejected:
+			s.sendError(r.Code.Title(), r)
+
 		case <-ticker.C:
 			err := sub.Ping(ctx)
 			if err != nil {
@@ -205,18 +284,31 @@ func (s *WsClient) SubscribeToLobby() {
 	}
 }
 
+// reject tells the player a message was turned away, rejections are dropped
+// while one is still waiting to be written
+func (s *WsClient) reject(r lobby.WsResponse) {
+	select {
+	case s.rejected <- r:
+	default:
+	}
+}
+
 // PublishPayloadToLobby sends a payload to the lobby
-func (s *WsClient) publishToLobby(channel PublishChannel, payload lobby.WsPayload) error {
+func (s *WsClient) publishToLobby(channel pubsub.LobbyChannel, payload lobby.WsPayload) (err error) {
 	s.logger.Info("wsClient.PublishPayloadToLobby",
 		slog.Group("sending payload"))
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer func() {
-		cancel()
-	}()
-
-	chanKey := fmt.Sprintf("lobby.%v.%v", s.LobbyID, channel.String())
-
+	// every payload starts a trace that follows it through the lobby and
+	// back to the players
+	ctx, span := tracing.Start(context.Background(), "wsClient.publishToLobby",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("lobby.id", s.LobbyID),
+			attribute.String("lobby.channel", string(channel)),
+			attribute.String("player.id", s.PlayerID)))
+	defer func() { tracing.End(span, err) }()
+
+	payload.Trace = tracing.Inject(ctx)
 	pb, err := payload.MarshalBinary()
 	if err != nil {
 		s.logger.Error("wsClient.PublishPayloadToLobby",
@@ -226,7 +318,7 @@ func (s *WsClient) publishToLobby(channel PublishChannel, payload lobby.WsPayloa
 		return err
 	}
 
-	err = s.redisClient.Publish(ctx, chanKey, pb).Err()
+	err = s.ps.Publish(ctx, pubsub.LobbyTopic(s.LobbyID, channel), pb)
 	if err != nil {
 		s.logger.Error("wsClient.PublishToLobby",
 			slog.Group("error trying to publish",
@@ -239,7 +331,7 @@ func (s *WsClient) publishToLobby(channel PublishChannel, payload lobby.WsPayloa
 
 // setColor sets the Player color
 func (s *WsClient) setColor(response lobby.WsResponse) {
-	if response.Sender == s.Username {
+	if response.Sender == s.PlayerID {
 		s.Color = response.Message
 	}
 
@@ -247,7 +339,7 @@ func (s *WsClient) setColor(response lobby.WsResponse) {
 
 // updateColor updates the player color and resets the previous color
 func (s *WsClient) updateColor(response lobby.WsResponse) {
-	if response.Sender == s.Username {
+	if response.Sender == s.PlayerID {
 		if response.Message != s.Color {
 			s.Color = response.Message
 		}
@@ -256,6 +348,8 @@ func (s *WsClient) updateColor(response lobby.WsResponse) {
 
 // sendResonse sends the response to the client
 func (s *WsClient) sendResponse(msg string) error {
+	s.observeDelivery()
+
 	w, err := s.Conn.NextWriter(websocket.TextMessage)
 	if err != nil {
 		return err
@@ -273,6 +367,31 @@ func (s *WsClient) sendResponse(msg string) error {
 
 }
 
+// wantsJSON reports whether the client negotiated the JSON protocol
+func (s *WsClient) wantsJSON() bool {
+	return s.Protocol == lobby.ProtocolJSONV1
+}
+
+// sendEvent sends a typed JSON event to the client
+func (s *WsClient) sendEvent(t lobby.EventType, data any) error {
+	s.observeDelivery()
+
+	s.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return s.Conn.WriteJSON(lobby.NewEvent(t, data))
+}
+
+// observeDelivery records how long the response being handled took to reach
+// the player
+func (s *WsClient) observeDelivery() {
+	r := s.delivering
+	if r == nil || r.PublishedAt.IsZero() {
+		return
+	}
+	s.delivering = nil
+
+	metrics.ResponseDelivery.WithLabelValues(string(r.Action)).Observe(time.Since(r.PublishedAt).Seconds())
+}
+
 // generateUserAvatar creates a link that will be used by the clinet to fetch a
 // avatar image for the the current user
 func generateUserAvatar(username string, size int) string {
@@ -292,16 +411,3 @@ func generateUserAvatar(username string, size int) string {
 
 	return u.String()
 }
-
-func createWebsocketConnectionString(lobbyId string) string {
-	u := url.URL{
-		Scheme: "ws",
-		Host:   "localhost:42069",
-		Path:   "/lobby/ws",
-	}
-	q := u.Query()
-	q.Set("lobby-id", lobbyId)
-	u.RawQuery = q.Encode()
-
-	return u.String()
-}
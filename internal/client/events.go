@@ -0,0 +1,142 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spacesedan/go-sequence/internal/game"
+	"github.com/spacesedan/go-sequence/internal/lobby"
+)
+
+// JSON counterparts of the html handlers, used when the client negotiated
+// lobby.ProtocolJSONV1
+
+func (c *WsClient) handleJoinLobbyJSON(r lobby.WsResponse) {
+	if r.Sender != c.PlayerID {
+		if err := c.sendEvent(lobby.PlayerStatusEvent, lobby.StatusData{Message: r.Message}); err != nil {
+			c.errorChan <- err
+			return
+		}
+	}
+
+	players, err := c.clientRepo.GetMPlayers(c.LobbyID, r.ConnectedUsers)
+	if err != nil {
+		c.errorChan <- err
+		return
+	}
+
+	if err := c.sendEvent(lobby.RosterEvent, lobby.RosterData{
+		LobbyID: c.LobbyID,
+		Players: players,
+	}); err != nil {
+		c.errorChan <- err
+	}
+}
+
+func (c *WsClient) handleJoinGameJSON(r lobby.WsResponse) {
+	ls, err := c.clientRepo.GetLobby(c.LobbyID)
+	if err != nil || ls.Board == nil {
+		c.errorChan <- fmt.Errorf("handleJoinGameJSON: missing board for lobby %v", c.LobbyID)
+		return
+	}
+
+	if err := c.sendEvent(lobby.BoardEvent, lobby.NewBoardData(*ls.Board)); err != nil {
+		c.errorChan <- err
+		return
+	}
+
+	c.sendHand()
+	c.sendTurn(ls.Turn)
+}
+
+func (c *WsClient) handleMoveJSON(r lobby.WsResponse) {
+	cells := make([]lobby.CellData, 0, len(r.Cells))
+	for _, cell := range r.Cells {
+		cells = append(cells, lobby.NewCellData(cell))
+	}
+
+	if err := c.sendEvent(lobby.BoardEvent, lobby.BoardData{Cells: cells}); err != nil {
+		c.errorChan <- err
+		return
+	}
+
+	c.sendEvent(lobby.PlayerStatusEvent, lobby.StatusData{Message: r.Message})
+
+	// the player whose turn begins may have been dealt cards too
+	if r.Sender == c.PlayerID || (r.Dealt && r.Turn == c.PlayerID) {
+		c.sendHand()
+	}
+
+	if r.Turn != "" {
+		c.sendTurn(r.Turn)
+	}
+}
+
+func (c *WsClient) handleGameOverJSON(r lobby.WsResponse) {
+	c.sendEvent(lobby.GameOverEvent, lobby.GameOverData{
+		WinnerColor: r.Winner,
+		Message:     r.Message,
+		Series:      r.Series,
+	})
+}
+
+func (c *WsClient) sendHand() {
+	ps, err := c.clientRepo.GetPlayer(c.LobbyID, c.PlayerID)
+	if err != nil {
+		return
+	}
+
+	hand := ps.Hand
+	if hand == nil {
+		hand = []game.Card{}
+	}
+	c.sendEvent(lobby.HandEvent, lobby.HandData{Cards: hand})
+}
+
+func (c *WsClient) sendTurn(playerID string) {
+	c.sendEvent(lobby.TurnEvent, lobby.TurnData{
+		PlayerID: playerID,
+		Username: c.playerName(playerID),
+	})
+}
+
+func (c *WsClient) handleChatMessageJSON(r lobby.WsResponse) {
+	for _, m := range r.ChatMessages {
+		if strings.TrimSpace(m.Message) == "" {
+			continue
+		}
+
+		if err := c.sendEvent(lobby.ChatEvent, lobby.NewChatData(m)); err != nil {
+			c.errorChan <- err
+			return
+		}
+	}
+}
+
+func (c *WsClient) handleChatHistoryJSON(r lobby.WsResponse) {
+	history := lobby.ChatHistoryData{Messages: make([]lobby.ChatData, 0, len(r.ChatMessages))}
+	for _, m := range r.ChatMessages {
+		history.Messages = append(history.Messages, lobby.NewChatData(m))
+	}
+
+	if err := c.sendEvent(lobby.ChatHistoryEvent, history); err != nil {
+		c.errorChan <- err
+	}
+}
+
+func (c *WsClient) handleChooseColorJSON(r lobby.WsResponse) {
+	c.sendPlayerUpdated(r.Sender)
+}
+
+func (c *WsClient) handlePlayerReadyJSON(r lobby.WsResponse) {
+	c.sendPlayerUpdated(r.Sender)
+}
+
+func (c *WsClient) sendPlayerUpdated(playerID string) {
+	sender, err := c.clientRepo.GetPlayer(c.LobbyID, playerID)
+	if err != nil {
+		return
+	}
+
+	c.sendEvent(lobby.PlayerUpdatedEvent, lobby.PlayerData{Player: sender})
+}
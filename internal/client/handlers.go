@@ -5,25 +5,43 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
-	"github.com/spacesedan/go-sequence/internal/game"
+	"github.com/spacesedan/go-sequence/internal"
 	"github.com/spacesedan/go-sequence/internal/lobby"
 	"github.com/spacesedan/go-sequence/internal/views"
 	"github.com/spacesedan/go-sequence/internal/views/components"
 )
 
 func (c *WsClient) handleJoinLobby(r lobby.WsResponse) {
+	if c.wantsJSON() {
+		c.handleJoinLobbyJSON(r)
+		return
+	}
+
 	var b bytes.Buffer
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	views.LobbyView(c.Username, c.LobbyID).Render(ctx, &b)
-	c.sendResponse(b.String())
+	// only the player that joined gets the whole view, everyone else keeps
+	// their chat and only gets the updated player list
+	if r.Sender == c.PlayerID {
+		var series *internal.Series
+		var settings internal.Settings
+		var finished bool
+		if ls, err := c.clientRepo.GetLobby(c.LobbyID); err == nil {
+			series, finished = ls.Series, ls.CurrentState == internal.Finished
+			settings = ls.Settings
+		}
 
-	b.Reset()
+		views.LobbyView(c.Username, c.LobbyID, series, settings, finished).Render(ctx, &b)
+		c.sendResponse(b.String())
 
-	if r.Sender != c.Username {
+		b.Reset()
+	}
+
+	if r.Sender != c.PlayerID {
 		components.PlayerStatus(r.Message).Render(ctx, &b)
 		if err := c.sendResponse(b.String()); err != nil {
 			fmt.Println("[ACTION] join_lobby", err.Error())
@@ -38,7 +56,6 @@ func (c *WsClient) handleJoinLobby(r lobby.WsResponse) {
 	}
 
 	components.PlayerDetails(players).Render(ctx, &b)
-	fmt.Printf("\n\n%v\n\n", b.String())
 	if err := c.sendResponse(b.String()); err != nil {
 		c.errorChan <- err
 	}
@@ -46,61 +63,311 @@ func (c *WsClient) handleJoinLobby(r lobby.WsResponse) {
 }
 
 func (c *WsClient) handleJoinGame(r lobby.WsResponse) {
+	// a player reconnecting mid game only needs to redraw their own view
+	if r.Sender != "" && r.Sender != c.PlayerID {
+		c.handleLobbyNotice(r)
+		return
+	}
+
+	if c.wantsJSON() {
+		c.handleJoinGameJSON(r)
+		return
+	}
+
 	var b bytes.Buffer
 
-    ps, err  := c.clientRepo.GetPlayer(c.LobbyID, c.Username)
-    if err != nil {
-        c.errorChan <- err
-    }
+	ps, err := c.clientRepo.GetPlayer(c.LobbyID, c.PlayerID)
+	if err != nil {
+		c.errorChan <- err
+		return
+	}
+
+	ls, err := c.clientRepo.GetLobby(c.LobbyID)
+	if err != nil || ls.Board == nil {
+		c.errorChan <- fmt.Errorf("handleJoinGame: missing board for lobby %v", c.LobbyID)
+		return
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-    gb, err := game.NewBoard()
-    if err != nil {
-        c.errorChan <- err
-    }
-	views.GameView(gb, ps.Color).Render(ctx, &b)
-    c.sendResponse(b.String())
+	views.GameView(*ls.Board, ps.Hand, ps.Color, c.playerName(ls.Turn), ls.Turn == c.PlayerID, ls.Series).Render(ctx, &b)
+	c.sendResponse(b.String())
+
+	b.Reset()
+}
+
+// playerName looks up the display name of a player in the lobby
+func (c *WsClient) playerName(playerID string) string {
+	if playerID == "" {
+		return ""
+	}
+
+	ps, err := c.clientRepo.GetPlayer(c.LobbyID, playerID)
+	if err != nil {
+		return playerID
+	}
+	return ps.Username
+}
+
+// handleMove redraws the cells changed by a move, the hand of the player that
+// made it and whose turn it is next
+func (c *WsClient) handleMove(r lobby.WsResponse) {
+	if c.wantsJSON() {
+		c.handleMoveJSON(r)
+		return
+	}
+
+	var b bytes.Buffer
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, cell := range r.Cells {
+		components.BoardCellUpdate(cell).Render(ctx, &b)
+	}
+
+	// the player whose turn begins may have been dealt cards too
+	if r.Sender == c.PlayerID || (r.Dealt && r.Turn == c.PlayerID) {
+		ps, err := c.clientRepo.GetPlayer(c.LobbyID, c.PlayerID)
+		if err == nil {
+			components.PlayerHandUpdate(ps.Hand).Render(ctx, &b)
+		}
+	}
+
+	if r.Turn != "" {
+		components.TurnStatusUpdate(c.playerName(r.Turn), r.Turn == c.PlayerID).Render(ctx, &b)
+	}
+
+	components.GameLogEntry(r.Message).Render(ctx, &b)
 
-    b.Reset()
+	if err := c.sendResponse(b.String()); err != nil {
+		c.errorChan <- err
+	}
+}
+
+// handleMoveRejected tells a player why their move was not played
+func (c *WsClient) handleMoveRejected(r lobby.WsResponse) {
+	if r.Sender != c.PlayerID {
+		return
+	}
+
+	c.sendError("Move not played", r)
+}
+
+// handleReadyRejected tells a player why they could not ready up
+func (c *WsClient) handleReadyRejected(r lobby.WsResponse) {
+	if r.Sender != c.PlayerID {
+		return
+	}
+
+	c.sendError("Not ready", r)
+}
+
+// handleColorRejected tells a player why they didn't get the color they chose
+func (c *WsClient) handleColorRejected(r lobby.WsResponse) {
+	if r.Sender != c.PlayerID {
+		return
+	}
+
+	c.sendError("Color not changed", r)
+}
+
+// handlePlayerRemoved tells the removed player why they are disconnected and
+// everyone else who was removed, it reports whether this client was removed
+func (c *WsClient) handlePlayerRemoved(title string, r lobby.WsResponse) bool {
+	if r.Sender != c.PlayerID {
+		c.handleLobbyNotice(r)
+		return false
+	}
+
+	c.sendToast(title, r.Message)
+	return true
+}
+
+// handleGameOver announces the winner and takes the players back to the lobby
+// where they can vote for a rematch
+func (c *WsClient) handleGameOver(r lobby.WsResponse) {
+	if c.wantsJSON() {
+		c.handleGameOverJSON(r)
+		return
+	}
+
+	c.sendToast("Game over", r.Message)
+
+	var b bytes.Buffer
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var settings internal.Settings
+	if ls, err := c.clientRepo.GetLobby(c.LobbyID); err == nil {
+		settings = ls.Settings
+	}
+
+	views.LobbyView(c.Username, c.LobbyID, r.Series, settings, true).Render(ctx, &b)
+	c.sendResponse(b.String())
+	b.Reset()
+
+	players, err := c.clientRepo.GetMPlayers(c.LobbyID, r.ConnectedUsers)
+	if err != nil {
+		c.errorChan <- err
+		return
+	}
+
+	components.PlayerDetails(players).Render(ctx, &b)
+	if err := c.sendResponse(b.String()); err != nil {
+		c.errorChan <- err
+	}
 }
 
 // handleChatMessage handles incoming chat messages and send the correct
 // component client based on the sender of the original message
 func (c *WsClient) handleChatMessage(r lobby.WsResponse) {
-	if strings.TrimSpace(r.Message) == "" {
+	if c.wantsJSON() {
+		c.handleChatMessageJSON(r)
+		return
+	}
+
+	for _, m := range r.ChatMessages {
+		if err := c.sendChatMessage(m); err != nil {
+			c.errorChan <- err
+			return
+		}
+	}
+}
+
+// handleChatHistory sends the stored chat messages to the player that just
+// joined
+func (c *WsClient) handleChatHistory(r lobby.WsResponse) {
+	if r.Sender != c.PlayerID {
 		return
 	}
 
+	if c.wantsJSON() {
+		c.handleChatHistoryJSON(r)
+		return
+	}
+
+	for _, m := range r.ChatMessages {
+		if err := c.sendChatMessage(m); err != nil {
+			c.errorChan <- err
+			return
+		}
+	}
+}
+
+func (c *WsClient) sendChatMessage(m *internal.ChatMessage) error {
+	if strings.TrimSpace(m.Message) == "" {
+		return nil
+	}
+
 	var b bytes.Buffer
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	alt := fmt.Sprintf("avatar image for %v", r.Sender)
+	alt := fmt.Sprintf("avatar image for %v", m.Sender)
+	sentAt := m.SentAt.Format(time.Kitchen)
 
-	if r.Sender == c.Username {
+	if m.SenderID == c.PlayerID {
 		components.ChatMessageSender(
-			r.Message,
+			m.Message,
+			sentAt,
 			alt,
-			generateUserAvatar(r.Sender, 32)).
+			generateUserAvatar(m.Sender, 32)).
 			Render(ctx, &b)
 	} else {
 		components.ChatMessageReciever(
-			r.Message,
+			m.Message,
+			sentAt,
 			alt,
-			generateUserAvatar(r.Sender, 32)).
+			generateUserAvatar(m.Sender, 32)).
 			Render(ctx, &b)
 	}
+
+	return c.sendResponse(b.String())
+}
+
+// handleChatRejected tells the sender why their message was not delivered
+func (c *WsClient) handleChatRejected(r lobby.WsResponse) {
+	if r.Sender != c.PlayerID {
+		return
+	}
+
+	c.sendError("Message not sent", r)
+}
+
+// handleNameRejected tells a player why their display name was not changed
+func (c *WsClient) handleNameRejected(r lobby.WsResponse) {
+	if r.Sender != c.PlayerID {
+		return
+	}
+
+	c.sendError("Name not changed", r)
+}
+
+// handlePlayerRenamed announces the new name and updates the player details
+func (c *WsClient) handlePlayerRenamed(r lobby.WsResponse) {
+	c.handleLobbyNotice(r)
+	c.handleChooseColor(r)
+}
+
+// handleLobbyNotice shows lobby wide notices like a player getting muted
+func (c *WsClient) handleLobbyNotice(r lobby.WsResponse) {
+	if c.wantsJSON() {
+		c.sendEvent(lobby.PlayerStatusEvent, lobby.StatusData{Message: r.Message})
+		return
+	}
+
+	var b bytes.Buffer
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	components.PlayerStatus(r.Message).Render(ctx, &b)
 	if err := c.sendResponse(b.String()); err != nil {
 		c.errorChan <- err
 	}
+}
 
-	b.Reset()
+// sendError tells a player why what they sent was rejected, JSON clients get
+// an error event carrying the code
+func (c *WsClient) sendError(title string, r lobby.WsResponse) {
+	if c.wantsJSON() {
+		c.sendEvent(lobby.ErrorEvent, lobby.ErrorData{
+			Code:    r.Code,
+			Title:   title,
+			Message: r.Message,
+		})
+		return
+	}
+
+	c.sendToast(title, r.Message)
+}
+
+// sendToast sends a toast to the client
+func (c *WsClient) sendToast(title, content string) {
+	if c.wantsJSON() {
+		c.sendEvent(lobby.ToastEvent, lobby.ToastData{Title: title, Content: content})
+		return
+	}
+
+	var b bytes.Buffer
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	components.ToastWSComponent(title, content).Render(ctx, &b)
+	c.sendResponse(b.String())
 }
 
 func (c *WsClient) handleChooseColor(r lobby.WsResponse) {
+	if c.wantsJSON() {
+		c.handleChooseColorJSON(r)
+		return
+	}
+
 	var b bytes.Buffer
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -125,32 +392,23 @@ func (c *WsClient) handleChooseColor(r lobby.WsResponse) {
 }
 
 func (c *WsClient) handlePlayerReady(r lobby.WsResponse) {
+	if c.wantsJSON() {
+		c.handlePlayerReadyJSON(r)
+		return
+	}
+
 	var b bytes.Buffer
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	if r.Sender == c.Username {
-		ps, err := c.clientRepo.GetPlayer(c.LobbyID, c.Username)
-		if err != nil {
-			c.errorChan <- err
-		}
-		if ps.Color == "" {
-			title := "Missing player color"
-			content := "can't ready up without selecting a color"
-			components.ToastWSComponent(title, content).Render(ctx, &b)
-			c.sendResponse(b.String())
-			b.Reset()
-		}
-	}
-
 	sender, err := c.clientRepo.GetPlayer(c.LobbyID, r.Sender)
 	if err != nil {
 		return
 	}
 
 	components.PlayerUpdateDetails(sender).
-		Render(context.Background(), &b)
+		Render(ctx, &b)
 
 	if err := c.sendResponse(b.String()); err != nil {
 		return
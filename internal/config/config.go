@@ -0,0 +1,505 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spacesedan/go-sequence/internal/db"
+	"github.com/spacesedan/go-sequence/internal/ratelimit"
+	"github.com/spacesedan/go-sequence/internal/services"
+)
+
+// EnvPrefix every setting can be set through an environment variable named
+// after its flag, -redis-addr is read from SEQUENCE_REDIS_ADDR
+const EnvPrefix = "SEQUENCE_"
+
+// Config everything the server binary can be configured with
+type Config struct {
+	// Address the server listens on
+	Address string
+	// BaseURL is the url players reach the server at, websocket urls are
+	// built from it
+	BaseURL string
+	// WebsocketScheme is ws or wss, when empty it follows the scheme of
+	// BaseURL
+	WebsocketScheme string
+
+	Backend db.Backend
+	Redis   Redis
+
+	DBPath           string
+	BlockedWordsPath string
+	InviteSecret     string
+	DevLobbies       bool
+	// AdminToken protects the admin area, the area is disabled when it is
+	// empty
+	AdminToken string
+
+	// SessionLifetime how long a player keeps their identity
+	SessionLifetime time.Duration
+	// InviteTTL how long an invite link stays valid
+	InviteTTL time.Duration
+	// ReconnectTTL how long a disconnected player keeps their seat
+	ReconnectTTL time.Duration
+	// LobbyIdle closes lobbies nobody plays in
+	LobbyIdle LobbyIdle
+
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	ShutdownTimeout time.Duration
+
+	LogLevel slog.Level
+	Tracing  Tracing
+	Limits   Limits
+
+	// AssetsDir is served under /static/ and BundleDir under /bundle/
+	AssetsDir string
+	BundleDir string
+}
+
+type Redis struct {
+	Addr     string
+	Username string
+	Password string
+	DB       int
+}
+
+// Limits protect the server from players flooding it, a rate of 0 is
+// unlimited
+type Limits struct {
+	CreateLobby ratelimit.Rule
+	JoinLobby   ratelimit.Rule
+	WsMessages  ratelimit.Rule
+	// MaxMessageSize is the largest websocket message a player can send
+	MaxMessageSize int64
+	// MaxLobbies caps the lobbies open on every replica together, 0 means no
+	// cap
+	MaxLobbies int
+	// AllowedOrigins may open websockets besides the origin of the server
+	// itself, * allows every origin
+	AllowedOrigins []string
+	// TrustProxy reads the address of players from X-Forwarded-For, only set
+	// it behind a proxy that overwrites the header
+	TrustProxy bool
+}
+
+// LobbyIdle is how long a lobby stays open without activity in each state of
+// its lifecycle, 0 keeps lobbies in that state open
+type LobbyIdle struct {
+	Created  time.Duration
+	Waiting  time.Duration
+	InGame   time.Duration
+	Finished time.Duration
+}
+
+// TraceExporter is where spans are sent
+type TraceExporter string
+
+const (
+	TraceExporterNone   TraceExporter = "none"
+	TraceExporterStdout TraceExporter = "stdout"
+	// TraceExporterOTLP sends spans to an otlp collector over http
+	TraceExporterOTLP TraceExporter = "otlp"
+)
+
+func (e TraceExporter) String() string {
+	return string(e)
+}
+
+// Set lets the exporter be picked with a flag
+func (e *TraceExporter) Set(s string) error {
+	switch TraceExporter(s) {
+	case TraceExporterNone, TraceExporterStdout, TraceExporterOTLP:
+		*e = TraceExporter(s)
+		return nil
+	}
+	return fmt.Errorf("unknown trace exporter %q, use none, stdout or otlp", s)
+}
+
+type Tracing struct {
+	Exporter TraceExporter
+	// Endpoint is the host:port of the otlp collector
+	Endpoint string
+	Insecure bool
+	// SampleRatio is the share of traces that are kept, from 0 to 1
+	SampleRatio float64
+}
+
+// Default is the configuration used for anything that isn't set
+func Default() Config {
+	return Config{
+		Address: ":42069",
+		BaseURL: "http://localhost:42069",
+		Backend: db.BackendRedis,
+		Redis: Redis{
+			Addr: "localhost:6379",
+		},
+		DBPath:          "sequence.db",
+		SessionLifetime: 365 * 24 * time.Hour,
+		InviteTTL:       24 * time.Hour,
+		ReconnectTTL:    30 * time.Second,
+		LobbyIdle: LobbyIdle{
+			Created:  5 * time.Minute,
+			Waiting:  30 * time.Minute,
+			InGame:   time.Hour,
+			Finished: 10 * time.Minute,
+		},
+		ReadTimeout:     time.Second,
+		WriteTimeout:    time.Second,
+		IdleTimeout:     time.Second,
+		ShutdownTimeout: 5 * time.Second,
+		LogLevel:        slog.LevelDebug,
+		Tracing: Tracing{
+			Exporter:    TraceExporterNone,
+			Endpoint:    "localhost:4318",
+			Insecure:    true,
+			SampleRatio: 1,
+		},
+		Limits: Limits{
+			CreateLobby: ratelimit.Rule{
+				Session: ratelimit.Rate{Burst: 5, Every: time.Minute},
+				IP:      ratelimit.Rate{Burst: 20, Every: time.Minute},
+			},
+			JoinLobby: ratelimit.Rule{
+				Session: ratelimit.Rate{Burst: 30, Every: time.Minute},
+				IP:      ratelimit.Rate{Burst: 120, Every: time.Minute},
+			},
+			WsMessages: ratelimit.Rule{
+				Session: ratelimit.Rate{Burst: 20, Every: time.Second},
+				IP:      ratelimit.Rate{Burst: 100, Every: time.Second},
+			},
+			MaxMessageSize: 4096,
+			MaxLobbies:     1000,
+		},
+		AssetsDir: "assets",
+		BundleDir: "dist",
+	}
+}
+
+// flags binds every setting of c to a flag of fs
+func (c *Config) flags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Address, "addr", c.Address, "address the server listens on")
+	fs.StringVar(&c.BaseURL, "base-url", c.BaseURL, "public url of the server, websocket urls are built from it")
+	fs.StringVar(&c.WebsocketScheme, "ws-scheme", c.WebsocketScheme, "ws or wss, follows the scheme of the base url when empty")
+
+	fs.Var(&c.Backend, "backend", "where lobbies, sessions and messages are kept, redis or memory for a single node without redis")
+	fs.StringVar(&c.Redis.Addr, "redis-addr", c.Redis.Addr, "address of the redis server")
+	fs.StringVar(&c.Redis.Username, "redis-username", c.Redis.Username, "redis acl username")
+	fs.StringVar(&c.Redis.Password, "redis-password", c.Redis.Password, "redis password")
+	fs.IntVar(&c.Redis.DB, "redis-db", c.Redis.DB, "redis database number")
+
+	fs.StringVar(&c.DBPath, "db", c.DBPath, "sqlite file that stores player profiles and match history")
+	fs.StringVar(&c.BlockedWordsPath, "blocked-words", c.BlockedWordsPath, "file with one word per line that gets masked in the lobby chat")
+	fs.StringVar(&c.InviteSecret, "invite-secret", c.InviteSecret, "secret used to sign invite links, required with the redis backend, random when empty")
+	fs.StringVar(&c.AdminToken, "admin-token", c.AdminToken, "token that unlocks the admin area, the area is disabled when empty")
+	fs.BoolVar(&c.DevLobbies, "dev-lobbies", c.DevLobbies, "create the ASDA and JKLK lobbies on startup, for local development only")
+
+	fs.DurationVar(&c.SessionLifetime, "session-ttl", c.SessionLifetime, "how long a player keeps their identity")
+	fs.DurationVar(&c.InviteTTL, "invite-ttl", c.InviteTTL, "how long an invite link stays valid")
+	fs.DurationVar(&c.ReconnectTTL, "reconnect-ttl", c.ReconnectTTL, "how long a disconnected player keeps their seat")
+	fs.DurationVar(&c.LobbyIdle.Created, "lobby-idle-created", c.LobbyIdle.Created, "how long a lobby nobody joined stays open, 0 keeps it open")
+	fs.DurationVar(&c.LobbyIdle.Waiting, "lobby-idle-waiting", c.LobbyIdle.Waiting, "how long a lobby waiting for its players to get ready stays open without activity")
+	fs.DurationVar(&c.LobbyIdle.InGame, "lobby-idle-game", c.LobbyIdle.InGame, "how long a game stays open without a move or message")
+	fs.DurationVar(&c.LobbyIdle.Finished, "lobby-idle-finished", c.LobbyIdle.Finished, "how long a lobby stays open after its game ended without activity")
+
+	fs.DurationVar(&c.ReadTimeout, "read-timeout", c.ReadTimeout, "http read timeout")
+	fs.DurationVar(&c.WriteTimeout, "write-timeout", c.WriteTimeout, "http write timeout")
+	fs.DurationVar(&c.IdleTimeout, "idle-timeout", c.IdleTimeout, "http keep alive timeout")
+	fs.DurationVar(&c.ShutdownTimeout, "shutdown-timeout", c.ShutdownTimeout, "how long to wait for requests to finish on shutdown")
+
+	fs.TextVar(&c.LogLevel, "log-level", c.LogLevel, "debug, info, warn or error")
+
+	fs.Var(&c.Tracing.Exporter, "trace-exporter", "where spans are sent, none, stdout or otlp")
+	fs.StringVar(&c.Tracing.Endpoint, "otlp-endpoint", c.Tracing.Endpoint, "host:port of the otlp http collector")
+	fs.BoolVar(&c.Tracing.Insecure, "otlp-insecure", c.Tracing.Insecure, "send spans to the collector without tls")
+	fs.Float64Var(&c.Tracing.SampleRatio, "trace-sample-ratio", c.Tracing.SampleRatio, "share of traces that are kept, from 0 to 1")
+
+	fs.Var(&c.Limits.CreateLobby.Session, "create-rate", "lobbies a player can create, written as burst/every like 5/1m, 0 is unlimited")
+	fs.Var(&c.Limits.CreateLobby.IP, "create-ip-rate", "lobbies an ip address can create")
+	fs.Var(&c.Limits.JoinLobby.Session, "join-rate", "lobbies a player can join")
+	fs.Var(&c.Limits.JoinLobby.IP, "join-ip-rate", "lobbies an ip address can join")
+	fs.Var(&c.Limits.WsMessages.Session, "ws-rate", "websocket messages a player can send")
+	fs.Var(&c.Limits.WsMessages.IP, "ws-ip-rate", "websocket messages an ip address can send")
+	fs.Int64Var(&c.Limits.MaxMessageSize, "ws-max-message", c.Limits.MaxMessageSize, "largest websocket message in bytes, larger messages close the connection")
+	fs.IntVar(&c.Limits.MaxLobbies, "max-lobbies", c.Limits.MaxLobbies, "lobbies open on every replica together, 0 is no cap")
+	fs.Func("allowed-origins", "comma separated origins allowed to open websockets besides the base url, * allows every origin", func(s string) error {
+		c.Limits.AllowedOrigins = nil
+		for _, origin := range strings.Split(s, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				c.Limits.AllowedOrigins = append(c.Limits.AllowedOrigins, origin)
+			}
+		}
+		return nil
+	})
+	fs.BoolVar(&c.Limits.TrustProxy, "trust-proxy", c.Limits.TrustProxy, "read player addresses from X-Forwarded-For")
+
+	fs.StringVar(&c.AssetsDir, "assets-dir", c.AssetsDir, "directory served under /static/")
+	fs.StringVar(&c.BundleDir, "bundle-dir", c.BundleDir, "directory with the frontend bundle served under /bundle/")
+}
+
+// Load reads the configuration from the command line arguments, the
+// environment and the file passed with -config. Flags win over environment
+// variables which win over the file.
+func Load(name string, args []string, getenv func(string) string) (Config, error) {
+	c := Default()
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	c.flags(fs)
+	path := fs.String("config", getenv(EnvPrefix+"CONFIG"), "file with one flag = value setting per line")
+
+	if err := fs.Parse(args); err != nil {
+		return Config{}, services.WrapErrorf(err, services.ErrorCodeInvalidArgument, "config.Load")
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	file := make(map[string]string)
+	if *path != "" {
+		var err error
+		if file, err = readFile(*path); err != nil {
+			return Config{}, services.WrapErrorf(err, services.ErrorCodeInvalidArgument, "config.Load")
+		}
+	}
+
+	var errs []error
+	fs.VisitAll(func(f *flag.Flag) {
+		if set[f.Name] || f.Name == "config" {
+			return
+		}
+
+		value, ok := file[f.Name]
+		if env := getenv(envName(f.Name)); env != "" {
+			value, ok = env, true
+		}
+		if !ok {
+			return
+		}
+
+		if err := fs.Set(f.Name, value); err != nil {
+			errs = append(errs, fmt.Errorf("%v: %w", f.Name, err))
+		}
+	})
+
+	for name := range file {
+		if fs.Lookup(name) == nil || name == "config" {
+			errs = append(errs, fmt.Errorf("%v: unknown setting in %v", name, *path))
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return Config{}, services.WrapErrorf(err, services.ErrorCodeInvalidArgument, "config.Load")
+	}
+
+	if err := c.Validate(); err != nil {
+		return Config{}, err
+	}
+
+	return c, nil
+}
+
+// envName returns the environment variable a flag is read from
+func envName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// readFile reads a config file, every line is a flag name and its value
+// separated by =, empty lines and lines starting with # are skipped
+func readFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	settings := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%v:%v: expected name = value", path, n)
+		}
+		settings[strings.TrimSpace(name)] = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+
+	return settings, scanner.Err()
+}
+
+// Validate checks every setting and reports all the invalid ones at once
+func (c Config) Validate() error {
+	var errs []error
+	invalid := func(format string, a ...any) {
+		errs = append(errs, fmt.Errorf(format, a...))
+	}
+
+	if _, _, err := net.SplitHostPort(c.Address); err != nil {
+		invalid("addr: %v", err)
+	}
+
+	if u, err := url.Parse(c.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		invalid("base-url: %q is not an http or https url", c.BaseURL)
+	}
+
+	switch c.WebsocketScheme {
+	case "", "ws", "wss":
+	default:
+		invalid("ws-scheme: %q is not ws or wss", c.WebsocketScheme)
+	}
+
+	if !c.Backend.Valid() {
+		invalid("backend: unknown backend %q", c.Backend)
+	}
+	if c.Backend == db.BackendRedis {
+		if _, _, err := net.SplitHostPort(c.Redis.Addr); err != nil {
+			invalid("redis-addr: %v", err)
+		}
+		// every replica has to accept the invites the others signed
+		if c.InviteSecret == "" {
+			invalid("invite-secret: required with the redis backend")
+		}
+	}
+	if c.Redis.DB < 0 {
+		invalid("redis-db: must not be negative")
+	}
+
+	if c.DBPath == "" {
+		invalid("db: must not be empty")
+	}
+	if c.BlockedWordsPath != "" {
+		if _, err := os.Stat(c.BlockedWordsPath); err != nil {
+			invalid("blocked-words: %v", err)
+		}
+	}
+
+	switch c.Tracing.Exporter {
+	case TraceExporterNone, TraceExporterStdout:
+	case TraceExporterOTLP:
+		if _, _, err := net.SplitHostPort(c.Tracing.Endpoint); err != nil {
+			invalid("otlp-endpoint: %v", err)
+		}
+	default:
+		invalid("trace-exporter: %q is not none, stdout or otlp", c.Tracing.Exporter)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		invalid("trace-sample-ratio: must be between 0 and 1, got %v", c.Tracing.SampleRatio)
+	}
+
+	if c.Limits.MaxMessageSize <= 0 {
+		invalid("ws-max-message: must be positive, got %v", c.Limits.MaxMessageSize)
+	}
+	if c.Limits.MaxLobbies < 0 {
+		invalid("max-lobbies: must not be negative")
+	}
+	for _, origin := range c.Limits.AllowedOrigins {
+		if u, err := url.Parse(origin); origin != "*" && (err != nil || u.Scheme == "" || u.Host == "") {
+			invalid("allowed-origins: %q is not an origin like https://sequence.example", origin)
+		}
+	}
+
+	for name, d := range map[string]time.Duration{
+		"lobby-idle-created":  c.LobbyIdle.Created,
+		"lobby-idle-waiting":  c.LobbyIdle.Waiting,
+		"lobby-idle-game":     c.LobbyIdle.InGame,
+		"lobby-idle-finished": c.LobbyIdle.Finished,
+	} {
+		if d < 0 {
+			invalid("%v: must not be negative, got %v", name, d)
+		}
+	}
+
+	for name, d := range map[string]time.Duration{
+		"session-ttl":      c.SessionLifetime,
+		"invite-ttl":       c.InviteTTL,
+		"reconnect-ttl":    c.ReconnectTTL,
+		"read-timeout":     c.ReadTimeout,
+		"write-timeout":    c.WriteTimeout,
+		"idle-timeout":     c.IdleTimeout,
+		"shutdown-timeout": c.ShutdownTimeout,
+	} {
+		if d <= 0 {
+			invalid("%v: must be positive, got %v", name, d)
+		}
+	}
+
+	if info, err := os.Stat(c.AssetsDir); err != nil {
+		invalid("assets-dir: %v", err)
+	} else if !info.IsDir() {
+		invalid("assets-dir: %v is not a directory", c.AssetsDir)
+	}
+
+	// the bundle is only there once the frontend is built
+	if c.BundleDir == "" {
+		invalid("bundle-dir: must not be empty")
+	} else if info, err := os.Stat(c.BundleDir); err == nil && !info.IsDir() {
+		invalid("bundle-dir: %v is not a directory", c.BundleDir)
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return services.WrapErrorf(err, services.ErrorCodeInvalidArgument, "invalid config")
+	}
+
+	return nil
+}
+
+// URL returns the absolute url of a path on the server, path may carry a
+// query
+func (c Config) URL(path string) string {
+	u, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return ""
+	}
+	ref, err := url.Parse(path)
+	if err != nil {
+		return ""
+	}
+
+	u = u.JoinPath(ref.Path)
+	u.RawQuery = ref.RawQuery
+
+	return u.String()
+}
+
+// SecureCookies reports whether cookies should only be sent over https, which
+// is the case when the server is reached with an https base url
+func (c Config) SecureCookies() bool {
+	u, err := url.Parse(c.BaseURL)
+	return err == nil && u.Scheme == "https"
+}
+
+// WebsocketURL returns the url the lobby websocket of lobbyID is reached at
+func (c Config) WebsocketURL(lobbyID string) string {
+	u, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return ""
+	}
+
+	switch {
+	case c.WebsocketScheme != "":
+		u.Scheme = c.WebsocketScheme
+	case u.Scheme == "https":
+		u.Scheme = "wss"
+	default:
+		u.Scheme = "ws"
+	}
+
+	u = u.JoinPath("lobby", "ws")
+	q := u.Query()
+	q.Set("lobby-id", lobbyID)
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
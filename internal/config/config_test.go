@@ -0,0 +1,169 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spacesedan/go-sequence/internal/db"
+	"github.com/spacesedan/go-sequence/internal/ratelimit"
+)
+
+func env(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	file := filepath.Join(dir, "sequence.conf")
+	err := os.WriteFile(file, []byte(`
+# shared by every replica
+redis-addr = cache:6379
+redis-db = 2
+base-url = "https://sequence.example"
+log-level = info
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := Load("sequence", []string{"-config", file, "-redis-db", "3", "-assets-dir", dir}, env(map[string]string{
+		"SEQUENCE_REDIS_ADDR":      "redis:6380",
+		"SEQUENCE_REDIS_PASSWORD":  "hunter2",
+		"SEQUENCE_REDIS_DB":        "4",
+		"SEQUENCE_INVITE_TTL":      "1h",
+		"SEQUENCE_INVITE_SECRET":   "correct horse",
+		"SEQUENCE_CREATE_RATE":     "2/1h",
+		"SEQUENCE_LOBBY_IDLE_GAME": "0",
+		"SEQUENCE_ALLOWED_ORIGINS": "https://a.example, https://b.example",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// flags win over the environment which wins over the file
+	if c.Redis.DB != 3 {
+		t.Errorf("Expected the redis db flag to win, got %v", c.Redis.DB)
+	}
+	if c.Redis.Addr != "redis:6380" || c.Redis.Password != "hunter2" {
+		t.Errorf("Expected redis to be configured from the environment, got %+v", c.Redis)
+	}
+	if c.BaseURL != "https://sequence.example" || c.LogLevel != slog.LevelInfo {
+		t.Errorf("Expected the base url and log level from the file, got %v %v", c.BaseURL, c.LogLevel)
+	}
+	if c.InviteTTL != time.Hour || c.ReconnectTTL != Default().ReconnectTTL {
+		t.Errorf("Unexpected ttls %v %v", c.InviteTTL, c.ReconnectTTL)
+	}
+
+	if c.LobbyIdle.InGame != 0 || c.LobbyIdle.Waiting != Default().LobbyIdle.Waiting {
+		t.Errorf("Expected games to never idle out, got %+v", c.LobbyIdle)
+	}
+
+	if c.Limits.CreateLobby.Session != (ratelimit.Rate{Burst: 2, Every: time.Hour}) || len(c.Limits.AllowedOrigins) != 2 {
+		t.Errorf("Expected the limits from the environment, got %+v", c.Limits)
+	}
+
+	if got := c.WebsocketURL("ASDA"); got != "wss://sequence.example/lobby/ws?lobby-id=ASDA" {
+		t.Errorf("Expected a wss url for an https base url, got %v", got)
+	}
+	if !c.SecureCookies() {
+		t.Error("Expected secure cookies for an https base url")
+	}
+}
+
+func TestLoadRejects(t *testing.T) {
+	dir := t.TempDir()
+
+	file := filepath.Join(dir, "sequence.conf")
+	if err := os.WriteFile(file, []byte("redis-adr = cache:6379\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		args []string
+		env  map[string]string
+		want []string
+	}{
+		"unknown file setting": {
+			args: []string{"-config", file, "-assets-dir", dir},
+			want: []string{"redis-adr: unknown setting"},
+		},
+		"bad rate": {
+			args: []string{"-ws-rate", "fast", "-assets-dir", dir},
+			want: []string{"ws-rate"},
+		},
+		"bad environment value": {
+			args: []string{"-assets-dir", dir},
+			env:  map[string]string{"SEQUENCE_READ_TIMEOUT": "soon"},
+			want: []string{"read-timeout"},
+		},
+		"unknown backend": {
+			args: []string{"-backend", "mongo", "-assets-dir", dir},
+			want: []string{"unknown backend"},
+		},
+		"redis without an invite secret": {
+			args: []string{"-backend", "redis", "-assets-dir", dir},
+			want: []string{"invite-secret:"},
+		},
+		"every invalid setting": {
+			args: []string{"-addr", "42069", "-base-url", "localhost", "-ws-scheme", "http", "-invite-ttl", "0s", "-lobby-idle-game", "-1m", "-allowed-origins", "localhost", "-assets-dir", filepath.Join(dir, "missing")},
+			want: []string{"addr:", "base-url:", "ws-scheme:", "invite-ttl:", "lobby-idle-game:", "allowed-origins:", "assets-dir:"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Load("sequence", test.args, env(test.env))
+			if err == nil {
+				t.Fatal("Expected the config to be rejected")
+			}
+
+			for _, want := range test.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Expected %q in %v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadHelp(t *testing.T) {
+	_, err := Load("sequence", []string{"-h"}, env(nil))
+	if !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("Expected help to be reported, got %v", err)
+	}
+}
+
+func TestWebsocketURL(t *testing.T) {
+	c := Default()
+	c.Backend = db.BackendMemory
+
+	if got := c.WebsocketURL("ASDA"); got != "ws://localhost:42069/lobby/ws?lobby-id=ASDA" {
+		t.Errorf("Unexpected default websocket url %v", got)
+	}
+	if c.SecureCookies() {
+		t.Error("Expected cookies to be sent over http to the default base url")
+	}
+
+	// a server behind a tls terminating proxy
+	c.BaseURL = "http://sequence.example/play"
+	c.WebsocketScheme = "wss"
+	if got := c.WebsocketURL("ASDA"); got != "wss://sequence.example/play/lobby/ws?lobby-id=ASDA" {
+		t.Errorf("Unexpected websocket url %v", got)
+	}
+}
+
+func TestURL(t *testing.T) {
+	c := Default()
+	c.BaseURL = "https://sequence.example/play"
+
+	if got := c.URL("/lobby/ASDA?invite=abc"); got != "https://sequence.example/play/lobby/ASDA?invite=abc" {
+		t.Errorf("Unexpected invite url %v", got)
+	}
+}
@@ -0,0 +1,96 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/spacesedan/go-sequence/internal"
+)
+
+type ChatRepo interface {
+	AddMessage(lobbyID string, msg *internal.ChatMessage, limit int) error
+	GetMessages(lobbyID string) ([]*internal.ChatMessage, error)
+	DeleteMessages(lobbyID string) error
+}
+
+// chatRepo keeps the most recent messages of every lobby in a redis list
+type chatRepo struct {
+	redisClient *goredis.Client
+	logger      *slog.Logger
+}
+
+func NewChatRepo(r *goredis.Client, l *slog.Logger) ChatRepo {
+	return &chatRepo{
+		redisClient: r,
+		logger:      l,
+	}
+}
+
+// AddMessage appends a message to the lobby chat and drops the oldest messages
+// once there are more than limit stored
+func (c *chatRepo) AddMessage(lobbyID string, msg *internal.ChatMessage, limit int) error {
+	c.logger.Info("chatRepo.AddMessage",
+		slog.Group("writing chat message to db",
+			slog.String("lobby_id", lobbyID),
+			slog.String("sender", msg.Sender)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mb, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	key := chatKey(lobbyID)
+
+	_, err = c.redisClient.TxPipelined(ctx, func(p goredis.Pipeliner) error {
+		p.RPush(ctx, key, mb)
+		p.LTrim(ctx, key, int64(-limit), -1)
+		p.Expire(ctx, key, time.Minute*30)
+		return nil
+	})
+
+	return err
+}
+
+// GetMessages gets the stored messages of a lobby, oldest first
+func (c *chatRepo) GetMessages(lobbyID string) ([]*internal.ChatMessage, error) {
+	c.logger.Info("chatRepo.GetMessages",
+		slog.Group("reading chat history from db",
+			slog.String("lobby_id", lobbyID)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	res, err := c.redisClient.LRange(ctx, chatKey(lobbyID), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	msgs := make([]*internal.ChatMessage, 0, len(res))
+	for _, r := range res {
+		var m *internal.ChatMessage
+		if err := json.Unmarshal([]byte(r), &m); err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, m)
+	}
+
+	return msgs, nil
+}
+
+// DeleteMessages removes the chat history of a lobby
+func (c *chatRepo) DeleteMessages(lobbyID string) error {
+	c.logger.Info("chatRepo.DeleteMessages",
+		slog.Group("deleting chat history from db",
+			slog.String("lobby_id", lobbyID)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	return c.redisClient.Del(ctx, chatKey(lobbyID)).Err()
+}
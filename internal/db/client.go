@@ -11,9 +11,10 @@ import (
 )
 
 type ClientRepo interface {
-	SetPlayer(lobbyID string, username string, playerState *internal.Player) error
-	GetPlayer(lobbyID string, username string) (*internal.Player, error)
-	GetMPlayers(lobbyID string, players []string) ([]*internal.Player, error)
+	SetPlayer(lobbyID string, playerID string, playerState *internal.Player) error
+	GetPlayer(lobbyID string, playerID string) (*internal.Player, error)
+	GetMPlayers(lobbyID string, playerIDs []string) ([]*internal.Player, error)
+	GetLobby(lobbyID string) (*internal.Lobby, error)
 }
 
 type clientRepo struct {
@@ -28,15 +29,15 @@ func NewClientRepo(r *goredis.Client, l *slog.Logger) ClientRepo {
 	}
 }
 
-func (c *clientRepo) SetPlayer(lobby_id string, username string, playerState *internal.Player) error {
+func (c *clientRepo) SetPlayer(lobby_id string, player_id string, playerState *internal.Player) error {
 	c.logger.Info("lobbyRepo.SetPlayer",
 		slog.Group("writing player to db",
 			slog.String("lobby_id", lobby_id),
-			slog.String("username", username)))
+			slog.String("player_id", player_id)))
 
 	rh := NewReJSONHandler(c.redisClient)
 
-	_, err := rh.JSONSet(playerKey(lobby_id, username), playerState)
+	_, err := rh.JSONSet(playerKey(lobby_id, player_id), playerState)
 	if err != nil {
 		return err
 	}
@@ -44,18 +45,18 @@ func (c *clientRepo) SetPlayer(lobby_id string, username string, playerState *in
 	return nil
 }
 
-// GetPlayer gets a player from the db using the lobby id and player username
-func (c *clientRepo) GetPlayer(lobby_id string, username string) (*internal.Player, error) {
+// GetPlayer gets a player from the db using the lobby id and player id
+func (c *clientRepo) GetPlayer(lobby_id string, player_id string) (*internal.Player, error) {
 	c.logger.Info("lobbyRepo.GetPlayer",
 		slog.Group("reading player from db",
 			slog.String("lobby_id", lobby_id),
-			slog.String("username", username)))
+			slog.String("player_id", player_id)))
 
 	var ps *internal.Player
 
 	rh := NewReJSONHandler(c.redisClient)
 
-	pj, err := redis.Bytes(rh.rj.JSONGet(playerKey(lobby_id, username), "."))
+	pj, err := redis.Bytes(rh.rj.JSONGet(playerKey(lobby_id, player_id), "."))
 	if err != nil {
 		return nil, err
 	}
@@ -76,8 +77,8 @@ func (c *clientRepo) GetMPlayers(lobbyID string, players []string) ([]*internal.
 	var ps []*internal.Player
 	var playerKeys []string
 
-	for _, username := range players {
-		playerKeys = append(playerKeys, playerKey(lobbyID, username))
+	for _, id := range players {
+		playerKeys = append(playerKeys, playerKey(lobbyID, id))
 	}
 
 	rh := NewReJSONHandler(c.redisClient)
@@ -101,3 +102,21 @@ func (c *clientRepo) GetMPlayers(lobbyID string, players []string) ([]*internal.
 	return ps, nil
 
 }
+
+// GetLobby gets the lobby state, clients use it to draw the board
+func (c *clientRepo) GetLobby(lobbyID string) (*internal.Lobby, error) {
+	var l *internal.Lobby
+
+	rh := NewReJSONHandler(c.redisClient)
+
+	lb, err := redis.Bytes(rh.rj.JSONGet(lobbyKey(lobbyID), "."))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(lb, &l); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -56,7 +57,31 @@ func lobbyKey(lobby_id string) string {
 	return fmt.Sprintf("lobby_id-%v.gamestate", lobby_id)
 }
 
+// lobbyIDFromKey helper that returns the lobby id of a key made by lobbyKey
+func lobbyIDFromKey(key string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(key, "lobby_id-"), ".gamestate")
+}
+
+// registryKey is the set holding the id of every lobby
+const registryKey = "lobby_registry"
+
+// leaseKey helper that returns the key holding the owner of a lobby
+func leaseKey(lobby_id string) string {
+	return fmt.Sprintf("lobby_id-%v.owner", lobby_id)
+}
+
+// admittedKey helper that returns the key of the set of players that got past
+// the lobby password
+func admittedKey(lobby_id string) string {
+	return fmt.Sprintf("lobby_id-%v.admitted", lobby_id)
+}
+
+// chatKey helper that returns a string used to associate the lobby chat in goredis
+func chatKey(lobby_id string) string {
+	return fmt.Sprintf("lobby_id-%v.chat", lobby_id)
+}
+
 // playerKey helper that returns a string used to associate the player in goredis
-func playerKey(lobby_id string, u string) string {
-	return fmt.Sprintf("lobby_id-%v|username-%v.playerstate", lobby_id, u)
+func playerKey(lobby_id string, player_id string) string {
+	return fmt.Sprintf("lobby_id-%v|player_id-%v.playerstate", lobby_id, player_id)
 }
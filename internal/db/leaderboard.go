@@ -0,0 +1,92 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/spacesedan/go-sequence/internal"
+)
+
+type LeaderboardRepo interface {
+	// Record sets the all time score of a player to their rating and adds the
+	// rating they gained to the daily and weekly leaderboards of at
+	Record(playerID string, rating, gained float64, at time.Time) error
+	// Top returns the player ids and scores of the best players of the period
+	// that contains at, the display names are left empty
+	Top(period internal.LeaderboardPeriod, at time.Time, limit int) ([]internal.LeaderboardEntry, error)
+}
+
+// leaderboardRepo keeps a sorted set per day, week and one for all time
+type leaderboardRepo struct {
+	redisClient *goredis.Client
+	logger      *slog.Logger
+}
+
+func NewLeaderboardRepo(r *goredis.Client, l *slog.Logger) LeaderboardRepo {
+	return &leaderboardRepo{
+		redisClient: r,
+		logger:      l,
+	}
+}
+
+func (lr *leaderboardRepo) Record(playerID string, rating, gained float64, at time.Time) error {
+	lr.logger.Info("leaderboardRepo.Record",
+		slog.Group("writing leaderboard scores to db",
+			slog.String("player_id", playerID)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	daily := leaderboardKey(internal.LeaderboardDaily, at)
+	weekly := leaderboardKey(internal.LeaderboardWeekly, at)
+
+	_, err := lr.redisClient.TxPipelined(ctx, func(p goredis.Pipeliner) error {
+		p.ZAdd(ctx, leaderboardKey(internal.LeaderboardAllTime, at), &goredis.Z{Score: rating, Member: playerID})
+		p.ZIncrBy(ctx, daily, gained, playerID)
+		p.Expire(ctx, daily, 48*time.Hour)
+		p.ZIncrBy(ctx, weekly, gained, playerID)
+		p.Expire(ctx, weekly, 8*24*time.Hour)
+		return nil
+	})
+
+	return err
+}
+
+func (lr *leaderboardRepo) Top(period internal.LeaderboardPeriod, at time.Time, limit int) ([]internal.LeaderboardEntry, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	res, err := lr.redisClient.ZRevRangeWithScores(ctx, leaderboardKey(period, at), 0, int64(limit-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]internal.LeaderboardEntry, 0, len(res))
+	for i, z := range res {
+		entries = append(entries, internal.LeaderboardEntry{
+			Rank:     i + 1,
+			PlayerID: fmt.Sprint(z.Member),
+			Score:    z.Score,
+		})
+	}
+
+	return entries, nil
+}
+
+// leaderboardKey helper that returns the key of the leaderboard covering at,
+// days and weeks are in UTC
+func leaderboardKey(period internal.LeaderboardPeriod, at time.Time) string {
+	at = at.UTC()
+	switch period {
+	case internal.LeaderboardDaily:
+		return fmt.Sprintf("leaderboard.daily.%v", at.Format("2006-01-02"))
+	case internal.LeaderboardWeekly:
+		year, week := at.ISOWeek()
+		return fmt.Sprintf("leaderboard.weekly.%d-W%02d", year, week)
+	default:
+		return "leaderboard.all_time"
+	}
+}
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"encoding/json"
 	"log/slog"
 	"time"
@@ -13,13 +14,20 @@ import (
 type LobbyRepo interface {
 	SetLobby(lobby *internal.Lobby) error
 	GetLobby(lobbyID string) (*internal.Lobby, error)
+	// ListLobbyIDs returns the id of every lobby stored in the db
+	ListLobbyIDs() ([]string, error)
 	DeleteLobby(lobbyID string) error
 
-	GetPlayer(lobbyID string, username string) (*internal.Player, error)
+	// Admit and IsAdmitted keep track of the players that got past the
+	// lobby password, they are shared by every server replica
+	Admit(lobbyID string, playerID string) error
+	IsAdmitted(lobbyID string, playerID string) (bool, error)
+
+	GetPlayer(lobbyID string, playerID string) (*internal.Player, error)
 	SetPlayer(lobbyID string, player *internal.Player) error
-	DeletePlayer(lobby_id string, username string) error
+	DeletePlayer(lobby_id string, playerID string) error
 
-	Expire(lobbyID string, username string, dur time.Duration)
+	Expire(lobbyID string, playerID string, dur time.Duration)
 }
 
 // LobbyRepo responsible for interfacing with the data stored in the cache
@@ -53,13 +61,30 @@ func (l *lobbyRepo) SetLobby(lobby *internal.Lobby) error {
 		Settings:        lobby.Settings,
 		ColorsAvailable: lobby.ColorsAvailable,
 		Players:         lobby.Players,
+		Host:            lobby.Host,
+		Muted:           lobby.Muted,
+		PasswordHash:    lobby.PasswordHash,
+		Board:           lobby.Board,
+		Turn:            lobby.Turn,
+		Game:            lobby.Game,
+		Seats:           lobby.Seats,
+		MatchStartedAt:  lobby.MatchStartedAt,
+		CreatedAt:       lobby.CreatedAt,
+		LastActivity:    lobby.LastActivity,
+		Series:          lobby.Series,
+		SeatOrder:       lobby.SeatOrder,
+		Rematch:         lobby.Rematch,
 	})
 
 	if err != nil {
 		return err
 	}
 
-	return nil
+	// admissions live as long as the lobby does
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	return l.redisClient.Expire(ctx, admittedKey(lobby.ID), time.Minute*30).Err()
 }
 
 // GetLobby gets a lobby from teh db using the lobby id
@@ -84,6 +109,23 @@ func (l *lobbyRepo) GetLobby(lobby_id string) (*internal.Lobby, error) {
 	return lobbyState, nil
 }
 
+func (l *lobbyRepo) ListLobbyIDs() ([]string, error) {
+	l.logger.Info("lobbyRepo.ListLobbyIDs",
+		slog.Group("scanning goredis for lobbies"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var ids []string
+
+	iter := l.redisClient.Scan(ctx, 0, lobbyKey("*"), 100).Iterator()
+	for iter.Next(ctx) {
+		ids = append(ids, lobbyIDFromKey(iter.Val()))
+	}
+
+	return ids, iter.Err()
+}
+
 // DeleteLobby deletes a lobby from the db using the lobby id
 func (l *lobbyRepo) DeleteLobby(lobby_id string) error {
 	l.logger.Info("lobbyRepo.DeleteLobby",
@@ -95,22 +137,55 @@ func (l *lobbyRepo) DeleteLobby(lobby_id string) error {
 	if _, err := rh.rj.JSONDel(lobbyKey(lobby_id), "."); err != nil {
 		return err
 	}
-	return nil
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	return l.redisClient.Del(ctx, admittedKey(lobby_id)).Err()
+}
+
+// Admit remembers that a player got past the lobby password
+func (l *lobbyRepo) Admit(lobby_id string, player_id string) error {
+	l.logger.Info("lobbyRepo.Admit",
+		slog.Group("admitting player to lobby",
+			slog.String("lobby_id", lobby_id),
+			slog.String("player_id", player_id)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err := l.redisClient.TxPipelined(ctx, func(p goredis.Pipeliner) error {
+		p.SAdd(ctx, admittedKey(lobby_id), player_id)
+		p.Expire(ctx, admittedKey(lobby_id), time.Minute*30)
+		return nil
+	})
+
+	return err
+}
+
+// IsAdmitted reports whether a player got past the lobby password
+func (l *lobbyRepo) IsAdmitted(lobby_id string, player_id string) (bool, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	return l.redisClient.SIsMember(ctx, admittedKey(lobby_id), player_id).Result()
 }
 
 // SetPlayer sets and updates player data in the db
 func (l *lobbyRepo) SetPlayer(lobby_id string, p *internal.Player) error {
 	l.logger.Info("lobbyRepo.SetPlayer",
 		slog.Group("writing player to db",
-			slog.String("player", p.Username)))
+			slog.String("player", p.ID)))
 
 	rh := NewReJSONHandler(l.redisClient)
 
-	if _, err := rh.JSONSet(playerKey(lobby_id, p.Username), &internal.Player{
+	if _, err := rh.JSONSet(playerKey(lobby_id, p.ID), &internal.Player{
+		ID:       p.ID,
 		Username: p.Username,
 		LobbyId:  lobby_id,
 		Color:    p.Color,
 		Ready:    p.Ready,
+		Hand:     p.Hand,
 	}); err != nil {
 		return err
 	}
@@ -118,18 +193,18 @@ func (l *lobbyRepo) SetPlayer(lobby_id string, p *internal.Player) error {
 	return nil
 }
 
-// GetPlayer gets a player from the db using the lobby id and player username
-func (l *lobbyRepo) GetPlayer(lobby_id string, username string) (*internal.Player, error) {
+// GetPlayer gets a player from the db using the lobby id and player id
+func (l *lobbyRepo) GetPlayer(lobby_id string, player_id string) (*internal.Player, error) {
 	l.logger.Info("lobbyRepo.GetPlayer",
 		slog.Group("reading player from db",
 			slog.String("lobby_id", lobby_id),
-			slog.String("username", username)))
+			slog.String("player_id", player_id)))
 
 	var ps *internal.Player
 
 	rh := NewReJSONHandler(l.redisClient)
 
-	pj, err := redis.Bytes(rh.rj.JSONGet(playerKey(lobby_id, username), "."))
+	pj, err := redis.Bytes(rh.rj.JSONGet(playerKey(lobby_id, player_id), "."))
 	if err != nil {
 		return nil, err
 	}
@@ -143,15 +218,15 @@ func (l *lobbyRepo) GetPlayer(lobby_id string, username string) (*internal.Playe
 }
 
 // DeletePlayer deletes a player from the db
-func (l *lobbyRepo) DeletePlayer(lobby_id string, username string) error {
+func (l *lobbyRepo) DeletePlayer(lobby_id string, player_id string) error {
 	l.logger.Info("lobbyRepo.DeletePlayer",
 		slog.Group("deleting player from db",
 			slog.String("lobby_id", lobby_id),
-			slog.String("username", username)))
+			slog.String("player_id", player_id)))
 
 	rh := NewReJSONHandler(l.redisClient)
 
-	_, err := rh.rj.JSONDel(playerKey(lobby_id, username), ".")
+	_, err := rh.rj.JSONDel(playerKey(lobby_id, player_id), ".")
 	if err != nil {
 		return err
 	}
@@ -160,6 +235,6 @@ func (l *lobbyRepo) DeletePlayer(lobby_id string, username string) error {
 
 }
 
-func (l *lobbyRepo) Expire(lobby_id string, u string, dur time.Duration) {
-	l.rj.Expire(playerKey(lobby_id, u), dur)
+func (l *lobbyRepo) Expire(lobby_id string, player_id string, dur time.Duration) {
+	l.rj.Expire(playerKey(lobby_id, player_id), dur)
 }
@@ -0,0 +1,471 @@
+package db
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spacesedan/go-sequence/internal"
+)
+
+// memoryDB keyspace shared by the in-memory repos, it uses the same keys as
+// redis and keys expire the same way so both backends behave alike
+type memoryDB struct {
+	mu   sync.Mutex
+	now  func() time.Time
+	data map[string]*memoryValue
+}
+
+type memoryValue struct {
+	value interface{}
+	// expiresAt is zero for keys that never expire
+	expiresAt time.Time
+}
+
+func newMemoryDB(now func() time.Time) *memoryDB {
+	return &memoryDB{
+		now:  now,
+		data: make(map[string]*memoryValue),
+	}
+}
+
+// lookup returns the value stored at key, expired keys are removed first. The
+// caller must hold mu.
+func (m *memoryDB) lookup(key string) (*memoryValue, bool) {
+	v, ok := m.data[key]
+	if !ok {
+		return nil, false
+	}
+
+	if !v.expiresAt.IsZero() && !m.now().Before(v.expiresAt) {
+		delete(m.data, key)
+		return nil, false
+	}
+
+	return v, true
+}
+
+// put stores value at key, a ttl of 0 keeps the key forever. The caller must
+// hold mu.
+func (m *memoryDB) put(key string, value interface{}, ttl time.Duration) {
+	v := &memoryValue{value: value}
+	if ttl > 0 {
+		v.expiresAt = m.now().Add(ttl)
+	}
+	m.data[key] = v
+}
+
+// expire sets the ttl of an existing key. The caller must hold mu.
+func (m *memoryDB) expire(key string, ttl time.Duration) bool {
+	v, ok := m.lookup(key)
+	if !ok {
+		return false
+	}
+
+	v.expiresAt = m.now().Add(ttl)
+	return true
+}
+
+func (m *memoryDB) setJSON(key string, obj interface{}, ttl time.Duration) error {
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.put(key, b, ttl)
+	return nil
+}
+
+func (m *memoryDB) getJSON(key string, obj interface{}) error {
+	m.mu.Lock()
+	v, ok := m.lookup(key)
+	m.mu.Unlock()
+
+	if !ok {
+		return ErrNotFound
+	}
+
+	return json.Unmarshal(v.value.([]byte), obj)
+}
+
+func (m *memoryDB) del(keys ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, k := range keys {
+		delete(m.data, k)
+	}
+}
+
+// set returns the set stored at key, creating it when create is true. The
+// caller must hold mu.
+func (m *memoryDB) set(key string, create bool) map[string]struct{} {
+	if v, ok := m.lookup(key); ok {
+		return v.value.(map[string]struct{})
+	}
+	if !create {
+		return nil
+	}
+
+	s := make(map[string]struct{})
+	m.put(key, s, 0)
+	return s
+}
+
+// zset returns the sorted set stored at key, creating it when create is true.
+// The caller must hold mu.
+func (m *memoryDB) zset(key string, create bool) map[string]float64 {
+	if v, ok := m.lookup(key); ok {
+		return v.value.(map[string]float64)
+	}
+	if !create {
+		return nil
+	}
+
+	z := make(map[string]float64)
+	m.put(key, z, 0)
+	return z
+}
+
+// memoryLobbyRepo LobbyRepo kept in memory
+type memoryLobbyRepo struct {
+	db *memoryDB
+}
+
+func (l *memoryLobbyRepo) SetLobby(lobby *internal.Lobby) error {
+	err := l.db.setJSON(lobbyKey(lobby.ID), &internal.Lobby{
+		ID:              lobby.ID,
+		CurrentState:    lobby.CurrentState,
+		Settings:        lobby.Settings,
+		ColorsAvailable: lobby.ColorsAvailable,
+		Players:         lobby.Players,
+		Host:            lobby.Host,
+		Muted:           lobby.Muted,
+		PasswordHash:    lobby.PasswordHash,
+		Board:           lobby.Board,
+		Turn:            lobby.Turn,
+		Game:            lobby.Game,
+		Seats:           lobby.Seats,
+		MatchStartedAt:  lobby.MatchStartedAt,
+		CreatedAt:       lobby.CreatedAt,
+		LastActivity:    lobby.LastActivity,
+		Series:          lobby.Series,
+		SeatOrder:       lobby.SeatOrder,
+		Rematch:         lobby.Rematch,
+	}, time.Minute*30)
+	if err != nil {
+		return err
+	}
+
+	// admissions live as long as the lobby does
+	l.db.mu.Lock()
+	defer l.db.mu.Unlock()
+
+	l.db.expire(admittedKey(lobby.ID), time.Minute*30)
+	return nil
+}
+
+func (l *memoryLobbyRepo) GetLobby(lobbyID string) (*internal.Lobby, error) {
+	var lobby *internal.Lobby
+	if err := l.db.getJSON(lobbyKey(lobbyID), &lobby); err != nil {
+		return nil, err
+	}
+
+	return lobby, nil
+}
+
+func (l *memoryLobbyRepo) ListLobbyIDs() ([]string, error) {
+	l.db.mu.Lock()
+	defer l.db.mu.Unlock()
+
+	var ids []string
+	for key := range l.db.data {
+		if !strings.HasPrefix(key, "lobby_id-") || !strings.HasSuffix(key, ".gamestate") {
+			continue
+		}
+		if _, ok := l.db.lookup(key); ok {
+			ids = append(ids, lobbyIDFromKey(key))
+		}
+	}
+	sort.Strings(ids)
+
+	return ids, nil
+}
+
+func (l *memoryLobbyRepo) DeleteLobby(lobbyID string) error {
+	l.db.del(lobbyKey(lobbyID), admittedKey(lobbyID))
+	return nil
+}
+
+func (l *memoryLobbyRepo) Admit(lobbyID string, playerID string) error {
+	l.db.mu.Lock()
+	defer l.db.mu.Unlock()
+
+	l.db.set(admittedKey(lobbyID), true)[playerID] = struct{}{}
+	l.db.expire(admittedKey(lobbyID), time.Minute*30)
+	return nil
+}
+
+func (l *memoryLobbyRepo) IsAdmitted(lobbyID string, playerID string) (bool, error) {
+	l.db.mu.Lock()
+	defer l.db.mu.Unlock()
+
+	_, ok := l.db.set(admittedKey(lobbyID), false)[playerID]
+	return ok, nil
+}
+
+func (l *memoryLobbyRepo) GetPlayer(lobbyID string, playerID string) (*internal.Player, error) {
+	var ps *internal.Player
+	if err := l.db.getJSON(playerKey(lobbyID, playerID), &ps); err != nil {
+		return nil, err
+	}
+
+	return ps, nil
+}
+
+func (l *memoryLobbyRepo) SetPlayer(lobbyID string, p *internal.Player) error {
+	return l.db.setJSON(playerKey(lobbyID, p.ID), &internal.Player{
+		ID:       p.ID,
+		Username: p.Username,
+		LobbyId:  lobbyID,
+		Color:    p.Color,
+		Ready:    p.Ready,
+		Hand:     p.Hand,
+	}, time.Minute*30)
+}
+
+func (l *memoryLobbyRepo) DeletePlayer(lobbyID string, playerID string) error {
+	l.db.del(playerKey(lobbyID, playerID))
+	return nil
+}
+
+func (l *memoryLobbyRepo) Expire(lobbyID string, playerID string, dur time.Duration) {
+	l.db.mu.Lock()
+	defer l.db.mu.Unlock()
+
+	l.db.expire(playerKey(lobbyID, playerID), dur)
+}
+
+// memoryClientRepo ClientRepo kept in memory
+type memoryClientRepo struct {
+	db *memoryDB
+}
+
+func (c *memoryClientRepo) SetPlayer(lobbyID string, playerID string, playerState *internal.Player) error {
+	return c.db.setJSON(playerKey(lobbyID, playerID), playerState, time.Minute*30)
+}
+
+func (c *memoryClientRepo) GetPlayer(lobbyID string, playerID string) (*internal.Player, error) {
+	var ps *internal.Player
+	if err := c.db.getJSON(playerKey(lobbyID, playerID), &ps); err != nil {
+		return nil, err
+	}
+
+	return ps, nil
+}
+
+func (c *memoryClientRepo) GetMPlayers(lobbyID string, playerIDs []string) ([]*internal.Player, error) {
+	var ps []*internal.Player
+	for _, id := range playerIDs {
+		p, err := c.GetPlayer(lobbyID, id)
+		if err != nil {
+			return nil, err
+		}
+		ps = append(ps, p)
+	}
+
+	return ps, nil
+}
+
+func (c *memoryClientRepo) GetLobby(lobbyID string) (*internal.Lobby, error) {
+	var l *internal.Lobby
+	if err := c.db.getJSON(lobbyKey(lobbyID), &l); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// memoryChatRepo ChatRepo kept in memory
+type memoryChatRepo struct {
+	db *memoryDB
+}
+
+func (c *memoryChatRepo) AddMessage(lobbyID string, msg *internal.ChatMessage, limit int) error {
+	mb, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	var msgs [][]byte
+	if v, ok := c.db.lookup(chatKey(lobbyID)); ok {
+		msgs = v.value.([][]byte)
+	}
+
+	msgs = append(msgs, mb)
+	if limit > 0 && len(msgs) > limit {
+		msgs = msgs[len(msgs)-limit:]
+	}
+
+	c.db.put(chatKey(lobbyID), msgs, time.Minute*30)
+	return nil
+}
+
+func (c *memoryChatRepo) GetMessages(lobbyID string) ([]*internal.ChatMessage, error) {
+	c.db.mu.Lock()
+	var stored [][]byte
+	if v, ok := c.db.lookup(chatKey(lobbyID)); ok {
+		stored = v.value.([][]byte)
+	}
+	c.db.mu.Unlock()
+
+	msgs := make([]*internal.ChatMessage, 0, len(stored))
+	for _, b := range stored {
+		var m *internal.ChatMessage
+		if err := json.Unmarshal(b, &m); err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, m)
+	}
+
+	return msgs, nil
+}
+
+func (c *memoryChatRepo) DeleteMessages(lobbyID string) error {
+	c.db.del(chatKey(lobbyID))
+	return nil
+}
+
+// memoryRegistryRepo RegistryRepo kept in memory, it only makes sense for a
+// single replica but keeps the lease semantics
+type memoryRegistryRepo struct {
+	db *memoryDB
+}
+
+func (r *memoryRegistryRepo) AddLobby(lobbyID string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	r.db.set(registryKey, true)[lobbyID] = struct{}{}
+	return nil
+}
+
+func (r *memoryRegistryRepo) RemoveLobby(lobbyID string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	delete(r.db.set(registryKey, false), lobbyID)
+	return nil
+}
+
+func (r *memoryRegistryRepo) ListLobbies() ([]string, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	var ids []string
+	for id := range r.db.set(registryKey, false) {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids, nil
+}
+
+func (r *memoryRegistryRepo) AcquireLease(lobbyID, owner string, ttl time.Duration) (bool, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if _, ok := r.db.lookup(leaseKey(lobbyID)); ok {
+		return false, nil
+	}
+
+	r.db.put(leaseKey(lobbyID), owner, ttl)
+	return true, nil
+}
+
+func (r *memoryRegistryRepo) RenewLease(lobbyID, owner string, ttl time.Duration) (bool, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if v, ok := r.db.lookup(leaseKey(lobbyID)); !ok || v.value != owner {
+		return false, nil
+	}
+
+	return r.db.expire(leaseKey(lobbyID), ttl), nil
+}
+
+func (r *memoryRegistryRepo) ReleaseLease(lobbyID, owner string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if v, ok := r.db.lookup(leaseKey(lobbyID)); ok && v.value == owner {
+		delete(r.db.data, leaseKey(lobbyID))
+	}
+	return nil
+}
+
+func (r *memoryRegistryRepo) LeaseOwner(lobbyID string) (string, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if v, ok := r.db.lookup(leaseKey(lobbyID)); ok {
+		return v.value.(string), nil
+	}
+	return "", nil
+}
+
+// memoryLeaderboardRepo LeaderboardRepo kept in memory
+type memoryLeaderboardRepo struct {
+	db *memoryDB
+}
+
+func (lr *memoryLeaderboardRepo) Record(playerID string, rating, gained float64, at time.Time) error {
+	lr.db.mu.Lock()
+	defer lr.db.mu.Unlock()
+
+	lr.db.zset(leaderboardKey(internal.LeaderboardAllTime, at), true)[playerID] = rating
+
+	daily := leaderboardKey(internal.LeaderboardDaily, at)
+	lr.db.zset(daily, true)[playerID] += gained
+	lr.db.expire(daily, 48*time.Hour)
+
+	weekly := leaderboardKey(internal.LeaderboardWeekly, at)
+	lr.db.zset(weekly, true)[playerID] += gained
+	lr.db.expire(weekly, 8*24*time.Hour)
+
+	return nil
+}
+
+func (lr *memoryLeaderboardRepo) Top(period internal.LeaderboardPeriod, at time.Time, limit int) ([]internal.LeaderboardEntry, error) {
+	lr.db.mu.Lock()
+	entries := make([]internal.LeaderboardEntry, 0)
+	for id, score := range lr.db.zset(leaderboardKey(period, at), false) {
+		entries = append(entries, internal.LeaderboardEntry{PlayerID: id, Score: score})
+	}
+	lr.db.mu.Unlock()
+
+	// ties are ordered the way redis orders them, by member in reverse
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Score != entries[j].Score {
+			return entries[i].Score > entries[j].Score
+		}
+		return entries[i].PlayerID > entries[j].PlayerID
+	})
+
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	for i := range entries {
+		entries[i].Rank = i + 1
+	}
+
+	return entries, nil
+}
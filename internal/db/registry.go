@@ -0,0 +1,128 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+)
+
+// RegistryRepo keeps track of every lobby across all server replicas and
+// which replica owns each of them. Ownership is a lease that expires unless
+// the owner keeps renewing it.
+type RegistryRepo interface {
+	AddLobby(lobbyID string) error
+	RemoveLobby(lobbyID string) error
+	ListLobbies() ([]string, error)
+
+	// AcquireLease claims the lobby for owner, it fails when another owner
+	// holds an unexpired lease
+	AcquireLease(lobbyID, owner string, ttl time.Duration) (bool, error)
+	// RenewLease extends a lease held by owner, it returns false once the
+	// lease was lost
+	RenewLease(lobbyID, owner string, ttl time.Duration) (bool, error)
+	ReleaseLease(lobbyID, owner string) error
+	// LeaseOwner returns the current owner of a lobby, empty when the lobby
+	// has no owner
+	LeaseOwner(lobbyID string) (string, error)
+}
+
+// only touch the lease when it is still held by the caller
+var (
+	renewLeaseScript = goredis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+	releaseLeaseScript = goredis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+)
+
+type registryRepo struct {
+	redisClient *goredis.Client
+	logger      *slog.Logger
+}
+
+func NewRegistryRepo(r *goredis.Client, l *slog.Logger) RegistryRepo {
+	return &registryRepo{
+		redisClient: r,
+		logger:      l,
+	}
+}
+
+func (rr *registryRepo) AddLobby(lobbyID string) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	return rr.redisClient.SAdd(ctx, registryKey, lobbyID).Err()
+}
+
+func (rr *registryRepo) RemoveLobby(lobbyID string) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	return rr.redisClient.SRem(ctx, registryKey, lobbyID).Err()
+}
+
+func (rr *registryRepo) ListLobbies() ([]string, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	return rr.redisClient.SMembers(ctx, registryKey).Result()
+}
+
+func (rr *registryRepo) AcquireLease(lobbyID, owner string, ttl time.Duration) (bool, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ok, err := rr.redisClient.SetNX(ctx, leaseKey(lobbyID), owner, ttl).Result()
+	if err != nil {
+		return false, err
+	}
+
+	if ok {
+		rr.logger.Info("registryRepo.AcquireLease",
+			slog.Group("claimed lobby",
+				slog.String("lobby_id", lobbyID),
+				slog.String("owner", owner)))
+	}
+
+	return ok, nil
+}
+
+func (rr *registryRepo) RenewLease(lobbyID, owner string, ttl time.Duration) (bool, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	n, err := renewLeaseScript.Run(ctx, rr.redisClient, []string{leaseKey(lobbyID)}, owner, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+func (rr *registryRepo) ReleaseLease(lobbyID, owner string) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	return releaseLeaseScript.Run(ctx, rr.redisClient, []string{leaseKey(lobbyID)}, owner).Err()
+}
+
+func (rr *registryRepo) LeaseOwner(lobbyID string) (string, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	owner, err := rr.redisClient.Get(ctx, leaseKey(lobbyID)).Result()
+	if errors.Is(err, goredis.Nil) {
+		return "", nil
+	}
+
+	return owner, err
+}
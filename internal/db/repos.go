@@ -0,0 +1,77 @@
+package db
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+)
+
+// Backend names the storage the repos are kept in
+type Backend string
+
+const (
+	// BackendRedis shares the repos between every replica through redis
+	BackendRedis Backend = "redis"
+	// BackendMemory keeps the repos inside the process, for tests and
+	// single node servers
+	BackendMemory Backend = "memory"
+)
+
+// Valid reports whether b is a known backend
+func (b Backend) Valid() bool {
+	return b == BackendRedis || b == BackendMemory
+}
+
+func (b Backend) String() string {
+	return string(b)
+}
+
+// Set lets a backend be picked with a flag
+func (b *Backend) Set(s string) error {
+	if !Backend(s).Valid() {
+		return fmt.Errorf("unknown backend %q, use %v or %v", s, BackendRedis, BackendMemory)
+	}
+	*b = Backend(s)
+	return nil
+}
+
+// Repos are the repositories of a single backend
+type Repos struct {
+	Lobby       LobbyRepo
+	Client      ClientRepo
+	Chat        ChatRepo
+	Registry    RegistryRepo
+	Leaderboard LeaderboardRepo
+}
+
+// NewRedisRepos creates the repos backed by redis
+func NewRedisRepos(r *goredis.Client, l *slog.Logger) Repos {
+	return Repos{
+		Lobby:       NewLobbyRepo(r, l),
+		Client:      NewClientRepo(r, l),
+		Chat:        NewChatRepo(r, l),
+		Registry:    NewRegistryRepo(r, l),
+		Leaderboard: NewLeaderboardRepo(r, l),
+	}
+}
+
+// NewMemoryRepos creates repos that share a single in-memory keyspace
+func NewMemoryRepos(l *slog.Logger) Repos {
+	l.Info("db.NewMemoryRepos", slog.String("reason", "keeping lobbies in memory"))
+
+	return newMemoryRepos(time.Now)
+}
+
+func newMemoryRepos(now func() time.Time) Repos {
+	m := newMemoryDB(now)
+
+	return Repos{
+		Lobby:       &memoryLobbyRepo{db: m},
+		Client:      &memoryClientRepo{db: m},
+		Chat:        &memoryChatRepo{db: m},
+		Registry:    &memoryRegistryRepo{db: m},
+		Leaderboard: &memoryLeaderboardRepo{db: m},
+	}
+}
@@ -0,0 +1,322 @@
+package db
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/spacesedan/go-sequence/internal"
+)
+
+// testBackend repos under test, wait lets time pass so keys can expire
+type testBackend struct {
+	repos Repos
+	wait  func(time.Duration)
+}
+
+// fakeClock lets the memory backend expire keys without sleeping
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func newMemoryBackend(t *testing.T) testBackend {
+	clock := &fakeClock{now: time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)}
+	return testBackend{repos: newMemoryRepos(clock.Now), wait: clock.Add}
+}
+
+// newRedisBackend runs the suite against the redis stack at
+// SEQUENCE_TEST_REDIS_URL, the database is flushed before every test
+func newRedisBackend(t *testing.T) testBackend {
+	url := os.Getenv("SEQUENCE_TEST_REDIS_URL")
+	if url == "" {
+		t.Skip("SEQUENCE_TEST_REDIS_URL is not set")
+	}
+
+	opts, err := goredis.ParseURL(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := goredis.NewClient(opts)
+	t.Cleanup(func() { r.Close() })
+
+	if err := r.FlushDB(context.Background()).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return testBackend{repos: NewRedisRepos(r, logger), wait: time.Sleep}
+}
+
+// TestRepos is the conformance suite every backend has to pass
+func TestRepos(t *testing.T) {
+	backends := map[string]func(*testing.T) testBackend{
+		"memory": newMemoryBackend,
+		"redis":  newRedisBackend,
+	}
+
+	suite := map[string]func(*testing.T, testBackend){
+		"Lobby":       testLobbyRepo,
+		"Players":     testPlayers,
+		"Chat":        testChatRepo,
+		"Registry":    testRegistryRepo,
+		"Leaderboard": testLeaderboardRepo,
+	}
+
+	for name, newBackend := range backends {
+		t.Run(name, func(t *testing.T) {
+			for test, run := range suite {
+				t.Run(test, func(t *testing.T) {
+					run(t, newBackend(t))
+				})
+			}
+		})
+	}
+}
+
+func testLobbyRepo(t *testing.T, b testBackend) {
+	repo := b.repos.Lobby
+
+	if _, err := repo.GetLobby("ASDA"); err == nil {
+		t.Error("Expected reading a missing lobby to fail")
+	}
+
+	err := repo.SetLobby(&internal.Lobby{
+		ID:           "ASDA",
+		CurrentState: internal.InLobby,
+		Settings:     internal.Settings{NumOfPlayers: 2, MaxHandSize: 7},
+		Host:         "p1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := repo.GetLobby("ASDA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Host != "p1" || l.Settings.NumOfPlayers != 2 || l.CurrentState != internal.InLobby {
+		t.Errorf("Unexpected lobby %+v", l)
+	}
+
+	// the client repo reads the same lobby
+	if cl, err := b.repos.Client.GetLobby("ASDA"); err != nil || cl.Host != "p1" {
+		t.Errorf("Expected the client repo to see the lobby, got %+v %v", cl, err)
+	}
+
+	ids, err := repo.ListLobbyIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != "ASDA" {
+		t.Errorf("Expected only ASDA to be listed, got %v", ids)
+	}
+
+	if err := repo.Admit("ASDA", "p2"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := repo.IsAdmitted("ASDA", "p2"); err != nil || !ok {
+		t.Errorf("Expected p2 to be admitted, got %v %v", ok, err)
+	}
+	if ok, _ := repo.IsAdmitted("ASDA", "p3"); ok {
+		t.Error("Expected p3 not to be admitted")
+	}
+
+	if err := repo.DeleteLobby("ASDA"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetLobby("ASDA"); err == nil {
+		t.Error("Expected the lobby to be deleted")
+	}
+	if ok, _ := repo.IsAdmitted("ASDA", "p2"); ok {
+		t.Error("Expected admissions to be deleted with the lobby")
+	}
+}
+
+func testPlayers(t *testing.T, b testBackend) {
+	repo := b.repos.Lobby
+
+	if _, err := repo.GetPlayer("ASDA", "p1"); err == nil {
+		t.Error("Expected reading a missing player to fail")
+	}
+
+	for _, p := range []*internal.Player{
+		{ID: "p1", Username: "ada", Color: "red"},
+		{ID: "p2", Username: "grace", Ready: true},
+	} {
+		if err := repo.SetPlayer("ASDA", p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p, err := repo.GetPlayer("ASDA", "p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Username != "ada" || p.Color != "red" || p.LobbyId != "ASDA" {
+		t.Errorf("Unexpected player %+v", p)
+	}
+
+	players, err := b.repos.Client.GetMPlayers("ASDA", []string{"p1", "p2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(players) != 2 || players[1].Username != "grace" || !players[1].Ready {
+		t.Errorf("Expected both players in order, got %+v", players)
+	}
+
+	// players that disconnect are kept until their expiry runs out
+	repo.Expire("ASDA", "p1", time.Second)
+	b.wait(2 * time.Second)
+
+	if _, err := repo.GetPlayer("ASDA", "p1"); err == nil {
+		t.Error("Expected the player to expire")
+	}
+	if _, err := b.repos.Client.GetPlayer("ASDA", "p2"); err != nil {
+		t.Errorf("Expected p2 to be kept: %v", err)
+	}
+
+	if err := repo.DeletePlayer("ASDA", "p2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetPlayer("ASDA", "p2"); err == nil {
+		t.Error("Expected the player to be deleted")
+	}
+}
+
+func testChatRepo(t *testing.T, b testBackend) {
+	repo := b.repos.Chat
+
+	msgs, err := repo.GetMessages("ASDA")
+	if err != nil || len(msgs) != 0 {
+		t.Fatalf("Expected no messages, got %v %v", msgs, err)
+	}
+
+	for _, m := range []string{"one", "two", "three"} {
+		if err := repo.AddMessage("ASDA", &internal.ChatMessage{Sender: "ada", Message: m}, 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	msgs, err = repo.GetMessages("ASDA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || msgs[0].Message != "two" || msgs[1].Message != "three" {
+		t.Errorf("Expected the two newest messages oldest first, got %+v", msgs)
+	}
+
+	if err := repo.DeleteMessages("ASDA"); err != nil {
+		t.Fatal(err)
+	}
+	if msgs, _ := repo.GetMessages("ASDA"); len(msgs) != 0 {
+		t.Error("Expected the chat history to be deleted")
+	}
+}
+
+func testRegistryRepo(t *testing.T, b testBackend) {
+	repo := b.repos.Registry
+
+	for _, id := range []string{"ASDA", "JKLK"} {
+		if err := repo.AddLobby(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.RemoveLobby("JKLK"); err != nil {
+		t.Fatal(err)
+	}
+
+	ids, err := repo.ListLobbies()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != "ASDA" {
+		t.Errorf("Expected only ASDA to be registered, got %v", ids)
+	}
+
+	if ok, err := repo.AcquireLease("ASDA", "a", time.Second); err != nil || !ok {
+		t.Fatalf("Expected a to acquire the lease, got %v %v", ok, err)
+	}
+	if ok, _ := repo.AcquireLease("ASDA", "b", time.Second); ok {
+		t.Error("Expected b not to acquire a held lease")
+	}
+	if ok, _ := repo.RenewLease("ASDA", "b", time.Second); ok {
+		t.Error("Expected b not to renew a lease it doesn't hold")
+	}
+	if ok, err := repo.RenewLease("ASDA", "a", time.Second); err != nil || !ok {
+		t.Errorf("Expected a to renew its lease, got %v %v", ok, err)
+	}
+
+	// releasing someone else's lease does nothing
+	repo.ReleaseLease("ASDA", "b")
+	if owner, _ := repo.LeaseOwner("ASDA"); owner != "a" {
+		t.Errorf("Expected a to own the lobby, got %q", owner)
+	}
+
+	b.wait(2 * time.Second)
+
+	if owner, _ := repo.LeaseOwner("ASDA"); owner != "" {
+		t.Errorf("Expected the lease to expire, owned by %q", owner)
+	}
+	if ok, _ := repo.AcquireLease("ASDA", "b", time.Second); !ok {
+		t.Error("Expected b to take over the expired lease")
+	}
+
+	if err := repo.ReleaseLease("ASDA", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if owner, _ := repo.LeaseOwner("ASDA"); owner != "" {
+		t.Errorf("Expected the lease to be released, owned by %q", owner)
+	}
+}
+
+func testLeaderboardRepo(t *testing.T, b testBackend) {
+	repo := b.repos.Leaderboard
+	at := time.Date(2023, 10, 4, 12, 0, 0, 0, time.UTC)
+
+	repo.Record("p1", 1216, 16, at)
+	repo.Record("p2", 1184, -16, at)
+	repo.Record("p1", 1230, 14, at.Add(24*time.Hour))
+
+	top, err := repo.Top(internal.LeaderboardAllTime, at, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(top) != 2 || top[0].PlayerID != "p1" || top[0].Score != 1230 || top[0].Rank != 1 {
+		t.Errorf("Unexpected all time leaderboard %+v", top)
+	}
+
+	daily, err := repo.Top(internal.LeaderboardDaily, at, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(daily) != 2 || daily[0].Score != 16 {
+		t.Errorf("Expected only the first day's gains, got %+v", daily)
+	}
+
+	weekly, err := repo.Top(internal.LeaderboardWeekly, at, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(weekly) != 1 || weekly[0].PlayerID != "p1" || weekly[0].Score != 30 {
+		t.Errorf("Expected p1 to lead the week with 30, got %+v", weekly)
+	}
+}
@@ -0,0 +1,48 @@
+CREATE TABLE IF NOT EXISTS profiles (
+    player_id    TEXT PRIMARY KEY,
+    display_name TEXT NOT NULL,
+    created_at   TIMESTAMP NOT NULL,
+    last_seen_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS matches (
+    id           TEXT PRIMARY KEY,
+    lobby_id     TEXT NOT NULL,
+    started_at   TIMESTAMP NOT NULL,
+    ended_at     TIMESTAMP NOT NULL,
+    winner_color TEXT NOT NULL,
+    final_board  TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS match_players (
+    match_id     TEXT NOT NULL REFERENCES matches(id) ON DELETE CASCADE,
+    player_id    TEXT NOT NULL,
+    display_name TEXT NOT NULL,
+    color        TEXT NOT NULL,
+    winner       BOOLEAN NOT NULL,
+    PRIMARY KEY (match_id, player_id)
+);
+
+CREATE INDEX IF NOT EXISTS match_players_player_id ON match_players(player_id);
+
+CREATE TABLE IF NOT EXISTS match_moves (
+    match_id  TEXT NOT NULL REFERENCES matches(id) ON DELETE CASCADE,
+    turn      INTEGER NOT NULL,
+    player_id TEXT NOT NULL,
+    card_type TEXT NOT NULL,
+    card_suit TEXT NOT NULL,
+    x         INTEGER NOT NULL,
+    y         INTEGER NOT NULL,
+    removed   BOOLEAN NOT NULL,
+    sequences INTEGER NOT NULL,
+    played_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (match_id, turn)
+);
+
+CREATE TABLE IF NOT EXISTS ratings (
+    player_id  TEXT PRIMARY KEY,
+    rating     REAL NOT NULL,
+    games      INTEGER NOT NULL,
+    wins       INTEGER NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,276 @@
+package db
+
+import (
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/spacesedan/go-sequence/internal"
+	_ "modernc.org/sqlite"
+)
+
+//go:embed schema/sqlite.sql
+var sqliteSchema string
+
+// sqliteStore Store backed by an embedded sqlite database file
+type sqliteStore struct {
+	db     *sql.DB
+	logger *slog.Logger
+}
+
+// NewSQLiteStore opens or creates the sqlite database at path and makes sure
+// the schema exists
+func NewSQLiteStore(path string, l *slog.Logger) (Store, error) {
+	dsn := fmt.Sprintf("file:%v?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", path)
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// sqlite only allows a single writer
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	l.Info("db.NewSQLiteStore", slog.String("path", path))
+
+	return &sqliteStore{db: db, logger: l}, nil
+}
+
+func (s *sqliteStore) SaveProfile(p *internal.Profile) error {
+	s.logger.Info("sqliteStore.SaveProfile",
+		slog.Group("writing profile to db",
+			slog.String("player_id", p.PlayerID)))
+
+	_, err := s.db.Exec(`
+		INSERT INTO profiles (player_id, display_name, created_at, last_seen_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (player_id) DO UPDATE SET
+			display_name = excluded.display_name,
+			last_seen_at = excluded.last_seen_at`,
+		p.PlayerID, p.DisplayName, p.CreatedAt.UTC(), p.LastSeenAt.UTC())
+
+	return err
+}
+
+func (s *sqliteStore) GetProfile(playerID string) (*internal.Profile, error) {
+	var p internal.Profile
+
+	err := s.db.QueryRow(`
+		SELECT player_id, display_name, created_at, last_seen_at
+		FROM profiles WHERE player_id = ?`, playerID).
+		Scan(&p.PlayerID, &p.DisplayName, &p.CreatedAt, &p.LastSeenAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+func (s *sqliteStore) SaveMatch(m *internal.Match) error {
+	s.logger.Info("sqliteStore.SaveMatch",
+		slog.Group("writing match to db",
+			slog.String("match_id", m.ID),
+			slog.String("lobby_id", m.LobbyID)))
+
+	board, err := json.Marshal(m.FinalBoard)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		INSERT INTO matches (id, lobby_id, started_at, ended_at, winner_color, final_board)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		m.ID, m.LobbyID, m.StartedAt.UTC(), m.EndedAt.UTC(), m.WinnerColor, string(board)); err != nil {
+		return err
+	}
+
+	for _, p := range m.Players {
+		if _, err := tx.Exec(`
+			INSERT INTO match_players (match_id, player_id, display_name, color, winner)
+			VALUES (?, ?, ?, ?, ?)`,
+			m.ID, p.PlayerID, p.DisplayName, p.Color, p.Winner); err != nil {
+			return err
+		}
+	}
+
+	for _, mv := range m.Moves {
+		if _, err := tx.Exec(`
+			INSERT INTO match_moves (match_id, turn, player_id, card_type, card_suit, x, y, removed, sequences, played_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			m.ID, mv.Turn, mv.PlayerID, mv.Card.Type, mv.Card.Suit, mv.X, mv.Y, mv.Removed, mv.Sequences, mv.PlayedAt.UTC()); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqliteStore) GetMatch(matchID string) (*internal.Match, error) {
+	var m internal.Match
+	var board string
+
+	err := s.db.QueryRow(`
+		SELECT id, lobby_id, started_at, ended_at, winner_color, final_board
+		FROM matches WHERE id = ?`, matchID).
+		Scan(&m.ID, &m.LobbyID, &m.StartedAt, &m.EndedAt, &m.WinnerColor, &board)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(board), &m.FinalBoard); err != nil {
+		return nil, err
+	}
+
+	if m.Players, err = s.matchPlayers(m.ID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT turn, player_id, card_type, card_suit, x, y, removed, sequences, played_at
+		FROM match_moves WHERE match_id = ? ORDER BY turn`, m.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var mv internal.MatchMove
+		if err := rows.Scan(&mv.Turn, &mv.PlayerID, &mv.Card.Type, &mv.Card.Suit,
+			&mv.X, &mv.Y, &mv.Removed, &mv.Sequences, &mv.PlayedAt); err != nil {
+			return nil, err
+		}
+		m.Moves = append(m.Moves, mv)
+	}
+
+	return &m, rows.Err()
+}
+
+func (s *sqliteStore) ListMatches(playerID string, limit int) ([]*internal.Match, error) {
+	rows, err := s.db.Query(`
+		SELECT m.id, m.lobby_id, m.started_at, m.ended_at, m.winner_color
+		FROM matches m
+		JOIN match_players mp ON mp.match_id = m.id
+		WHERE mp.player_id = ?
+		ORDER BY m.ended_at DESC
+		LIMIT ?`, playerID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matches []*internal.Match
+	for rows.Next() {
+		var m internal.Match
+		if err := rows.Scan(&m.ID, &m.LobbyID, &m.StartedAt, &m.EndedAt, &m.WinnerColor); err != nil {
+			return nil, err
+		}
+		matches = append(matches, &m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, m := range matches {
+		if m.Players, err = s.matchPlayers(m.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return matches, nil
+}
+
+func (s *sqliteStore) matchPlayers(matchID string) ([]internal.MatchPlayer, error) {
+	rows, err := s.db.Query(`
+		SELECT player_id, display_name, color, winner
+		FROM match_players WHERE match_id = ? ORDER BY rowid`, matchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var players []internal.MatchPlayer
+	for rows.Next() {
+		var p internal.MatchPlayer
+		if err := rows.Scan(&p.PlayerID, &p.DisplayName, &p.Color, &p.Winner); err != nil {
+			return nil, err
+		}
+		players = append(players, p)
+	}
+
+	return players, rows.Err()
+}
+
+func (s *sqliteStore) GetRatings(playerIDs []string) (map[string]*internal.Rating, error) {
+	ratings := make(map[string]*internal.Rating, len(playerIDs))
+
+	for _, id := range playerIDs {
+		var r internal.Rating
+
+		err := s.db.QueryRow(`
+			SELECT player_id, rating, games, wins, updated_at
+			FROM ratings WHERE player_id = ?`, id).
+			Scan(&r.PlayerID, &r.Rating, &r.Games, &r.Wins, &r.UpdatedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		ratings[id] = &r
+	}
+
+	return ratings, nil
+}
+
+func (s *sqliteStore) SaveRatings(ratings []*internal.Rating) error {
+	s.logger.Info("sqliteStore.SaveRatings",
+		slog.Group("writing ratings to db",
+			slog.Int("players", len(ratings))))
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, r := range ratings {
+		if _, err := tx.Exec(`
+			INSERT INTO ratings (player_id, rating, games, wins, updated_at)
+			VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (player_id) DO UPDATE SET
+				rating = excluded.rating,
+				games = excluded.games,
+				wins = excluded.wins,
+				updated_at = excluded.updated_at`,
+			r.PlayerID, r.Rating, r.Games, r.Wins, r.UpdatedAt.UTC()); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
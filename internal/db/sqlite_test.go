@@ -0,0 +1,165 @@
+package db
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spacesedan/go-sequence/internal"
+	"github.com/spacesedan/go-sequence/internal/game"
+)
+
+func newTestSQLiteStore(t *testing.T) Store {
+	t.Helper()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "sequence.db"), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	return s
+}
+
+func TestSQLiteStoreProfiles(t *testing.T) {
+	s := newTestSQLiteStore(t)
+
+	created := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	if _, err := s.GetProfile("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound but got %v", err)
+	}
+
+	if err := s.SaveProfile(&internal.Profile{
+		PlayerID:    "p1",
+		DisplayName: "ada",
+		CreatedAt:   created,
+		LastSeenAt:  created,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// saving again updates the name but keeps the creation time
+	if err := s.SaveProfile(&internal.Profile{
+		PlayerID:    "p1",
+		DisplayName: "grace",
+		CreatedAt:   created.Add(time.Hour),
+		LastSeenAt:  created.Add(time.Hour),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := s.GetProfile("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.DisplayName != "grace" || !p.CreatedAt.Equal(created) || !p.LastSeenAt.Equal(created.Add(time.Hour)) {
+		t.Errorf("Unexpected profile %+v", p)
+	}
+}
+
+func TestSQLiteStoreMatches(t *testing.T) {
+	s := newTestSQLiteStore(t)
+
+	board, err := game.NewBoard("../game/testdata/board_cells.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	board[1][0].ChipPlaced = true
+	board[1][0].ChipColor = "red"
+
+	started := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	for i, id := range []string{"m1", "m2"} {
+		m := &internal.Match{
+			ID:          id,
+			LobbyID:     "ASDA",
+			StartedAt:   started.Add(time.Duration(i) * time.Hour),
+			EndedAt:     started.Add(time.Duration(i)*time.Hour + 10*time.Minute),
+			WinnerColor: "red",
+			Players: []internal.MatchPlayer{
+				{PlayerID: "p1", DisplayName: "ada", Color: "red", Winner: true},
+				{PlayerID: "p2", DisplayName: "grace", Color: "blue"},
+			},
+			FinalBoard: board,
+			Moves: []internal.MatchMove{
+				{Turn: 1, PlayerID: "p1", Card: game.Card{Type: "Nine", Suit: "Spade"}, X: 1, Y: 0, PlayedAt: started},
+			},
+		}
+		if err := s.SaveMatch(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	matches, err := s.ListMatches("p2", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(matches) != 2 || matches[0].ID != "m2" {
+		t.Fatalf("Expected both matches with the newest first, got %v", len(matches))
+	}
+
+	if winners := matches[0].Winners(); len(winners) != 1 || winners[0].PlayerID != "p1" {
+		t.Errorf("Expected p1 to be the winner, got %+v", winners)
+	}
+
+	m, err := s.GetMatch("m1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.Moves) != 1 || m.Moves[0].Card.Type != "Nine" {
+		t.Errorf("Expected the move log to be stored, got %+v", m.Moves)
+	}
+
+	if cell := m.FinalBoard[1][0]; cell == nil || cell.ChipColor != "red" {
+		t.Error("Expected the final board to be stored")
+	}
+
+	if m.Duration() != 10*time.Minute {
+		t.Errorf("Expected a 10 minute match, got %v", m.Duration())
+	}
+
+	if _, err := s.GetMatch("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound but got %v", err)
+	}
+}
+
+func TestSQLiteStoreRatings(t *testing.T) {
+	s := newTestSQLiteStore(t)
+
+	now := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	if err := s.SaveRatings([]*internal.Rating{
+		{PlayerID: "p1", Rating: 1216, Games: 1, Wins: 1, UpdatedAt: now},
+		{PlayerID: "p2", Rating: 1184, Games: 1, UpdatedAt: now},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.SaveRatings([]*internal.Rating{
+		{PlayerID: "p1", Rating: 1230, Games: 2, Wins: 2, UpdatedAt: now},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ratings, err := s.GetRatings([]string{"p1", "p2", "p3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ratings) != 2 {
+		t.Fatalf("Expected players without a rating to be left out, got %v", len(ratings))
+	}
+
+	if r := ratings["p1"]; r.Rating != 1230 || r.Games != 2 || r.Wins != 2 {
+		t.Errorf("Unexpected rating %+v", r)
+	}
+}
@@ -0,0 +1,32 @@
+package db
+
+import (
+	"errors"
+
+	"github.com/spacesedan/go-sequence/internal"
+)
+
+var ErrNotFound = errors.New("not found")
+
+// Store keeps the data that has to outlive a lobby, unlike the lobby and player
+// state kept in redis nothing in it expires
+type Store interface {
+	// SaveProfile creates or updates a profile, the creation time of an
+	// existing profile is kept
+	SaveProfile(p *internal.Profile) error
+	GetProfile(playerID string) (*internal.Profile, error)
+
+	SaveMatch(m *internal.Match) error
+	// GetMatch returns the match with its final board and moves
+	GetMatch(matchID string) (*internal.Match, error)
+	// ListMatches returns the most recent matches a player took part in
+	// without their board and moves
+	ListMatches(playerID string, limit int) ([]*internal.Match, error)
+
+	// GetRatings returns the ratings of the players that have one, players
+	// that never played a ranked game are left out
+	GetRatings(playerIDs []string) (map[string]*internal.Rating, error)
+	SaveRatings(ratings []*internal.Rating) error
+
+	Close() error
+}
@@ -2,15 +2,16 @@ package game
 
 // BoardLocation are the spots inside of the board
 type BoardCell struct {
-	Type       string  `json:"type"`
-	Suit       string  `json:"suit"`
-	X          int     `json:"x"`
-	Y          int     `json:"y"`
-	CellLocked bool    `json:"cell_locked"`
-	IsCorner   bool    `json:"is_corner"`
-	ChipPlaced bool    `json:"chip_placed"`
-	ChipColor  string  `json:"chip_color"`
-	Player     *Player `json:",omitempty"`
+	Type       string `json:"type"`
+	Suit       string `json:"suit"`
+	X          int    `json:"x"`
+	Y          int    `json:"y"`
+	CellLocked bool   `json:"cell_locked"`
+	IsCorner   bool   `json:"is_corner"`
+	ChipPlaced bool   `json:"chip_placed"`
+	ChipColor  string `json:"chip_color"`
+	// Player is not sent over the wire, players point back at their cells
+	Player *Player `json:"-"`
 }
 
 type BoardCells []BoardCell
@@ -19,6 +20,6 @@ type Board [BoardSize][BoardSize]*BoardCell
 
 // Position
 type CellPosition struct {
-	X int
-	Y int
+	X int `json:"x"`
+	Y int `json:"y"`
 }
@@ -1,9 +1,16 @@
 package game
 
+import "fmt"
+
 // Card holds the Suit and the value of a card
 type Card struct {
-	Suit string
-	Type string
+	Suit string `json:"suit"`
+	Type string `json:"type"`
+}
+
+// String returns the card the way players say it, like "Ten of Hearts"
+func (c Card) String() string {
+	return fmt.Sprintf("%v of %vs", c.Type, c.Suit)
 }
 
 // Slice of cards where plays get dealt cards and draw from
@@ -34,6 +34,21 @@ type GameService interface {
 
 	PlayerPlayCardFromHand(*Player, int) (Card, error)
 	PlayerAddCardToHand(*Player, Card)
+
+	// Turns
+	StartGame(order []uuid.UUID, handSize int, rules Rules) error
+	CurrentTurn() *Player
+	PlayTurn(playerID uuid.UUID, cardIndex int, pos CellPosition) (Move, error)
+	ExchangeDeadCard(playerID uuid.UUID, cardIndex int) (Card, error)
+	Forfeit(playerID uuid.UUID) error
+	Winner() string
+	GetMoves() []Move
+
+	// Mode returns the mode the game is played in
+	Mode() Mode
+
+	// Snapshot returns everything needed to restore the game
+	Snapshot() State
 }
 
 type gameService struct {
@@ -44,6 +59,20 @@ type gameService struct {
 	logger        *slog.Logger
 	GameOver      bool
 	CurrentPlayer int
+
+	HandSize       int
+	TurnOrder      []uuid.UUID
+	Sequences      map[string]int
+	SequencesToWin int
+	WinnerColor    string
+	Moves          []Move
+
+	Rules     Rules
+	Completed []Sequence
+
+	mode Mode
+	// Drawn counts the cards dealt from the deck
+	Drawn int
 }
 
 type Settings struct {
@@ -61,17 +90,26 @@ const (
 	BoardCellsJSONPath = "data/board_cells.json"
 )
 
-func NewGameService() GameService {
-	board, err := NewBoard()
+// NewGameService creates a classic game
+func NewGameService(boardCellsPath string) GameService {
+	return NewModeGameService(boardCellsPath, Classic{})
+}
+
+// NewModeGameService creates a game played in mode
+func NewModeGameService(boardCellsPath string, mode Mode) GameService {
+	board, err := NewBoard(boardCellsPath)
 	if err != nil {
 		panic(err)
 	}
 
 	return &gameService{
-		Deck:        shuffleDeck(NewDeck()),
+		mode:        mode,
+		Deck:        shuffleDeck(mode.NewDeck()),
 		DiscardPile: DiscardPile{},
 		Board:       board,
 		Players:     make(Players),
+		HandSize:    HandSize,
+		Sequences:   make(map[string]int),
 	}
 }
 
@@ -148,21 +186,24 @@ func (g *gameService) DealCards() error {
 	}
 
 	// Deal a single card to every player until the desired hand size is reached
-	for i := 0; i < HandSize; i++ {
+	for i := 0; i < g.HandSize; i++ {
 		for _, player := range g.Players {
-			card := g.DealOneCard()
-			player.Hand = append(player.Hand, card)
+			if card, ok := g.mode.Draw(Table{g}, player); ok {
+				player.Hand = append(player.Hand, card)
+			}
 		}
 	}
 
 	return nil
 }
 
-// DrawCard Draw a card from the deck and add it to the players hand
+// DrawCard Draw a card from the deck and add it to the players hand, the mode
+// decides what is drawn
 func (g *gameService) DrawCard(player *Player) Card {
-	if len(player.Hand) < HandSize {
-		card := g.DealOneCard()
-		return card
+	if len(player.Hand) < g.HandSize {
+		if card, ok := g.mode.Draw(Table{g}, player); ok {
+			return card
+		}
 	}
 
 	return Card{}
@@ -178,6 +219,11 @@ func (g gameService) GetDeck() Deck {
 	return g.Deck
 }
 
+// Mode returns the mode the game is played in
+func (g gameService) Mode() Mode {
+	return g.mode
+}
+
 // getDiscardPile returns the discard pile
 func (g gameService) GetDiscardPile() DiscardPile {
 	return g.DiscardPile
@@ -185,11 +231,11 @@ func (g gameService) GetDiscardPile() DiscardPile {
 
 // BOARD LOGIC -------------------------------------------
 
-// NewBoard creates a new game board
-func NewBoard() (Board, error) {
+// NewBoard creates a new game board from the board cells file at path
+func NewBoard(path string) (Board, error) {
 	var board Board
 
-	cells, err := boardCellsFromFile(BoardCellsJSONPath)
+	cells, err := boardCellsFromFile(path)
 	if err != nil {
 		return Board{}, services.WrapErrorf(err, services.ErrorCodeNotFound, "services.NewBoard")
 	}
@@ -233,9 +279,8 @@ func (g *gameService) AddPlayerChip(player *Player, card Card, pos CellPosition)
 	// check to see if the cell is already occupied
 	if cell.ChipPlaced {
 		// add more information later
-		return nil, services.WrapErrorf(errors.New("Illegal Move, cell is taken"),
-			services.ErrorCodeIllegalMove,
-			"boardService.AddPlayerChip")
+		return nil, services.NewErrorf(services.ErrorCodeCellTaken,
+			"Illegal move; cell %v,%v is taken", pos.X, pos.Y)
 	}
 
 	player.Cells[pos.X][pos.Y] = cell
@@ -252,19 +297,14 @@ func (g gameService) RemovePlayerChip(pos CellPosition) error {
 	cell := g.Board[pos.X][pos.Y]
 
 	if !cell.ChipPlaced {
-		return services.WrapErrorf(
-			errors.New("Illegal Move: cell not taken"),
-			services.ErrorCodeIllegalMove,
-			"boardService.RemovePlayerChip")
+		return services.NewErrorf(services.ErrorCodeIllegalMove,
+			"Illegal move; cell %v,%v has no chip to remove", pos.X, pos.Y)
 
 	}
 
 	if cell.CellLocked {
-		return services.WrapErrorf(
-			errors.New("Illegal Move: cell is a part of a sequence"),
-			services.ErrorCodeIllegalMove,
-			"boardService.RemovePlayerChip",
-		)
+		return services.NewErrorf(services.ErrorCodeIllegalMove,
+			"Illegal move; chips that are part of a sequence can't be removed")
 	}
 
 	// Remove the cell from the player
@@ -373,7 +413,7 @@ func (g gameService) GetPlayer(playerId uuid.UUID) (*Player, error) {
 // it returns the card a the players played or an error
 func (g *gameService) PlayerPlayCardFromHand(player *Player, cardIndex int) (Card, error) {
 	// check to see if the card played is in the players hand
-	if cardIndex > len(player.Hand) {
+	if cardIndex < 0 || cardIndex >= len(player.Hand) {
 		return Card{}, services.WrapErrorf(
 			errors.New("Illegal move; cannot play card that is not in your hand"),
 			services.ErrorCodeIllegalMove,
@@ -389,16 +429,17 @@ func (g *gameService) PlayerPlayCardFromHand(player *Player, cardIndex int) (Car
 
 	// Update the player hand
 	for i := 0; i < len(player.Hand); i++ {
-		// we don't want to add this card back to the player hand so we ignore it
-		// in the loop
-		if cardPlayed == player.Hand[i] {
+		// we don't want to add this card back to the player hand so we ignore
+		// it in the loop, only the played copy is skipped since decks hold two
+		// of every card
+		if i == cardIndex {
 			continue
 		}
 
-		newHand = append(newHand, player.Hand...)
-		// update the player hand with the new hand
-		player.Hand = newHand
+		newHand = append(newHand, player.Hand[i])
 	}
+	// update the player hand with the new hand
+	player.Hand = newHand
 
 	return cardPlayed, nil
 }
@@ -0,0 +1,243 @@
+package game
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/spacesedan/go-sequence/internal/services"
+)
+
+// Mode is a way to play on the Sequence board. Modes decide what the players
+// are dealt and when a game ends, the board, the deck and the chip logic are
+// the same in every mode.
+type Mode interface {
+	// Name is the name lobbies pick the mode by
+	Name() string
+	Description() string
+	// Seats returns the fewest and the most colors the mode is played with,
+	// players of the same color play as a team
+	Seats() (min, max int)
+	// NewDeck builds the deck the game is dealt from
+	NewDeck() Deck
+	// Draw returns the card dealt to p at the start of the game or after they
+	// played a card, ok is false when they get nothing
+	Draw(t Table, p *Player) (card Card, ok bool)
+	// BeginTurn is called every time it becomes p's turn, p's turn is skipped
+	// when it returns false
+	BeginTurn(t Table, p *Player) bool
+	// ToWin returns the number of sequences a color needs to win, 0 plays
+	// until Over ends the game
+	ToWin(rules Rules, colors int) int
+	// Over reports whether the game ends before p plays their turn, the color
+	// with the most sequences wins
+	Over(t Table, p *Player) bool
+	// Describe lists the rules in effect for the players
+	Describe(rules Rules) []string
+}
+
+// Table is what a mode sees of the game it is played in
+type Table struct {
+	g *gameService
+}
+
+// Board returns the game board
+func (t Table) Board() Board {
+	return t.g.Board
+}
+
+// Drawn returns the number of cards dealt from the deck so far
+func (t Table) Drawn() int {
+	return t.g.Drawn
+}
+
+// Deal takes the top card of the deck
+func (t Table) Deal() Card {
+	t.g.Drawn++
+	return t.g.DealOneCard()
+}
+
+// Playable reports whether a player of color has a cell to play c on
+func (t Table) Playable(c Card, color string) bool {
+	return t.g.playable(c, color)
+}
+
+// the modes a lobby can be created with
+const (
+	ModeClassic     = "classic"
+	ModeJackless    = "jackless"
+	ModeDice        = "dice"
+	ModeScoreAttack = "score_attack"
+)
+
+// ScoreAttackDraws is the number of cards a score attack game is played with
+const ScoreAttackDraws = 40
+
+// Modes are the modes a lobby can be created with, the first one is the
+// classic game
+var Modes = []Mode{
+	Classic{},
+	Jackless{},
+	Dice{},
+	ScoreAttack{Draws: ScoreAttackDraws},
+}
+
+// ModeByName returns the mode called name, an empty name is the classic game
+func ModeByName(name string) (Mode, error) {
+	if name == "" {
+		return Classic{}, nil
+	}
+	for _, m := range Modes {
+		if m.Name() == name {
+			return m, nil
+		}
+	}
+	return nil, services.NewErrorf(services.ErrorCodeInvalidArgument, "unknown game mode %q", name)
+}
+
+// CheckSeats reports whether a game of mode can be played by players of the
+// colors, every team needs the same number of players
+func CheckSeats(mode Mode, colors []string) error {
+	teams := make(map[string]int)
+	for _, c := range colors {
+		teams[c]++
+	}
+
+	min, max := mode.Seats()
+	if max == 1 && len(colors) > 1 {
+		return services.NewErrorf(services.ErrorCodeIllegalMove,
+			"Illegal move; %v is played alone", mode.Description())
+	}
+	if len(teams) < min || len(teams) > max {
+		return services.NewErrorf(services.ErrorCodeIllegalMove,
+			"Illegal move; %v is played with %v to %v colors", mode.Description(), min, max)
+	}
+	for _, n := range teams {
+		if n != teams[colors[0]] {
+			return services.NewErrorf(services.ErrorCodeIllegalMove,
+				"Illegal move; every team needs the same number of players")
+		}
+	}
+	return nil
+}
+
+// Classic is the game as printed on the box, players draw a card after every
+// card they play and race to complete their sequences
+type Classic struct{}
+
+func (Classic) Name() string        { return ModeClassic }
+func (Classic) Description() string { return "classic" }
+
+// Seats there are three chip colors
+func (Classic) Seats() (int, int) { return 2, 3 }
+
+func (Classic) NewDeck() Deck { return NewDeck() }
+
+func (Classic) Draw(t Table, p *Player) (Card, bool) { return t.Deal(), true }
+
+func (Classic) BeginTurn(Table, *Player) bool { return true }
+
+func (Classic) ToWin(rules Rules, colors int) int { return rules.ToWin(colors) }
+
+func (Classic) Over(Table, *Player) bool { return false }
+
+func (Classic) Describe(rules Rules) []string { return rules.Describe() }
+
+// Jackless is the classic game played without jacks, every chip goes on the
+// cell of its card and stays there
+type Jackless struct {
+	Classic
+}
+
+func (Jackless) Name() string        { return ModeJackless }
+func (Jackless) Description() string { return "jack-less" }
+
+// NewDeck returns the deck of NewDeck without its jacks
+func (Jackless) NewDeck() Deck {
+	var deck Deck
+	for _, c := range NewDeck() {
+		if c.Type != "Jack" {
+			deck = append(deck, c)
+		}
+	}
+	return deck
+}
+
+func (Jackless) Describe(rules Rules) []string {
+	return append([]string{"the deck has no jacks"}, rules.Describe()...)
+}
+
+// Dice rolls two ten sided dice at the start of every turn instead of drawing
+// cards, the roll names a row and a column of the board and the player plays
+// the card printed on that cell, a corner is a wild roll
+type Dice struct {
+	Classic
+}
+
+func (Dice) Name() string        { return ModeDice }
+func (Dice) Description() string { return "sequence dice" }
+
+// Draw players hold nothing until they roll on their turn
+func (Dice) Draw(Table, *Player) (Card, bool) { return Card{}, false }
+
+// BeginTurn rolls until the roll names a card the player can play, the turn is
+// skipped when no roll can be played
+func (Dice) BeginTurn(t Table, p *Player) bool {
+	board := t.Board()
+	for i := 0; i < BoardSize*BoardSize; i++ {
+		cell := board[rand.Intn(BoardSize)][rand.Intn(BoardSize)]
+
+		roll := Card{Type: cell.Type, Suit: cell.Suit}
+		if cell.IsCorner {
+			roll = Card{Type: "Jack", Suit: "Diamond"}
+		}
+		if t.Playable(roll, p.Color) {
+			p.Hand = []Card{roll}
+			return true
+		}
+	}
+	p.Hand = nil
+	return false
+}
+
+func (Dice) Describe(rules Rules) []string {
+	return append([]string{"dice pick the cell you play, a corner is wild"}, rules.Describe()...)
+}
+
+// ScoreAttack is played alone, the player makes as many sequences as they can
+// until the cards in their hand can't be played and the deck gave out its
+// Draws cards
+type ScoreAttack struct {
+	Classic
+	Draws int
+}
+
+func (ScoreAttack) Name() string { return ModeScoreAttack }
+
+func (m ScoreAttack) Description() string {
+	return fmt.Sprintf("score attack, %v cards", m.Draws)
+}
+
+func (ScoreAttack) Seats() (int, int) { return 1, 1 }
+
+func (m ScoreAttack) Draw(t Table, p *Player) (Card, bool) {
+	if t.Drawn() >= m.Draws {
+		return Card{}, false
+	}
+	return t.Deal(), true
+}
+
+func (ScoreAttack) ToWin(Rules, int) int { return 0 }
+
+// Over the game ends once no card in the hand can be played
+func (ScoreAttack) Over(t Table, p *Player) bool {
+	for _, c := range p.Hand {
+		if t.Playable(c, p.Color) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m ScoreAttack) Describe(rules Rules) []string {
+	return append([]string{fmt.Sprintf("make as many sequences as you can from %v cards", m.Draws)}, rules.describePlay()...)
+}
@@ -0,0 +1,177 @@
+package game
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestModeByName(t *testing.T) {
+	for _, m := range Modes {
+		got, err := ModeByName(m.Name())
+		if err != nil || got.Name() != m.Name() {
+			t.Errorf("Expected to find %v, got %v %v", m.Name(), got, err)
+		}
+	}
+
+	if m, err := ModeByName(""); err != nil || m.Name() != ModeClassic {
+		t.Errorf("Expected no mode to be classic, got %v %v", m, err)
+	}
+	if _, err := ModeByName("chess"); err == nil {
+		t.Error("Expected an unknown mode to fail")
+	}
+}
+
+func TestCheckSeats(t *testing.T) {
+	for _, colors := range [][]string{
+		{"red", "blue"},
+		{"red", "blue", "red", "blue"},
+		{"red", "blue", "green", "red", "blue", "green"},
+	} {
+		if err := CheckSeats(Classic{}, colors); err != nil {
+			t.Errorf("Expected %v to be seated, got %v", colors, err)
+		}
+	}
+
+	for _, colors := range [][]string{
+		{"red"},
+		{"red", "red"},
+		{"red", "blue", "red"},
+		{"red", "blue", "green", "yellow"},
+	} {
+		if err := CheckSeats(Classic{}, colors); err == nil {
+			t.Errorf("Expected %v not to be seated", colors)
+		}
+	}
+
+	if err := CheckSeats(ScoreAttack{}, []string{"red", "red"}); err == nil {
+		t.Error("Expected score attack to be played alone")
+	}
+}
+
+func TestJacklessDeck(t *testing.T) {
+	deck := Jackless{}.NewDeck()
+
+	if len(deck) != 96 {
+		t.Errorf("Expected 96 cards without the jacks, got %v", len(deck))
+	}
+	for _, c := range deck {
+		if c.Type == "Jack" {
+			t.Fatalf("Expected no jacks, got the %v", c)
+		}
+	}
+}
+
+func TestDiceMode(t *testing.T) {
+	gs, players := newModeGame(t, Dice{}, Rules{}, "red", "blue")
+	red, blue := players[0], players[1]
+
+	if len(red.Hand) != 1 || len(blue.Hand) != 0 {
+		t.Fatalf("Expected only the first player to roll, hands have %v and %v cards", len(red.Hand), len(blue.Hand))
+	}
+
+	roll := red.Hand[0]
+	pos := CellPosition{X: -1}
+	for x := range gs.Board {
+		for y, cell := range gs.Board[x] {
+			open := !cell.ChipPlaced
+			if open && (IsTwoEyedJack(roll) || (cell.Type == roll.Type && cell.Suit == roll.Suit)) {
+				pos = CellPosition{X: x, Y: y}
+			}
+		}
+	}
+	if pos.X < 0 {
+		t.Fatalf("Expected the %v to be playable", roll)
+	}
+
+	if _, err := gs.PlayTurn(red.ID, 0, pos); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(red.Hand) != 0 || len(blue.Hand) != 1 {
+		t.Errorf("Expected the roll to pass to the next player, hands have %v and %v cards", len(red.Hand), len(blue.Hand))
+	}
+}
+
+func TestScoreAttack(t *testing.T) {
+	gs, players := newModeGame(t, ScoreAttack{Draws: HandSize}, Rules{}, "red")
+	red := players[0]
+
+	if gs.SequencesToWin != 0 || gs.Drawn != HandSize {
+		t.Errorf("Expected to play until the cards run out, %v to win and %v drawn", gs.SequencesToWin, gs.Drawn)
+	}
+
+	if err := gs.StartGame(append(gs.TurnOrder, gs.TurnOrder...), HandSize, Rules{}); err == nil {
+		t.Error("Expected score attack to be played alone")
+	}
+
+	// the last playable card ends the game, the deck gave out every card
+	red.Hand = []Card{{Type: "Jack", Suit: "Diamond"}, {Type: "Jack", Suit: "Spade"}}
+	if _, err := gs.PlayTurn(red.ID, 0, CellPosition{X: 5, Y: 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !gs.GameOver || gs.Winner() != "red" {
+		t.Errorf("Expected the game to end once no card can be played, over %v winner %q", gs.GameOver, gs.Winner())
+	}
+}
+
+func TestRestoreMode(t *testing.T) {
+	gs, _ := newModeGame(t, ScoreAttack{Draws: ScoreAttackDraws}, Rules{}, "red")
+
+	b, err := json.Marshal(gs.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var state State
+	if err := json.Unmarshal(b, &state); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := RestoreGameService(state).(*gameService)
+	if restored.Mode().Name() != ModeScoreAttack || restored.Drawn != HandSize {
+		t.Errorf("Expected the mode and draws to be restored, got %v and %v", restored.Mode().Name(), restored.Drawn)
+	}
+}
+
+// skipMode skips the turns of the players of a color
+type skipMode struct {
+	Classic
+	color string
+}
+
+func (m skipMode) BeginTurn(t Table, p *Player) bool { return p.Color != m.color }
+
+func TestModeSkipsTurn(t *testing.T) {
+	gs, players := newModeGame(t, skipMode{color: "blue"}, Rules{}, "red", "blue", "green")
+	red, green := players[0], players[2]
+
+	playJack(t, gs, red, CellPosition{X: 5, Y: 5})
+
+	if gs.CurrentTurn() != green {
+		t.Errorf("Expected blue to be skipped, it is %v's turn", gs.CurrentTurn().Name)
+	}
+}
+
+func TestDiceNoPlayableRoll(t *testing.T) {
+	gs, players := newModeGame(t, Dice{}, Rules{}, "red", "blue")
+	red := players[0]
+
+	// every cell but one is taken, once red takes it nobody can roll a card
+	for x := range gs.Board {
+		for _, cell := range gs.Board[x] {
+			if !cell.IsCorner && !(cell.X == 5 && cell.Y == 5) {
+				cell.ChipPlaced = true
+				cell.ChipColor = "blue"
+			}
+		}
+	}
+	red.Hand = []Card{{Type: "Jack", Suit: "Diamond"}}
+	if _, err := gs.PlayTurn(red.ID, 0, CellPosition{X: 5, Y: 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !gs.GameOver || gs.Winner() == "" {
+		t.Errorf("Expected the game to end once nobody can roll a card, over %v winner %q", gs.GameOver, gs.Winner())
+	}
+}
@@ -4,8 +4,9 @@ import "github.com/google/uuid"
 
 // Player contains information for a single player
 type Player struct {
-	Hand  []Card
-	Cells PlayerCells
+	Hand []Card
+	// Cells point into the board and are rebuilt when a game is restored
+	Cells PlayerCells `json:"-"`
 	Color string
 	ID    uuid.UUID
 	Name  string
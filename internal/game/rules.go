@@ -0,0 +1,516 @@
+package game
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spacesedan/go-sequence/internal/services"
+)
+
+// Move is a single turn played by a player
+type Move struct {
+	PlayerID uuid.UUID    `json:"player_id"`
+	Card     Card         `json:"card"`
+	Position CellPosition `json:"position"`
+	// Removed is true when a one eyed jack took a chip off the board
+	Removed bool `json:"removed"`
+	// Sequences is the number of sequences completed by the move and Locked
+	// the cells that became part of them
+	Sequences int            `json:"sequences"`
+	Locked    []CellPosition `json:"locked,omitempty"`
+	// Broken is the number of sequences a one eyed jack broke and Unlocked the
+	// cells that are no longer part of a sequence
+	Broken   int            `json:"broken,omitempty"`
+	Unlocked []CellPosition `json:"unlocked,omitempty"`
+	PlayedAt time.Time      `json:"played_at"`
+}
+
+// Sequence is a completed sequence, its cells stay locked while it stands
+type Sequence struct {
+	Color string         `json:"color"`
+	Cells []CellPosition `json:"cells"`
+}
+
+// Changed returns the position of every cell the move changed
+func (m Move) Changed() []CellPosition {
+	changed := []CellPosition{m.Position}
+	for _, pos := range append(m.Locked, m.Unlocked...) {
+		if !containsPosition(changed, pos) {
+			changed = append(changed, pos)
+		}
+	}
+	return changed
+}
+
+// IsTwoEyedJack two eyed jacks are wild, they place a chip on any open cell
+func IsTwoEyedJack(c Card) bool {
+	return c.Type == "Jack" && (c.Suit == "Diamond" || c.Suit == "Club")
+}
+
+// IsOneEyedJack one eyed jacks remove an opponent chip that is not part of a
+// sequence
+func IsOneEyedJack(c Card) bool {
+	return c.Type == "Jack" && (c.Suit == "Spade" || c.Suit == "Heart")
+}
+
+// isDeadCard a card other than a jack is dead once both of its cells are taken
+func (g *gameService) isDeadCard(c Card) bool {
+	if IsOneEyedJack(c) || IsTwoEyedJack(c) {
+		return false
+	}
+
+	for x := range g.Board {
+		for _, cell := range g.Board[x] {
+			if cell.Type == c.Type && cell.Suit == c.Suit && !cell.ChipPlaced {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// TURN LOGIC -------------------------------------------
+
+// StartGame sets the order players take turns in and deals their cards, the
+// players must already be added to the game. The game is played with rules.
+func (g *gameService) StartGame(order []uuid.UUID, handSize int, rules Rules) error {
+	if len(order) == 0 {
+		return services.WrapErrorf(
+			errors.New("Illegal move; no players to start the game with"),
+			services.ErrorCodeIllegalMove,
+			"gameService.StartGame")
+	}
+
+	colors := make(map[string]bool)
+	var seats []string
+	for _, id := range order {
+		player, err := g.GetPlayer(id)
+		if err != nil {
+			return err
+		}
+		colors[player.Color] = true
+		seats = append(seats, player.Color)
+	}
+	if err := CheckSeats(g.mode, seats); err != nil {
+		return err
+	}
+
+	if err := rules.Validate(); err != nil {
+		return err
+	}
+
+	if handSize > 0 {
+		g.HandSize = handSize
+	}
+
+	g.Rules = rules
+	g.SequencesToWin = g.mode.ToWin(rules, len(colors))
+	g.TurnOrder = order
+	g.CurrentPlayer = 0
+	g.Sequences = make(map[string]int)
+	g.Completed = nil
+	g.Moves = nil
+	g.GameOver = false
+	g.WinnerColor = ""
+
+	if err := g.DealCards(); err != nil {
+		return err
+	}
+	g.beginTurn()
+
+	return nil
+}
+
+// CurrentTurn returns the player whose turn it is
+func (g *gameService) CurrentTurn() *Player {
+	if len(g.TurnOrder) == 0 {
+		return nil
+	}
+	return g.Players[g.TurnOrder[g.CurrentPlayer]]
+}
+
+// Winner returns the color of the winning player or team, it is empty while
+// the game is still going
+func (g *gameService) Winner() string {
+	return g.WinnerColor
+}
+
+// GetMoves returns every move played so far
+func (g *gameService) GetMoves() []Move {
+	return g.Moves
+}
+
+// PlayTurn plays the card at cardIndex of the player's hand on the cell at pos,
+// the player draws a new card and the turn passes to the next player
+func (g *gameService) PlayTurn(playerID uuid.UUID, cardIndex int, pos CellPosition) (Move, error) {
+	player, err := g.turnPlayer(playerID, cardIndex)
+	if err != nil {
+		return Move{}, err
+	}
+
+	if pos.X < 0 || pos.X >= BoardSize || pos.Y < 0 || pos.Y >= BoardSize {
+		return Move{}, services.NewErrorf(services.ErrorCodeInvalidArgument, "Illegal move; cell %v,%v is not on the board", pos.X, pos.Y)
+	}
+
+	card := player.Hand[cardIndex]
+	cell := g.Board[pos.X][pos.Y]
+
+	if cell.IsCorner {
+		if g.Rules.NoCorners {
+			return Move{}, services.NewErrorf(services.ErrorCodeIllegalMove, "Illegal move; corners can't be played")
+		}
+		return Move{}, services.NewErrorf(services.ErrorCodeIllegalMove, "Illegal move; corners belong to everyone")
+	}
+
+	move := Move{
+		PlayerID: player.ID,
+		Card:     card,
+		Position: pos,
+		PlayedAt: time.Now().UTC(),
+	}
+
+	switch {
+	case IsOneEyedJack(card):
+		if !cell.ChipPlaced || cell.ChipColor == player.Color {
+			return Move{}, services.NewErrorf(services.ErrorCodeIllegalMove, "Illegal move; one eyed jacks remove an opponent chip")
+		}
+		if cell.CellLocked && g.Rules.RemoveLocked {
+			move.Broken, move.Unlocked = g.breakSequences(pos)
+		}
+		if err := g.RemovePlayerChip(pos); err != nil {
+			return Move{}, err
+		}
+		move.Removed = true
+	case IsTwoEyedJack(card):
+		if _, err := g.AddPlayerChip(player, card, pos); err != nil {
+			return Move{}, err
+		}
+	default:
+		if g.isDeadCard(card) {
+			return Move{}, services.NewErrorf(services.ErrorCodeDeadCard,
+				"Illegal move; both cells of the %v of %v are taken, exchange it for a new card", card.Type, card.Suit)
+		}
+		if cell.Type != card.Type || cell.Suit != card.Suit {
+			return Move{}, services.NewErrorf(services.ErrorCodeIllegalMove,
+				"Illegal move; %v of %v can't be played on %v of %v", card.Type, card.Suit, cell.Type, cell.Suit)
+		}
+		if _, err := g.AddPlayerChip(player, card, pos); err != nil {
+			return Move{}, err
+		}
+	}
+
+	if _, err := g.PlayerPlayCardFromHand(player, cardIndex); err != nil {
+		return Move{}, err
+	}
+	g.AddToDiscardPile(card)
+	if drawn := g.DrawCard(player); drawn != (Card{}) {
+		g.PlayerAddCardToHand(player, drawn)
+	}
+
+	if !move.Removed {
+		move.Locked = g.lockSequences(pos, player.Color)
+		move.Sequences = len(move.Locked) / g.Rules.Length()
+		g.Sequences[player.Color] += move.Sequences
+
+		if g.SequencesToWin > 0 && g.Sequences[player.Color] >= g.SequencesToWin {
+			g.GameOver = true
+			g.WinnerColor = player.Color
+		}
+	}
+
+	g.Moves = append(g.Moves, move)
+
+	if !g.GameOver {
+		g.CurrentPlayer = (g.CurrentPlayer + 1) % len(g.TurnOrder)
+		g.beginTurn()
+	}
+
+	return move, nil
+}
+
+// turnPlayer returns the player whose turn it is when they hold a card at
+// cardIndex
+func (g *gameService) turnPlayer(playerID uuid.UUID, cardIndex int) (*Player, error) {
+	if g.GameOver {
+		return nil, services.NewErrorf(services.ErrorCodeIllegalMove, "Illegal move; the game is over")
+	}
+
+	player := g.CurrentTurn()
+	if player == nil || player.ID != playerID {
+		return nil, services.NewErrorf(services.ErrorCodeNotYourTurn, "Illegal move; it is not your turn")
+	}
+
+	if cardIndex < 0 || cardIndex >= len(player.Hand) {
+		return nil, services.NewErrorf(services.ErrorCodeInvalidArgument, "Illegal move; cannot play card that is not in your hand")
+	}
+
+	return player, nil
+}
+
+// ExchangeDeadCard discards a dead card from the hand of the player whose turn
+// it is and draws a new one, the player keeps their turn. It returns the card
+// that was discarded.
+func (g *gameService) ExchangeDeadCard(playerID uuid.UUID, cardIndex int) (Card, error) {
+	player, err := g.turnPlayer(playerID, cardIndex)
+	if err != nil {
+		return Card{}, err
+	}
+
+	card := player.Hand[cardIndex]
+	if !g.isDeadCard(card) {
+		return Card{}, services.NewErrorf(services.ErrorCodeIllegalMove,
+			"Illegal move; the %v can still be played", card)
+	}
+
+	if _, err := g.PlayerPlayCardFromHand(player, cardIndex); err != nil {
+		return Card{}, err
+	}
+	g.AddToDiscardPile(card)
+
+	drawn := g.DrawCard(player)
+	if drawn != (Card{}) {
+		g.PlayerAddCardToHand(player, drawn)
+	}
+
+	// the mode may end the game once the player has nothing left to play
+	if g.mode.Over(Table{g}, player) {
+		g.endGame()
+	}
+
+	return card, nil
+}
+
+// Forfeit takes the seat of a player who left out of the turn order, their
+// cards are discarded and the turn passes on when it was theirs. A game with
+// players of a single color left ends and that color wins.
+func (g *gameService) Forfeit(playerID uuid.UUID) error {
+	i := slices.Index(g.TurnOrder, playerID)
+	if i < 0 {
+		return services.NewErrorf(services.ErrorCodeNotFound, "No seat found for the player")
+	}
+
+	player := g.Players[playerID]
+	g.DiscardPile = append(g.DiscardPile, player.Hand...)
+	player.Hand = nil
+	g.TurnOrder = slices.Delete(g.TurnOrder, i, i+1)
+
+	if g.GameOver {
+		return nil
+	}
+	if len(g.TurnOrder) == 0 {
+		g.GameOver = true
+		return nil
+	}
+
+	colors := make(map[string]bool)
+	for _, id := range g.TurnOrder {
+		colors[g.Players[id].Color] = true
+	}
+	if min, _ := g.mode.Seats(); min > 1 && len(colors) == 1 {
+		g.GameOver = true
+		g.WinnerColor = g.Players[g.TurnOrder[0]].Color
+		return nil
+	}
+
+	switch {
+	case i < g.CurrentPlayer:
+		g.CurrentPlayer--
+	case i == g.CurrentPlayer:
+		g.CurrentPlayer %= len(g.TurnOrder)
+		g.beginTurn()
+	}
+
+	return nil
+}
+
+// beginTurn lets the mode prepare the turn of the next player, players the
+// mode skips pass the turn on. The game ends when the mode says so or when
+// every player was skipped, the color with the most sequences wins.
+func (g *gameService) beginTurn() {
+	for skipped := 0; ; {
+		next := g.CurrentTurn()
+		ok := g.mode.BeginTurn(Table{g}, next)
+		if g.mode.Over(Table{g}, next) {
+			break
+		}
+		if ok {
+			return
+		}
+
+		if skipped++; skipped == len(g.TurnOrder) {
+			break
+		}
+		g.CurrentPlayer = (g.CurrentPlayer + 1) % len(g.TurnOrder)
+	}
+
+	g.endGame()
+}
+
+// endGame ends the game, the color with the most sequences wins
+func (g *gameService) endGame() {
+	g.GameOver = true
+	for _, id := range g.TurnOrder {
+		color := g.Players[id].Color
+		if g.WinnerColor == "" || g.Sequences[color] > g.Sequences[g.WinnerColor] {
+			g.WinnerColor = color
+		}
+	}
+}
+
+// playable reports whether a player of color has a cell to play c on
+func (g *gameService) playable(c Card, color string) bool {
+	switch {
+	case IsOneEyedJack(c):
+		for x := range g.Board {
+			for _, cell := range g.Board[x] {
+				if cell.ChipPlaced && !cell.IsCorner && cell.ChipColor != color &&
+					(!cell.CellLocked || g.Rules.RemoveLocked) {
+					return true
+				}
+			}
+		}
+		return false
+	case IsTwoEyedJack(c):
+		for x := range g.Board {
+			for _, cell := range g.Board[x] {
+				if !cell.ChipPlaced {
+					return true
+				}
+			}
+		}
+		return false
+	default:
+		return !g.isDeadCard(c)
+	}
+}
+
+// sequence directions, down, right and both diagonals
+var directions = []CellPosition{{X: 1, Y: 0}, {X: 0, Y: 1}, {X: 1, Y: 1}, {X: 1, Y: -1}}
+
+// lockSequences looks for new sequences going through pos and locks their
+// cells, a new sequence may share a single cell with an older one unless the
+// rules forbid it
+func (g *gameService) lockSequences(pos CellPosition, color string) []CellPosition {
+	var locked []CellPosition
+
+	length := g.Rules.Length()
+	maxShared := 1
+	if g.Rules.NoOverlap {
+		maxShared = 0
+	}
+
+	for _, d := range directions {
+		line := g.line(pos, d, color)
+		if len(line) < length {
+			continue
+		}
+
+		// try every window of a sequence length that contains pos
+		for start := 0; start+length <= len(line); start++ {
+			window := line[start : start+length]
+			if !containsPosition(window, pos) {
+				continue
+			}
+
+			shared := 0
+			for _, p := range window {
+				if c := g.Board[p.X][p.Y]; c.CellLocked && !c.IsCorner {
+					shared++
+				}
+			}
+			if shared > maxShared {
+				continue
+			}
+
+			for _, p := range window {
+				g.Board[p.X][p.Y].CellLocked = true
+			}
+			g.Completed = append(g.Completed, Sequence{
+				Color: color,
+				Cells: append([]CellPosition{}, window...),
+			})
+			locked = append(locked, window...)
+			break
+		}
+	}
+
+	return locked
+}
+
+// breakSequences takes away every sequence going through pos from its color,
+// it returns the number of sequences broken and the cells that are no longer
+// part of any sequence
+func (g *gameService) breakSequences(pos CellPosition) (int, []CellPosition) {
+	var standing []Sequence
+	var broken []Sequence
+	for _, seq := range g.Completed {
+		if containsPosition(seq.Cells, pos) {
+			broken = append(broken, seq)
+			continue
+		}
+		standing = append(standing, seq)
+	}
+	g.Completed = standing
+
+	var unlocked []CellPosition
+	for _, seq := range broken {
+		g.Sequences[seq.Color]--
+		for _, p := range seq.Cells {
+			if containsPosition(unlocked, p) || g.inSequence(p) {
+				continue
+			}
+			g.Board[p.X][p.Y].CellLocked = false
+			unlocked = append(unlocked, p)
+		}
+	}
+
+	return len(broken), unlocked
+}
+
+// inSequence reports whether the cell at pos is part of a completed sequence
+func (g *gameService) inSequence(pos CellPosition) bool {
+	for _, seq := range g.Completed {
+		if containsPosition(seq.Cells, pos) {
+			return true
+		}
+	}
+	return false
+}
+
+// line returns the run of cells owned by color that goes through pos in the
+// direction d, corners count for every color unless the rules take them away
+func (g *gameService) line(pos CellPosition, d CellPosition, color string) []CellPosition {
+	owned := func(p CellPosition) bool {
+		if p.X < 0 || p.X >= BoardSize || p.Y < 0 || p.Y >= BoardSize {
+			return false
+		}
+		c := g.Board[p.X][p.Y]
+		if c.IsCorner {
+			return !g.Rules.NoCorners
+		}
+		return c.ChipPlaced && c.ChipColor == color
+	}
+
+	start := pos
+	for next := (CellPosition{X: start.X - d.X, Y: start.Y - d.Y}); owned(next); next = (CellPosition{X: next.X - d.X, Y: next.Y - d.Y}) {
+		start = next
+	}
+
+	var line []CellPosition
+	for p := start; owned(p); p = (CellPosition{X: p.X + d.X, Y: p.Y + d.Y}) {
+		line = append(line, p)
+	}
+
+	return line
+}
+
+func containsPosition(positions []CellPosition, pos CellPosition) bool {
+	for _, p := range positions {
+		if p == pos {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,404 @@
+package game
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/spacesedan/go-sequence/internal/services"
+)
+
+// newTestGame starts a game between players with the given colors, the first
+// player takes the first turn
+func newTestGame(t *testing.T, colors ...string) (*gameService, []*Player) {
+	t.Helper()
+	return newRulesGame(t, Rules{}, colors...)
+}
+
+// newRulesGame starts a game like newTestGame played with rules
+func newRulesGame(t *testing.T, rules Rules, colors ...string) (*gameService, []*Player) {
+	t.Helper()
+	return newModeGame(t, Classic{}, rules, colors...)
+}
+
+// newModeGame starts a game like newTestGame played in mode with rules
+func newModeGame(t *testing.T, mode Mode, rules Rules, colors ...string) (*gameService, []*Player) {
+	t.Helper()
+
+	gs := NewModeGameService(TestPath, mode).(*gameService)
+
+	var players []*Player
+	var order []uuid.UUID
+	for _, color := range colors {
+		p := &Player{ID: uuid.New(), Name: color, Color: color}
+		if err := gs.AddPlayer(p); err != nil {
+			t.Fatal(err)
+		}
+		players = append(players, p)
+		order = append(order, p.ID)
+	}
+
+	if err := gs.StartGame(order, HandSize, rules); err != nil {
+		t.Fatal(err)
+	}
+
+	return gs, players
+}
+
+func TestStartGame(t *testing.T) {
+	gs, players := newTestGame(t, "red", "blue")
+
+	for _, p := range players {
+		if len(p.Hand) != HandSize {
+			t.Errorf("Expected %v cards to be dealt but got %v", HandSize, len(p.Hand))
+		}
+	}
+
+	if gs.CurrentTurn() != players[0] {
+		t.Error("Expected the first player in the order to start")
+	}
+
+	if gs.SequencesToWin != 2 {
+		t.Errorf("Expected two sequences to win a two player game, got %v", gs.SequencesToWin)
+	}
+}
+
+func TestPlayTurn(t *testing.T) {
+	gs, players := newTestGame(t, "red", "blue")
+	red, blue := players[0], players[1]
+
+	red.Hand[0] = Card{Type: "Nine", Suit: "Spade"}
+	pos := CellPosition{X: 1, Y: 0}
+
+	if _, err := gs.PlayTurn(blue.ID, 0, pos); err == nil {
+		t.Error("Expected playing out of turn to fail")
+	}
+
+	if _, err := gs.PlayTurn(red.ID, 0, CellPosition{X: 2, Y: 0}); err == nil {
+		t.Error("Expected playing a card on a cell it doesn't match to fail")
+	}
+
+	move, err := gs.PlayTurn(red.ID, 0, pos)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cell := gs.Board[pos.X][pos.Y]; !cell.ChipPlaced || cell.ChipColor != "red" {
+		t.Error("Expected a red chip to be placed")
+	}
+
+	if len(red.Hand) != HandSize {
+		t.Errorf("Expected the player to draw a card, hand has %v cards", len(red.Hand))
+	}
+
+	if move.Card != (Card{Type: "Nine", Suit: "Spade"}) || len(gs.GetMoves()) != 1 {
+		t.Error("Expected the move to be recorded")
+	}
+
+	if gs.CurrentTurn() != blue {
+		t.Error("Expected the turn to pass to the next player")
+	}
+}
+
+func TestPlayTurnErrorCodes(t *testing.T) {
+	gs, players := newTestGame(t, "red", "blue")
+	red, blue := players[0], players[1]
+
+	blue.Hand[0] = Card{Type: "Nine", Suit: "Spade"}
+	if _, err := gs.PlayTurn(blue.ID, 0, CellPosition{X: 1, Y: 0}); !services.IsCode(err, services.ErrorCodeNotYourTurn) {
+		t.Errorf("Expected playing out of turn to be not your turn, got %v", err)
+	}
+
+	// both nines of spades are covered by the opponent
+	for x := range gs.Board {
+		for _, cell := range gs.Board[x] {
+			if cell.Type == "Nine" && cell.Suit == "Spade" {
+				cell.ChipPlaced = true
+				cell.ChipColor = "blue"
+			}
+		}
+	}
+
+	red.Hand[0] = Card{Type: "Nine", Suit: "Spade"}
+	if _, err := gs.PlayTurn(red.ID, 0, CellPosition{X: 1, Y: 0}); !services.IsCode(err, services.ErrorCodeDeadCard) {
+		t.Errorf("Expected the nine of spades to be dead, got %v", err)
+	}
+
+	red.Hand[0] = Card{Type: "Jack", Suit: "Diamond"}
+	if _, err := gs.PlayTurn(red.ID, 0, CellPosition{X: 1, Y: 0}); !services.IsCode(err, services.ErrorCodeCellTaken) {
+		t.Errorf("Expected a taken cell, got %v", err)
+	}
+}
+
+func TestPlayTurnJacks(t *testing.T) {
+	gs, players := newTestGame(t, "red", "blue")
+	red, blue := players[0], players[1]
+
+	red.Hand[0] = Card{Type: "Jack", Suit: "Diamond"}
+	if _, err := gs.PlayTurn(red.ID, 0, CellPosition{X: 5, Y: 5}); err != nil {
+		t.Fatalf("Expected a two eyed jack to be played anywhere: %v", err)
+	}
+
+	blue.Hand[0] = Card{Type: "Jack", Suit: "Spade"}
+	move, err := gs.PlayTurn(blue.ID, 0, CellPosition{X: 5, Y: 5})
+	if err != nil {
+		t.Fatalf("Expected a one eyed jack to remove an opponent chip: %v", err)
+	}
+
+	if !move.Removed || gs.Board[5][5].ChipPlaced {
+		t.Error("Expected the chip to be removed")
+	}
+
+	red.Hand[0] = Card{Type: "Jack", Suit: "Heart"}
+	if _, err := gs.PlayTurn(red.ID, 0, CellPosition{X: 4, Y: 4}); err == nil {
+		t.Error("Expected a one eyed jack on an empty cell to fail")
+	}
+}
+
+func TestPlayTurnSequence(t *testing.T) {
+	gs, players := newTestGame(t, "red", "blue", "green")
+	red := players[0]
+
+	// the corner counts for every color so four chips next to it make a
+	// sequence
+	for x := 1; x < 4; x++ {
+		gs.AddPlayerChip(red, Card{}, CellPosition{X: x, Y: 0})
+	}
+
+	red.Hand[0] = Card{Type: "Six", Suit: "Spade"}
+	move, err := gs.PlayTurn(red.ID, 0, CellPosition{X: 4, Y: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if move.Sequences != 1 {
+		t.Errorf("Expected one sequence but got %v", move.Sequences)
+	}
+
+	if !gs.Board[2][0].CellLocked {
+		t.Error("Expected the sequence cells to be locked")
+	}
+
+	if gs.Winner() != "red" {
+		t.Errorf("Expected red to win a three player game with one sequence, got %q", gs.Winner())
+	}
+
+	if _, err := gs.PlayTurn(players[1].ID, 0, CellPosition{X: 5, Y: 5}); err == nil {
+		t.Error("Expected moves after the game is over to fail")
+	}
+}
+
+func TestOneEyedJackCantRemoveLockedChip(t *testing.T) {
+	gs, players := newTestGame(t, "red", "blue")
+	red, blue := players[0], players[1]
+
+	gs.AddPlayerChip(blue, Card{}, CellPosition{X: 3, Y: 3})
+	gs.Board[3][3].CellLocked = true
+
+	red.Hand[0] = Card{Type: "Jack", Suit: "Heart"}
+	if _, err := gs.PlayTurn(red.ID, 0, CellPosition{X: 3, Y: 3}); err == nil {
+		t.Error("Expected removing a chip that is part of a sequence to fail")
+	}
+}
+
+func TestRestoreGameService(t *testing.T) {
+	gs, players := newTestGame(t, "red", "blue")
+	red, blue := players[0], players[1]
+
+	red.Hand[0] = Card{Type: "Nine", Suit: "Spade"}
+	if _, err := gs.PlayTurn(red.ID, 0, CellPosition{X: 1, Y: 0}); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := json.Marshal(gs.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var state State
+	if err := json.Unmarshal(b, &state); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := RestoreGameService(state)
+
+	if restored.CurrentTurn().ID != blue.ID {
+		t.Error("Expected the restored game to keep the turn")
+	}
+
+	if len(restored.GetMoves()) != 1 || len(restored.GetDeck()) != len(gs.Deck) {
+		t.Error("Expected the restored game to keep the moves and deck")
+	}
+
+	// the restored chip can still be removed by a one eyed jack
+	rb, _ := restored.GetPlayer(blue.ID)
+	rb.Hand[0] = Card{Type: "Jack", Suit: "Spade"}
+	if _, err := restored.PlayTurn(blue.ID, 0, CellPosition{X: 1, Y: 0}); err != nil {
+		t.Errorf("Expected the restored chip to be removable: %v", err)
+	}
+}
+
+// playJack plays a two eyed jack for player on pos
+func playJack(t *testing.T, gs *gameService, player *Player, pos CellPosition) Move {
+	t.Helper()
+
+	player.Hand[0] = Card{Type: "Jack", Suit: "Diamond"}
+	move, err := gs.PlayTurn(player.ID, 0, pos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return move
+}
+
+func TestRulesSequencesToWin(t *testing.T) {
+	gs, _ := newRulesGame(t, Rules{SequencesToWin: 1}, "red", "blue")
+	if gs.SequencesToWin != 1 {
+		t.Errorf("Expected one sequence to win, got %v", gs.SequencesToWin)
+	}
+
+	if err := gs.StartGame(gs.TurnOrder, HandSize, Rules{SequencesToWin: 3}); !services.IsCode(err, services.ErrorCodeInvalidArgument) {
+		t.Errorf("Expected three sequences to win to be invalid, got %v", err)
+	}
+}
+
+func TestRulesSequenceLength(t *testing.T) {
+	gs, players := newRulesGame(t, Rules{SequenceLength: 6}, "red", "blue")
+	red, blue := players[0], players[1]
+
+	for x := 1; x < 4; x++ {
+		gs.AddPlayerChip(red, Card{}, CellPosition{X: x, Y: 0})
+	}
+	if move := playJack(t, gs, red, CellPosition{X: 4, Y: 0}); move.Sequences != 0 {
+		t.Error("Expected five chips not to make a sequence of six")
+	}
+
+	playJack(t, gs, blue, CellPosition{X: 5, Y: 5})
+	if move := playJack(t, gs, red, CellPosition{X: 5, Y: 0}); move.Sequences != 1 || len(move.Locked) != 6 {
+		t.Errorf("Expected a sequence of six, got %v sequences locking %v cells", move.Sequences, len(move.Locked))
+	}
+}
+
+func TestRulesNoCorners(t *testing.T) {
+	gs, players := newRulesGame(t, Rules{NoCorners: true}, "red", "blue")
+	red := players[0]
+
+	red.Hand[0] = Card{Type: "Jack", Suit: "Diamond"}
+	if _, err := gs.PlayTurn(red.ID, 0, CellPosition{X: 0, Y: 0}); err == nil {
+		t.Error("Expected corners not to be playable")
+	}
+
+	for x := 1; x < 4; x++ {
+		gs.AddPlayerChip(red, Card{}, CellPosition{X: x, Y: 0})
+	}
+	if move := playJack(t, gs, red, CellPosition{X: 4, Y: 0}); move.Sequences != 0 {
+		t.Error("Expected the corner not to count for red")
+	}
+}
+
+func TestRulesNoOverlap(t *testing.T) {
+	gs, players := newRulesGame(t, Rules{NoOverlap: true}, "red", "blue")
+	red, blue := players[0], players[1]
+
+	for x := 1; x < 4; x++ {
+		gs.AddPlayerChip(red, Card{}, CellPosition{X: x, Y: 0})
+	}
+	if move := playJack(t, gs, red, CellPosition{X: 4, Y: 0}); move.Sequences != 1 {
+		t.Fatal("Expected a sequence")
+	}
+
+	playJack(t, gs, blue, CellPosition{X: 5, Y: 5})
+
+	// the second sequence would share 4,0 with the first
+	for y := 1; y < 4; y++ {
+		gs.AddPlayerChip(red, Card{}, CellPosition{X: 4, Y: y})
+	}
+	if move := playJack(t, gs, red, CellPosition{X: 4, Y: 4}); move.Sequences != 0 {
+		t.Error("Expected sequences not to share a chip")
+	}
+}
+
+func TestRulesRemoveLocked(t *testing.T) {
+	gs, players := newRulesGame(t, Rules{RemoveLocked: true}, "red", "blue")
+	red, blue := players[0], players[1]
+
+	for x := 1; x < 4; x++ {
+		gs.AddPlayerChip(red, Card{}, CellPosition{X: x, Y: 0})
+	}
+	if move := playJack(t, gs, red, CellPosition{X: 4, Y: 0}); move.Sequences != 1 {
+		t.Fatal("Expected a sequence")
+	}
+
+	blue.Hand[0] = Card{Type: "Jack", Suit: "Spade"}
+	move, err := gs.PlayTurn(blue.ID, 0, CellPosition{X: 2, Y: 0})
+	if err != nil {
+		t.Fatalf("Expected a one eyed jack to break the sequence: %v", err)
+	}
+
+	if move.Broken != 1 || gs.Sequences["red"] != 0 || len(gs.Completed) != 0 {
+		t.Errorf("Expected the sequence to be taken away, broke %v and red has %v", move.Broken, gs.Sequences["red"])
+	}
+	if gs.Board[1][0].CellLocked || gs.Board[2][0].ChipPlaced {
+		t.Error("Expected the sequence cells to be unlocked and the chip removed")
+	}
+}
+
+func TestExchangeDeadCard(t *testing.T) {
+	gs, players := newTestGame(t, "red", "blue")
+	red, blue := players[0], players[1]
+
+	red.Hand[0] = Card{Type: "Nine", Suit: "Spade"}
+	if _, err := gs.ExchangeDeadCard(red.ID, 0); !services.IsCode(err, services.ErrorCodeIllegalMove) {
+		t.Errorf("Expected a playable card not to be exchanged, got %v", err)
+	}
+
+	for x := range gs.Board {
+		for _, cell := range gs.Board[x] {
+			if cell.Type == "Nine" && cell.Suit == "Spade" {
+				cell.ChipPlaced = true
+				cell.ChipColor = "blue"
+			}
+		}
+	}
+
+	if _, err := gs.ExchangeDeadCard(blue.ID, 0); !services.IsCode(err, services.ErrorCodeNotYourTurn) {
+		t.Errorf("Expected exchanging out of turn to fail, got %v", err)
+	}
+
+	discarded := len(gs.DiscardPile)
+	if _, err := gs.ExchangeDeadCard(red.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(red.Hand) != HandSize || len(gs.DiscardPile) != discarded+1 {
+		t.Errorf("Expected the dead card to be discarded and replaced, hand has %v cards", len(red.Hand))
+	}
+	if gs.CurrentTurn() != red {
+		t.Error("Expected the player to keep their turn")
+	}
+}
+
+func TestForfeit(t *testing.T) {
+	gs, players := newTestGame(t, "red", "blue", "green")
+	red, blue, green := players[0], players[1], players[2]
+
+	// the player whose turn it is leaves, the turn passes on
+	if err := gs.Forfeit(red.ID); err != nil {
+		t.Fatal(err)
+	}
+	if gs.CurrentTurn() != blue || len(gs.TurnOrder) != 2 || red.Hand != nil {
+		t.Errorf("Expected blue to play next without red, it is %v's turn", gs.CurrentTurn().Name)
+	}
+
+	playJack(t, gs, blue, CellPosition{X: 5, Y: 5})
+	if gs.CurrentTurn() != green {
+		t.Errorf("Expected the turn to skip the player who left, it is %v's turn", gs.CurrentTurn().Name)
+	}
+
+	// the last color left wins
+	if err := gs.Forfeit(blue.ID); err != nil {
+		t.Fatal(err)
+	}
+	if !gs.GameOver || gs.Winner() != "green" {
+		t.Errorf("Expected green to win once everyone else left, over %v winner %q", gs.GameOver, gs.Winner())
+	}
+}
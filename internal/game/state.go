@@ -0,0 +1,106 @@
+package game
+
+import "github.com/google/uuid"
+
+// State is a snapshot of a game that can be stored and restored later, for
+// example after the server restarts in the middle of a game
+type State struct {
+	Deck           Deck           `json:"deck"`
+	DiscardPile    DiscardPile    `json:"discard_pile"`
+	Board          Board          `json:"board"`
+	Players        Players        `json:"players"`
+	GameOver       bool           `json:"game_over"`
+	CurrentPlayer  int            `json:"current_player"`
+	HandSize       int            `json:"hand_size"`
+	TurnOrder      []uuid.UUID    `json:"turn_order"`
+	Sequences      map[string]int `json:"sequences"`
+	SequencesToWin int            `json:"sequences_to_win"`
+	WinnerColor    string         `json:"winner_color,omitempty"`
+	Moves          []Move         `json:"moves,omitempty"`
+	Rules          Rules          `json:"rules"`
+	Completed      []Sequence     `json:"completed,omitempty"`
+	Mode           string         `json:"mode,omitempty"`
+	Drawn          int            `json:"drawn,omitempty"`
+}
+
+func (g *gameService) Snapshot() State {
+	return State{
+		Deck:           g.Deck,
+		DiscardPile:    g.DiscardPile,
+		Board:          g.Board,
+		Players:        g.Players,
+		GameOver:       g.GameOver,
+		CurrentPlayer:  g.CurrentPlayer,
+		HandSize:       g.HandSize,
+		TurnOrder:      g.TurnOrder,
+		Sequences:      g.Sequences,
+		SequencesToWin: g.SequencesToWin,
+		WinnerColor:    g.WinnerColor,
+		Moves:          g.Moves,
+		Rules:          g.Rules,
+		Completed:      g.Completed,
+		Mode:           g.mode.Name(),
+		Drawn:          g.Drawn,
+	}
+}
+
+// RestoreGameService resumes a game from a snapshot, chips on the board are
+// given back to a player of their color. Games of an unknown mode are resumed
+// as classic games.
+func RestoreGameService(s State) GameService {
+	mode, err := ModeByName(s.Mode)
+	if err != nil {
+		mode = Classic{}
+	}
+
+	g := &gameService{
+		mode:           mode,
+		Drawn:          s.Drawn,
+		Deck:           s.Deck,
+		DiscardPile:    s.DiscardPile,
+		Board:          s.Board,
+		Players:        s.Players,
+		GameOver:       s.GameOver,
+		CurrentPlayer:  s.CurrentPlayer,
+		HandSize:       s.HandSize,
+		TurnOrder:      s.TurnOrder,
+		Sequences:      s.Sequences,
+		SequencesToWin: s.SequencesToWin,
+		WinnerColor:    s.WinnerColor,
+		Moves:          s.Moves,
+		Rules:          s.Rules,
+		Completed:      s.Completed,
+	}
+
+	if g.Players == nil {
+		g.Players = make(Players)
+	}
+	if g.Sequences == nil {
+		g.Sequences = make(map[string]int)
+	}
+	if g.HandSize == 0 {
+		g.HandSize = HandSize
+	}
+
+	byColor := make(map[string]*Player, len(g.Players))
+	for _, p := range g.Players {
+		p.Cells = PlayerCells{}
+		if _, ok := byColor[p.Color]; !ok {
+			byColor[p.Color] = p
+		}
+	}
+
+	for x := range g.Board {
+		for y, cell := range g.Board[x] {
+			if cell == nil || cell.IsCorner || !cell.ChipPlaced {
+				continue
+			}
+			if p, ok := byColor[cell.ChipColor]; ok {
+				cell.Player = p
+				p.Cells[x][y] = cell
+			}
+		}
+	}
+
+	return g
+}
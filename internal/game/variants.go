@@ -0,0 +1,134 @@
+package game
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spacesedan/go-sequence/internal/services"
+)
+
+// limits of the house rules
+const (
+	MaxSequencesToWin = 2
+	MaxSequenceLength = 6
+)
+
+// Rules are the house rules a game is played with, the zero value plays the
+// standard rules
+type Rules struct {
+	// SequencesToWin is the number of sequences a color needs to win, 0 needs
+	// two with two colors and one with three
+	SequencesToWin int `json:"sequences_to_win,omitempty"`
+	// SequenceLength is the number of chips in a row that make a sequence, 0
+	// plays SequenceSize
+	SequenceLength int `json:"sequence_length,omitempty"`
+	// NoCorners takes the wild corners away, they count for no color
+	NoCorners bool `json:"no_corners,omitempty"`
+	// NoOverlap keeps sequences from sharing a chip
+	NoOverlap bool `json:"no_overlap,omitempty"`
+	// RemoveLocked lets one eyed jacks remove a chip of a sequence, which
+	// breaks the sequence
+	RemoveLocked bool `json:"remove_locked,omitempty"`
+}
+
+// RulesPreset is a named set of house rules hosts pick from
+type RulesPreset struct {
+	Name        string
+	Description string
+	Rules       Rules
+}
+
+// RulesPresets are the house rules a lobby can be created with, the first one
+// is the standard game
+var RulesPresets = []RulesPreset{
+	{Name: "standard", Description: "standard rules"},
+	{Name: "quick", Description: "one sequence wins", Rules: Rules{SequencesToWin: 1}},
+	{Name: "long", Description: "sequences of six", Rules: Rules{SequenceLength: 6}},
+	{Name: "strict", Description: "no wild corners or shared chips", Rules: Rules{NoCorners: true, NoOverlap: true}},
+	{Name: "cutthroat", Description: "one eyed jacks break sequences", Rules: Rules{RemoveLocked: true}},
+}
+
+// PresetRules returns the rules of the preset called name
+func PresetRules(name string) (Rules, error) {
+	for _, p := range RulesPresets {
+		if p.Name == name {
+			return p.Rules, nil
+		}
+	}
+	return Rules{}, services.NewErrorf(services.ErrorCodeInvalidArgument, "unknown rules %q", name)
+}
+
+// Validate reports every rule a game can't be played with
+func (r Rules) Validate() error {
+	var problems []string
+
+	if r.SequencesToWin < 0 || r.SequencesToWin > MaxSequencesToWin {
+		problems = append(problems, fmt.Sprintf("the sequences to win must be between 1 and %v", MaxSequencesToWin))
+	}
+	if r.SequenceLength != 0 && (r.SequenceLength < SequenceSize || r.SequenceLength > MaxSequenceLength) {
+		problems = append(problems, fmt.Sprintf("a sequence must be between %v and %v chips long", SequenceSize, MaxSequenceLength))
+	}
+
+	if len(problems) > 0 {
+		return services.NewErrorf(services.ErrorCodeInvalidArgument, "%v", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Length returns the number of chips in a row that make a sequence
+func (r Rules) Length() int {
+	if r.SequenceLength == 0 {
+		return SequenceSize
+	}
+	return r.SequenceLength
+}
+
+// ToWin returns the number of sequences a color needs to win a game between
+// colors colors
+func (r Rules) ToWin(colors int) int {
+	switch {
+	case r.SequencesToWin > 0:
+		return r.SequencesToWin
+	case colors >= 3:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// Describe lists the rules in effect for the players
+func (r Rules) Describe() []string {
+	var rules []string
+
+	switch r.SequencesToWin {
+	case 0:
+		rules = append(rules, "2 sequences to win, 1 with three colors")
+	case 1:
+		rules = append(rules, "1 sequence to win")
+	default:
+		rules = append(rules, fmt.Sprintf("%v sequences to win", r.SequencesToWin))
+	}
+
+	return append(rules, r.describePlay()...)
+}
+
+// describePlay lists the rules about making and breaking sequences
+func (r Rules) describePlay() []string {
+	rules := []string{fmt.Sprintf("sequences of %v chips", r.Length())}
+
+	if r.NoCorners {
+		rules = append(rules, "corners are not wild")
+	} else {
+		rules = append(rules, "corners are wild")
+	}
+	if r.NoOverlap {
+		rules = append(rules, "sequences can't share a chip")
+	} else {
+		rules = append(rules, "sequences can share one chip")
+	}
+	if r.RemoveLocked {
+		rules = append(rules, "one eyed jacks can break a sequence")
+	}
+
+	return rules
+}
@@ -1,8 +1,104 @@
 package internal
 
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spacesedan/go-sequence/internal/game"
+	"github.com/spacesedan/go-sequence/internal/services"
+)
+
+// Visibility decides if a lobby is listed in the lobby directory
+type Visibility string
+
+const (
+	VisibilityPrivate Visibility = "private"
+	VisibilityPublic  Visibility = "public"
+)
+
+// limits of the lobby settings, the number of players depends on the game
+// mode
+const (
+	MinHandCards = 3
+	MaxHandCards = 10
+	// MaxTeamPlayers is the most players a team game seats
+	MaxTeamPlayers = 12
+)
 
 type Settings struct {
-	NumOfPlayers int `json:"num_of_players"`
-	MaxHandSize  int `json:"max_hand_size"`
-	Teams        bool
+	NumOfPlayers int        `json:"num_of_players"`
+	MaxHandSize  int        `json:"max_hand_size"`
+	Teams        bool       `json:"teams"`
+	Visibility   Visibility `json:"visibility"`
+	// Ranked games change the rating of the players, the settings of a ranked
+	// lobby are fixed when it is created
+	Ranked bool `json:"ranked"`
+	// BestOf is the number of games in a series, lobbies play single games
+	// unless a series is asked for
+	BestOf int `json:"best_of,omitempty"`
+	// Rules are the house rules every game of the lobby is played with
+	Rules game.Rules `json:"rules"`
+	// Mode is the name of the game mode, empty plays the classic game
+	Mode string `json:"mode,omitempty"`
+}
+
+// IsPublic lobbies are listed in the directory and used for quick match,
+// lobbies without a visibility are private
+func (s Settings) IsPublic() bool {
+	return s.Visibility == VisibilityPublic
+}
+
+// Validate reports every setting a lobby can't be created with
+func (s Settings) Validate() error {
+	var problems []string
+
+	mode, err := game.ModeByName(s.Mode)
+	if err != nil {
+		problems = append(problems, services.Message(err))
+	} else if s.Teams {
+		if len(s.TeamCounts(mode)) == 0 {
+			problems = append(problems, fmt.Sprintf("%v players can't be split into even teams of two or more, up to %v players", s.NumOfPlayers, MaxTeamPlayers))
+		}
+	} else if min, max := mode.Seats(); s.NumOfPlayers < min || s.NumOfPlayers > max {
+		problems = append(problems, fmt.Sprintf("the number of players must be between %v and %v", min, max))
+	}
+	if s.Ranked && s.NumOfPlayers < 2 {
+		problems = append(problems, "games played alone can't be ranked")
+	}
+	if s.MaxHandSize < MinHandCards || s.MaxHandSize > MaxHandCards {
+		problems = append(problems, fmt.Sprintf("the hand size must be between %v and %v", MinHandCards, MaxHandCards))
+	}
+	switch s.Visibility {
+	case "", VisibilityPrivate, VisibilityPublic:
+	default:
+		problems = append(problems, fmt.Sprintf("unknown visibility %q", s.Visibility))
+	}
+	if s.BestOf < 0 || s.BestOf > MaxBestOf || (s.BestOf > 0 && s.BestOf%2 == 0) {
+		problems = append(problems, fmt.Sprintf("a series must be an odd number of games up to %v", MaxBestOf))
+	}
+	if err := s.Rules.Validate(); err != nil {
+		problems = append(problems, services.Message(err))
+	}
+
+	if len(problems) > 0 {
+		return services.NewErrorf(services.ErrorCodeInvalidArgument, "%v", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// TeamCounts returns the numbers of teams of two or more players the players
+// of a team game can be split into evenly in mode
+func (s Settings) TeamCounts(mode game.Mode) []int {
+	if s.NumOfPlayers > MaxTeamPlayers {
+		return nil
+	}
+
+	var counts []int
+	min, max := mode.Seats()
+	for teams := min; teams <= max; teams++ {
+		if teams > 1 && s.NumOfPlayers >= 2*teams && s.NumOfPlayers%teams == 0 {
+			counts = append(counts, teams)
+		}
+	}
+	return counts
 }
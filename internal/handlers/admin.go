@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/spacesedan/go-sequence/internal/lobby"
+)
+
+// AdminHandler serves the admin area, every route needs the admin token as a
+// bearer token or as the basic auth password
+type AdminHandler struct {
+	LobbyManager *lobby.LobbyManager
+	token        string
+}
+
+func NewAdminHandler(lm *lobby.LobbyManager, token string) *AdminHandler {
+	return &AdminHandler{
+		LobbyManager: lm,
+		token:        token,
+	}
+}
+
+// Register adds the admin routes, nothing is added without a token
+func (a AdminHandler) Register(r *chi.Mux) {
+	if a.token == "" {
+		return
+	}
+
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(a.requireToken)
+
+		r.Get("/", a.handleLobbies)
+		r.Get("/lobbies", a.handleLobbies)
+		r.Get("/lobbies/{lobbyID}", a.handleLobby)
+		r.Post("/lobbies/{lobbyID}/close", a.handleCloseLobby)
+		r.Post("/lobbies/{lobbyID}/players/{playerID}/kick", a.handleKickPlayer)
+	})
+}
+
+func (a AdminHandler) requireToken(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			_, token, _ = r.BasicAuth()
+		}
+
+		if subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="sequence admin"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// handleLobbies lists every lobby with its players, state, age and last
+// activity
+func (a AdminHandler) handleLobbies(w http.ResponseWriter, r *http.Request) {
+	lobbies, err := a.LobbyManager.AdminLobbies()
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	render.JSON(w, http.StatusOK, map[string]any{"lobbies": lobbies})
+}
+
+// handleLobby sends the whole stored state of a lobby
+func (a AdminHandler) handleLobby(w http.ResponseWriter, r *http.Request) {
+	state, err := a.LobbyManager.AdminLobby(chi.URLParam(r, "lobbyID"))
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	render.JSON(w, http.StatusOK, state)
+}
+
+func (a AdminHandler) handleCloseLobby(w http.ResponseWriter, r *http.Request) {
+	if err := a.LobbyManager.AdminCloseLobby(chi.URLParam(r, "lobbyID")); err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (a AdminHandler) handleKickPlayer(w http.ResponseWriter, r *http.Request) {
+	err := a.LobbyManager.AdminKickPlayer(chi.URLParam(r, "lobbyID"), chi.URLParam(r, "playerID"))
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
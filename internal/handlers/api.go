@@ -0,0 +1,516 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/spacesedan/go-sequence/internal"
+	"github.com/spacesedan/go-sequence/internal/game"
+	"github.com/spacesedan/go-sequence/internal/lobby"
+	"github.com/spacesedan/go-sequence/internal/services"
+)
+
+// APIPrefix is where the versioned JSON api is mounted, it runs next to the
+// htmx routes and shares their session cookie
+const APIPrefix = "/api/v1"
+
+// IdentityRequest picks a display name, a random one is generated when it is
+// left empty
+type IdentityRequest struct {
+	DisplayName string `json:"display_name,omitempty"`
+}
+
+// CreateLobbyRequest holds the settings of a new lobby, lobbies with a
+// password are always private
+type CreateLobbyRequest struct {
+	internal.Settings
+	Password string `json:"password,omitempty"`
+}
+
+// JoinLobbyRequest needs the password or an invite token for password
+// protected lobbies
+type JoinLobbyRequest struct {
+	Password string `json:"password,omitempty"`
+	Invite   string `json:"invite,omitempty"`
+}
+
+// PublicPlayer is a player as every other player sees them, hands are left out
+type PublicPlayer struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Color    string `json:"color"`
+	Ready    bool   `json:"ready"`
+}
+
+// LobbyDetails is a lobby as the api shows it
+type LobbyDetails struct {
+	ID          string            `json:"id"`
+	State       string            `json:"state"`
+	Settings    internal.Settings `json:"settings"`
+	Host        string            `json:"host"`
+	HasPassword bool              `json:"has_password"`
+	Players     []PublicPlayer    `json:"players"`
+	// Series is the score of the games played in the lobby
+	Series *internal.Series `json:"series,omitempty"`
+}
+
+// LobbyList lists the public lobbies, open lobbies come first
+type LobbyList struct {
+	Lobbies []LobbyListing `json:"lobbies"`
+}
+
+// LobbyListing is a lobby in the lobby list
+type LobbyListing struct {
+	ID       string            `json:"id"`
+	State    string            `json:"state"`
+	Players  int               `json:"players"`
+	Open     bool              `json:"open"`
+	Settings internal.Settings `json:"settings"`
+}
+
+// JoinedLobby tells a player where to connect once they got into a lobby, the
+// websocket takes the seat
+type JoinedLobby struct {
+	Lobby        LobbyDetails `json:"lobby"`
+	WebsocketURL string       `json:"websocket_url"`
+	Protocol     string       `json:"protocol"`
+}
+
+// GameState is what every player can see of a game
+type GameState struct {
+	LobbyID        string           `json:"lobby_id"`
+	Turn           string           `json:"turn"`
+	Board          []lobby.CellData `json:"board"`
+	Sequences      map[string]int   `json:"sequences"`
+	SequencesToWin int              `json:"sequences_to_win"`
+	GameOver       bool             `json:"game_over"`
+	WinnerColor    string           `json:"winner_color,omitempty"`
+	Players        []PublicPlayer   `json:"players"`
+}
+
+// ErrorResponse is the body of every api error
+type ErrorResponse struct {
+	Error lobby.ErrorData `json:"error"`
+}
+
+var ErrNoGame = services.NewErrorf(services.ErrorCodeNotFound, "No game is being played in this lobby")
+
+// APIHandler serves the JSON api, players are identified by the same session
+// as the htmx routes
+type APIHandler struct {
+	LobbyManager *lobby.LobbyManager
+	sessions     *Sessions
+	logger       *slog.Logger
+	limits       *Limits
+	// websocketURL returns the url a player connects to a lobby with
+	websocketURL func(lobbyID string) string
+}
+
+func NewAPIHandler(lm *lobby.LobbyManager, s *Sessions, l *slog.Logger, limits *Limits, websocketURL func(lobbyID string) string) *APIHandler {
+	return &APIHandler{
+		LobbyManager: lm,
+		sessions:     s,
+		logger:       l,
+		limits:       limits,
+		websocketURL: websocketURL,
+	}
+}
+
+func (a APIHandler) routes() []apiRoute {
+	return []apiRoute{
+		{
+			method:   http.MethodPost,
+			pattern:  "/identity",
+			summary:  "Pick a display name",
+			request:  IdentityRequest{},
+			response: Identity{},
+			status:   http.StatusOK,
+			handler:  a.handleIdentity,
+		},
+		{
+			method:   http.MethodGet,
+			pattern:  "/lobbies",
+			summary:  "List the public lobbies",
+			response: LobbyList{},
+			status:   http.StatusOK,
+			handler:  a.handleListLobbies,
+		},
+		{
+			method:   http.MethodPost,
+			pattern:  "/lobbies",
+			summary:  "Create a lobby",
+			auth:     true,
+			limit:    limitCreateLobby,
+			request:  CreateLobbyRequest{},
+			response: LobbyDetails{},
+			status:   http.StatusCreated,
+			handler:  a.handleCreateLobby,
+		},
+		{
+			method:   http.MethodGet,
+			pattern:  "/lobbies/{lobbyID}",
+			summary:  "Get a lobby",
+			response: LobbyDetails{},
+			status:   http.StatusOK,
+			handler:  a.handleGetLobby,
+		},
+		{
+			method:   http.MethodPost,
+			pattern:  "/lobbies/{lobbyID}/join",
+			summary:  "Join a lobby, the seat is taken once the websocket connects",
+			auth:     true,
+			limit:    limitJoinLobby,
+			request:  JoinLobbyRequest{},
+			response: JoinedLobby{},
+			status:   http.StatusOK,
+			handler:  a.handleJoinLobby,
+		},
+		{
+			method:  http.MethodPost,
+			pattern: "/lobbies/{lobbyID}/leave",
+			summary: "Leave a lobby",
+			auth:    true,
+			status:  http.StatusNoContent,
+			handler: a.handleLeaveLobby,
+		},
+		{
+			method:   http.MethodGet,
+			pattern:  "/lobbies/{lobbyID}/game",
+			summary:  "Get the public state of the game",
+			response: GameState{},
+			status:   http.StatusOK,
+			handler:  a.handleGetGame,
+		},
+		{
+			method:   http.MethodGet,
+			pattern:  "/lobbies/{lobbyID}/hand",
+			summary:  "Get my hand",
+			auth:     true,
+			response: lobby.HandData{},
+			status:   http.StatusOK,
+			handler:  a.handleGetHand,
+		},
+	}
+}
+
+// Register mounts the api and its OpenAPI document
+func (a APIHandler) Register(r *chi.Mux) {
+	routes := a.routes()
+	doc := openAPIDocument(APIPrefix, routes)
+
+	r.Route(APIPrefix, func(r chi.Router) {
+		for _, rt := range routes {
+			h := rt.handler
+			if rt.limit != "" {
+				h = a.limits.limit(rt.limit, a.sessions, writeAPIError)(h)
+			}
+			if rt.auth {
+				h = a.requireIdentity(h)
+			}
+			r.Method(rt.method, rt.pattern, h)
+		}
+
+		r.Get("/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+			render.JSON(w, http.StatusOK, doc)
+		})
+
+		r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+			writeJSONError(w, services.NewErrorf(services.ErrorCodeNotFound, "%v %v is not a route", r.Method, r.URL.Path))
+		})
+	})
+}
+
+// writeAPIError is writeJSONError for the rate limits
+func writeAPIError(w http.ResponseWriter, r *http.Request, err error) {
+	writeJSONError(w, err)
+}
+
+// requireIdentity rejects requests without an identity in their session
+func (a APIHandler) requireIdentity(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, err := a.sessions.Identity(r); err != nil {
+			writeJSONError(w, err)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// decode reads a JSON request body, an empty body leaves v as it is
+func decode(r *http.Request, v any) error {
+	if r.ContentLength == 0 {
+		return nil
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return services.WrapErrorf(err, services.ErrorCodeInvalidArgument, "the request body is not valid JSON")
+	}
+	return nil
+}
+
+func (a APIHandler) handleIdentity(w http.ResponseWriter, r *http.Request) {
+	var req IdentityRequest
+	if err := decode(r, &req); err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	var id Identity
+	var err error
+	if req.DisplayName == "" {
+		id, err = a.sessions.NewIdentity(r.Context())
+	} else {
+		var name string
+		if name, err = lobby.ValidateDisplayName(req.DisplayName); err != nil {
+			writeJSONError(w, err)
+			return
+		}
+		id, err = a.sessions.SetDisplayName(r.Context(), name)
+	}
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	if err := a.LobbyManager.TouchProfile(id.PlayerID, id.Username); err != nil {
+		a.logger.Error("APIHandler.handleIdentity",
+			slog.Group("failed to save profile",
+				slog.String("player_id", id.PlayerID),
+				slog.String("reason", err.Error())))
+	}
+
+	render.JSON(w, http.StatusOK, id)
+}
+
+func (a APIHandler) handleListLobbies(w http.ResponseWriter, r *http.Request) {
+	summaries := a.LobbyManager.ListPublicLobbies()
+
+	list := LobbyList{Lobbies: make([]LobbyListing, 0, len(summaries))}
+	for _, s := range summaries {
+		list.Lobbies = append(list.Lobbies, LobbyListing{
+			ID:       s.ID,
+			State:    s.CurrentState.String(),
+			Players:  s.Players,
+			Open:     s.Open(),
+			Settings: s.Settings,
+		})
+	}
+
+	render.JSON(w, http.StatusOK, list)
+}
+
+func (a APIHandler) handleCreateLobby(w http.ResponseWriter, r *http.Request) {
+	id, _ := a.sessions.Identity(r)
+
+	var req CreateLobbyRequest
+	if err := decode(r, &req); err != nil {
+		writeJSONError(w, err)
+		return
+	}
+	if err := req.Settings.Validate(); err != nil {
+		writeJSONError(w, err)
+		return
+	}
+	if req.Visibility == "" || req.Password != "" {
+		req.Visibility = internal.VisibilityPrivate
+	}
+
+	lobbyID, err := a.LobbyManager.NewLobby(req.Settings, req.Password)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+	a.logger.Info("APIHandler.handleCreateLobby",
+		slog.Group("new game lobby",
+			slog.String("lobby_id", lobbyID),
+			slog.String("player_id", id.PlayerID)))
+
+	// the creator doesn't need to send the password they just set
+	if req.Password != "" {
+		l, ok := a.LobbyManager.LobbyExists(lobbyID)
+		if !ok {
+			writeJSONError(w, lobby.ErrLobbyNotFound)
+			return
+		}
+		if err := l.Admit(id.PlayerID); err != nil {
+			writeJSONError(w, err)
+			return
+		}
+	}
+
+	details, err := a.lobbyDetails(lobbyID)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	render.JSON(w, http.StatusCreated, details)
+}
+
+func (a APIHandler) handleGetLobby(w http.ResponseWriter, r *http.Request) {
+	l, err := a.visibleLobby(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	details, err := a.lobbyDetails(l.ID)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	render.JSON(w, http.StatusOK, details)
+}
+
+func (a APIHandler) handleJoinLobby(w http.ResponseWriter, r *http.Request) {
+	id, _ := a.sessions.Identity(r)
+
+	var req JoinLobbyRequest
+	if err := decode(r, &req); err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	l, ok := a.LobbyManager.LobbyExists(chi.URLParam(r, "lobbyID"))
+	if !ok {
+		writeJSONError(w, lobby.ErrLobbyNotFound)
+		return
+	}
+	if err := l.CanJoin(id.PlayerID); err != nil {
+		writeJSONError(w, err)
+		return
+	}
+	if err := a.LobbyManager.Authorize(l, id.PlayerID, req.Password, req.Invite); err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	details, err := a.lobbyDetails(l.ID)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	render.JSON(w, http.StatusOK, JoinedLobby{
+		Lobby:        details,
+		WebsocketURL: a.websocketURL(l.ID),
+		Protocol:     lobby.ProtocolJSONV1,
+	})
+}
+
+func (a APIHandler) handleLeaveLobby(w http.ResponseWriter, r *http.Request) {
+	id, _ := a.sessions.Identity(r)
+
+	if err := a.LobbyManager.Leave(chi.URLParam(r, "lobbyID"), id.PlayerID); err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a APIHandler) handleGetGame(w http.ResponseWriter, r *http.Request) {
+	l, err := a.visibleLobby(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+
+	state, err := a.LobbyManager.LobbyState(l.ID)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+	if state.CurrentState != internal.InGame || state.Board == nil || state.Game == nil {
+		writeJSONError(w, ErrNoGame)
+		return
+	}
+
+	render.JSON(w, http.StatusOK, GameState{
+		LobbyID:        state.ID,
+		Turn:           state.Turn,
+		Board:          lobby.NewBoardData(*state.Board).Cells,
+		Sequences:      state.Game.Sequences,
+		SequencesToWin: state.Game.SequencesToWin,
+		GameOver:       state.Game.GameOver,
+		WinnerColor:    state.Game.WinnerColor,
+		Players:        publicPlayers(state.Players),
+	})
+}
+
+func (a APIHandler) handleGetHand(w http.ResponseWriter, r *http.Request) {
+	id, _ := a.sessions.Identity(r)
+
+	state, err := a.LobbyManager.LobbyState(chi.URLParam(r, "lobbyID"))
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+	if state.CurrentState != internal.InGame {
+		writeJSONError(w, ErrNoGame)
+		return
+	}
+	ps, ok := state.Players[id.PlayerID]
+	if !ok {
+		writeJSONError(w, lobby.ErrPlayerNotFound)
+		return
+	}
+
+	hand := lobby.HandData{Cards: ps.Hand}
+	if hand.Cards == nil {
+		hand.Cards = []game.Card{}
+	}
+	render.JSON(w, http.StatusOK, hand)
+}
+
+// visibleLobby returns the lobby of the request, password protected lobbies
+// are only shown to the players that got past the password
+func (a APIHandler) visibleLobby(r *http.Request) (*lobby.Lobby, error) {
+	l, ok := a.LobbyManager.LobbyExists(chi.URLParam(r, "lobbyID"))
+	if !ok {
+		return nil, lobby.ErrLobbyNotFound
+	}
+
+	id, _ := a.sessions.Identity(r)
+	if !l.CanEnter(id.PlayerID) {
+		return nil, lobby.ErrPasswordRequired
+	}
+	return l, nil
+}
+
+func (a APIHandler) lobbyDetails(lobbyID string) (LobbyDetails, error) {
+	state, err := a.LobbyManager.LobbyState(lobbyID)
+	if err != nil {
+		return LobbyDetails{}, err
+	}
+
+	return LobbyDetails{
+		ID:          state.ID,
+		State:       state.CurrentState.String(),
+		Settings:    state.Settings,
+		Host:        state.Host,
+		HasPassword: state.PasswordHash != "",
+		Players:     publicPlayers(state.Players),
+		Series:      state.Series,
+	}, nil
+}
+
+// publicPlayers lists the players by name without their hands
+func publicPlayers(players map[string]*internal.Player) []PublicPlayer {
+	public := make([]PublicPlayer, 0, len(players))
+	for _, ps := range players {
+		public = append(public, PublicPlayer{
+			ID:       ps.ID,
+			Username: ps.Username,
+			Color:    ps.Color,
+			Ready:    ps.Ready,
+		})
+	}
+	sort.Slice(public, func(i, j int) bool { return public[i].Username < public[j].Username })
+
+	return public
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/spacesedan/go-sequence/internal/lobby"
+	"github.com/spacesedan/go-sequence/internal/pubsub"
+	"github.com/spacesedan/go-sequence/internal/services"
+	"github.com/spacesedan/go-sequence/internal/views/components"
+)
+
+// handleListLobbies renders the public lobby directory
+func (lm *LobbyHandler) handleListLobbies(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	err := components.LobbyList(lm.LobbyManager.ListPublicLobbies()).Render(r.Context(), w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleLobbyListWS keeps the lobby directory up to date, the list is sent
+// again every time a lobby publishes to pubsub.DirectoryTopic
+func (lm *LobbyHandler) handleLobbyListWS(w http.ResponseWriter, r *http.Request) {
+	ws, err := lm.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer ws.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	updates, leave := lm.directory.join()
+	defer leave()
+
+	// the browser never sends anything, reading is only used to notice when
+	// the page is closed
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(b []byte) error {
+		ws.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		return ws.WriteMessage(websocket.TextMessage, b)
+	}
+
+	b, err := lm.directory.render(ctx)
+	if err != nil {
+		return
+	}
+	if err := send(b); err != nil {
+		return
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case b := <-updates:
+			if err := send(b); err != nil {
+				lm.logger.Info("lobbyHandler.handleLobbyListWS",
+					slog.Group("closing lobby list socket",
+						slog.String("reason", err.Error())))
+				return
+			}
+		}
+	}
+}
+
+// directoryFeed renders the lobby directory once per update and hands it to
+// every lobby list socket, it only listens to pubsub.DirectoryTopic while
+// someone is watching
+type directoryFeed struct {
+	lm     *lobby.LobbyManager
+	ps     pubsub.PubSub
+	logger *slog.Logger
+
+	mu      sync.Mutex
+	viewers map[chan []byte]struct{}
+	cancel  context.CancelFunc
+}
+
+func newDirectoryFeed(lm *lobby.LobbyManager, ps pubsub.PubSub, l *slog.Logger) *directoryFeed {
+	return &directoryFeed{
+		lm:      lm,
+		ps:      ps,
+		logger:  l,
+		viewers: make(map[chan []byte]struct{}),
+	}
+}
+
+// render returns the lobby list as the directory shows it
+func (f *directoryFeed) render(ctx context.Context) ([]byte, error) {
+	var b bytes.Buffer
+	if err := components.LobbyList(f.lm.ListPublicLobbies()).Render(ctx, &b); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// join returns the channel the rendered list is sent to after every update,
+// leave has to be called once the viewer is gone
+func (f *directoryFeed) join() (<-chan []byte, func()) {
+	// viewers only care about the latest list
+	updates := make(chan []byte, 1)
+
+	f.mu.Lock()
+	f.viewers[updates] = struct{}{}
+	if len(f.viewers) == 1 {
+		ctx, cancel := context.WithCancel(context.Background())
+		f.cancel = cancel
+		go f.run(ctx, f.ps.Subscribe(ctx, pubsub.DirectoryTopic))
+	}
+	f.mu.Unlock()
+
+	leave := func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		delete(f.viewers, updates)
+		if len(f.viewers) == 0 {
+			f.cancel()
+		}
+	}
+
+	return updates, leave
+}
+
+// run renders the list for every update until the last viewer left
+func (f *directoryFeed) run(ctx context.Context, sub pubsub.Subscription) {
+	defer sub.Close()
+
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+
+			b, err := f.render(ctx)
+			if err != nil {
+				f.logger.Error("directoryFeed.run",
+					slog.Group("failed to render lobby list",
+						slog.String("reason", err.Error())))
+				continue
+			}
+
+			f.mu.Lock()
+			for updates := range f.viewers {
+				// replace a list the viewer didn't get to yet
+				select {
+				case <-updates:
+				default:
+				}
+				updates <- b
+			}
+			f.mu.Unlock()
+		}
+	}
+}
+
+// handleQuickMatch drops the player into the fullest open public lobby or
+// creates a new one
+func (lm *LobbyHandler) handleQuickMatch(w http.ResponseWriter, r *http.Request) {
+	if _, err := lm.sessions.Identity(r); err != nil {
+		lm.handlePromptUserToGenerateUsername(w, r)
+		return
+	}
+
+	// num_of_players is optional, without it any open lobby is a match
+	var numOfPlayers int
+	if v := r.FormValue("num_of_players"); v != "" {
+		var err error
+		if numOfPlayers, err = strconv.Atoi(v); err != nil {
+			writeError(w, r, services.WrapErrorf(err, services.ErrorCodeInvalidArgument, "the number of players must be a number"))
+			return
+		}
+	}
+
+	lobbyID, err := lm.LobbyManager.QuickMatch(numOfPlayers)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	lm.logger.Info("Quick match", slog.String("lobby-id", lobbyID))
+
+	w.Header().Set("HX-Redirect", fmt.Sprintf("/lobby/%v", lobbyID))
+	render.Text(w, http.StatusSeeOther, "")
+}
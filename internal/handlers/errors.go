@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/spacesedan/go-sequence/internal/lobby"
+	"github.com/spacesedan/go-sequence/internal/services"
+	"github.com/spacesedan/go-sequence/internal/views/components"
+)
+
+// writeError sends err with the status of its code. htmx requests and browsers
+// get a toast, clients asking for JSON get the same error data as the
+// websocket error event.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	if wantsJSON(r) {
+		writeJSONError(w, err)
+		return
+	}
+
+	data := lobby.NewErrorData(err)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(services.CodeOf(err).HTTPStatus())
+	components.ToastComponent(data.Title, data.Message).Render(r.Context(), w)
+}
+
+// writeJSONError is writeError for the routes that only speak JSON
+func writeJSONError(w http.ResponseWriter, err error) {
+	render.JSON(w, services.CodeOf(err).HTTPStatus(), ErrorResponse{Error: lobby.NewErrorData(err)})
+}
+
+// wantsJSON reports whether the client asked for JSON instead of html
+func wantsJSON(r *http.Request) bool {
+	return r.Header.Get("HX-Request") == "" &&
+		strings.Contains(r.Header.Get("Accept"), "application/json")
+}
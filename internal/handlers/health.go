@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-redis/redis/v8"
+
+	"github.com/spacesedan/go-sequence/internal/lobby"
+)
+
+// how long the readiness check waits for redis
+const readyTimeout = time.Second
+
+type HealthHandler struct {
+	// redisClient is nil when the server runs without redis
+	redisClient  *redis.Client
+	LobbyManager *lobby.LobbyManager
+}
+
+func NewHealthHandler(r *redis.Client, lm *lobby.LobbyManager) *HealthHandler {
+	return &HealthHandler{
+		redisClient:  r,
+		LobbyManager: lm,
+	}
+}
+
+func (h HealthHandler) Register(r *chi.Mux) {
+	r.Get("/healthz", h.handleHealth)
+	r.Get("/readyz", h.handleReady)
+}
+
+// handleHealth answers as long as the process is up
+func (h HealthHandler) handleHealth(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReady reports whether the server can take players, redis has to be
+// reachable and the lobby manager running
+func (h HealthHandler) handleReady(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]string{}
+	status := http.StatusOK
+
+	if h.redisClient != nil {
+		ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+		defer cancel()
+
+		checks["redis"] = "ok"
+		if err := h.redisClient.Ping(ctx).Err(); err != nil {
+			checks["redis"] = err.Error()
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	checks["lobby_manager"] = "ok"
+	if !h.LobbyManager.Running() {
+		checks["lobby_manager"] = "not running"
+		status = http.StatusServiceUnavailable
+	}
+
+	result := "ok"
+	if status != http.StatusOK {
+		result = "unavailable"
+	}
+
+	render.JSON(w, status, map[string]any{
+		"status": result,
+		"checks": checks,
+	})
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/spacesedan/go-sequence/internal"
+	"github.com/spacesedan/go-sequence/internal/services"
+	"github.com/spacesedan/go-sequence/internal/views"
+)
+
+// number of players shown on a leaderboard
+const leaderboardLimit = 50
+
+// handleLeaderboardPage renders the leaderboard of the period in the query,
+// all time is shown by default
+func (v ViewHandler) handleLeaderboardPage(w http.ResponseWriter, r *http.Request) {
+	period := internal.LeaderboardPeriod(r.URL.Query().Get("period"))
+	if !period.Valid() {
+		period = internal.LeaderboardAllTime
+	}
+
+	entries, err := v.LobbyManager.Leaderboard(period, leaderboardLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	err = views.MainLayout("Leaderboard", views.LeaderboardPage(period, entries)).
+		Render(r.Context(), w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleLeaderboard sends the leaderboard of a period as JSON
+func (v ViewHandler) handleLeaderboard(w http.ResponseWriter, r *http.Request) {
+	period := internal.LeaderboardPeriod(chi.URLParam(r, "period"))
+	if !period.Valid() {
+		writeJSONError(w, services.NewErrorf(services.ErrorCodeInvalidArgument, "period must be daily, weekly or all_time"))
+		return
+	}
+
+	entries, err := v.LobbyManager.Leaderboard(period, leaderboardLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, http.StatusOK, map[string]any{
+		"period":  period,
+		"entries": entries,
+	})
+}
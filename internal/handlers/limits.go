@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/spacesedan/go-sequence/internal/lobby"
+	"github.com/spacesedan/go-sequence/internal/metrics"
+	"github.com/spacesedan/go-sequence/internal/ratelimit"
+	"github.com/spacesedan/go-sequence/internal/services"
+)
+
+var ErrRateLimited = services.NewErrorf(services.ErrorCodeRateLimited, "You're doing that too often; wait a moment and try again")
+
+// Limits protect the handlers from players flooding the server, nil limiters
+// don't limit anything
+type Limits struct {
+	CreateLobby *ratelimit.Limiter
+	JoinLobby   *ratelimit.Limiter
+	WsMessages  *ratelimit.Limiter
+	// MaxMessageSize is the largest websocket message a player can send
+	MaxMessageSize int64
+	// AllowedOrigins may open websockets besides the origin of the server
+	// itself, * allows every origin
+	AllowedOrigins []string
+	// TrustProxy reads the address of players from X-Forwarded-For
+	TrustProxy bool
+}
+
+// the limits routes can be put behind, the names are also the metric labels
+const (
+	limitCreateLobby = "create_lobby"
+	limitJoinLobby   = "join_lobby"
+)
+
+func (l *Limits) limiter(name string) *ratelimit.Limiter {
+	switch name {
+	case limitCreateLobby:
+		return l.CreateLobby
+	case limitJoinLobby:
+		return l.JoinLobby
+	}
+	return nil
+}
+
+// limit rejects requests once the player or their address ran out of tokens,
+// fail writes the error the way the route sends errors
+func (l *Limits) limit(name string, sessions *Sessions, fail func(http.ResponseWriter, *http.Request, error)) func(http.HandlerFunc) http.HandlerFunc {
+	limiter := l.limiter(name)
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			// players without an identity are only limited by their address
+			id, _ := sessions.Identity(r)
+
+			if !limiter.Allow(id.PlayerID, l.ClientIP(r), time.Now()) {
+				metrics.RateLimited.WithLabelValues(name).Inc()
+				fail(w, r, ErrRateLimited)
+				return
+			}
+			next(w, r)
+		}
+	}
+}
+
+// ClientIP is the address the request came from
+func (l *Limits) ClientIP(r *http.Request) string {
+	if l.TrustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// checkOrigin lets websockets be opened from the server's own origin and the
+// allowed origins. Requests without an origin don't come from a browser so
+// there is no page that could be abusing the player's session.
+func (l *Limits) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	for _, allowed := range l.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *Limits) upgrader() *websocket.Upgrader {
+	return &websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		// browsers don't ask for a subprotocol and keep the html fragments
+		Subprotocols: []string{lobby.ProtocolJSONV1},
+		CheckOrigin:  l.checkOrigin,
+	}
+}
@@ -7,43 +7,59 @@ import (
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/go-redis/redis/v8"
 	"github.com/gorilla/websocket"
 	"github.com/spacesedan/go-sequence/internal"
 	"github.com/spacesedan/go-sequence/internal/client"
+	"github.com/spacesedan/go-sequence/internal/db"
+	"github.com/spacesedan/go-sequence/internal/game"
 	"github.com/spacesedan/go-sequence/internal/lobby"
+	"github.com/spacesedan/go-sequence/internal/pubsub"
+	"github.com/spacesedan/go-sequence/internal/services"
 	"github.com/spacesedan/go-sequence/internal/views/components"
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-
-		return true
-	},
-}
-
 type LobbyHandler struct {
 	LobbyManager *lobby.LobbyManager
-	redisClient  *redis.Client
+	clientRepo   db.ClientRepo
+	ps           pubsub.PubSub
+	sessions     *Sessions
 	logger       *slog.Logger
+	limits       *Limits
+	upgrader     *websocket.Upgrader
+	directory    *directoryFeed
+	// absoluteURL turns a path into the url players share with each other
+	absoluteURL func(path string) string
 }
 
-func NewLobbyHandler(r *redis.Client, lm *lobby.LobbyManager, l *slog.Logger) *LobbyHandler {
+func NewLobbyHandler(repo db.ClientRepo, ps pubsub.PubSub, lm *lobby.LobbyManager, s *Sessions, l *slog.Logger, limits *Limits, absoluteURL func(path string) string) *LobbyHandler {
 	return &LobbyHandler{
 		LobbyManager: lm,
-		redisClient:  r,
+		clientRepo:   repo,
+		ps:           ps,
+		sessions:     s,
 		logger:       l,
+		limits:       limits,
+		upgrader:     limits.upgrader(),
+		directory:    newDirectoryFeed(lm, ps, l),
+		absoluteURL:  absoluteURL,
 	}
 }
 
 func (lh *LobbyHandler) Register(m *chi.Mux) {
+	create := lh.limits.limit(limitCreateLobby, lh.sessions, writeError)
+	join := lh.limits.limit(limitJoinLobby, lh.sessions, writeError)
+
 	m.Route("/lobby", func(r chi.Router) {
-		r.HandleFunc("/ws", lh.Serve)
+		r.HandleFunc("/ws", join(lh.Serve))
+		r.Get("/schema/v1.json", lh.handleSchema)
+		r.Get("/list", lh.handleListLobbies)
+		r.HandleFunc("/list/ws", lh.handleLobbyListWS)
+		r.Post("/quick-match", join(lh.handleQuickMatch))
 		r.Get("/generate_username", lh.handleGenerateUsername)
-		r.Post("/create", lh.handleCreateGameLobby)
-		r.Post("/join", lh.handleJoinLobby)
+		r.Post("/display-name", lh.handleSetDisplayName)
+		r.Post("/create", create(lh.handleCreateGameLobby))
+		r.Post("/join", join(lh.handleJoinLobby))
+		r.Get("/invite", lh.handleInviteLink)
 
 		lobbyHTMXGroup := r.Group(nil)
 		lobbyHTMXGroup.Route("/view", func(r chi.Router) {
@@ -58,28 +74,43 @@ func (lm *LobbyHandler) Serve(w http.ResponseWriter, r *http.Request) {
 
 	lobbyId := r.URL.Query().Get("lobby-id")
 
-	username, err := getUsernameFromCookie(r)
+	// the player is authenticated through their session, the session cookie
+	// is sent along with the upgrade request
+	id, err := lm.sessions.Identity(r)
 	if err != nil {
-		w.Header().Set("HX-Redirect", "/")
-		render.Text(w, http.StatusSeeOther, "")
+		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
 
-	// check to see if the lobby exists, if it doesn't send to home page
+	// check to see if the lobby exists and has a seat for the player
 	l, ok := lm.LobbyManager.LobbyExists(lobbyId)
 	if !ok {
-		http.Redirect(w, r, "/", http.StatusSeeOther)
-		render.Text(w, http.StatusSeeOther, "")
+		writeError(w, r, lobby.ErrLobbyNotFound)
 		return
 	}
 
-	ws, err := upgrader.Upgrade(w, r, nil)
+	if err := l.CanJoin(id.PlayerID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	// password protected lobbies only accept players that already got in
+	// through /lobby/join or hold an invite
+	if err := lm.LobbyManager.Authorize(l, id.PlayerID, "", r.URL.Query().Get("invite")); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	ws, err := lm.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		return
 	}
 
-	ok = l.HasPlayer(username)
-	session := client.NewWsClient(ws, lm.redisClient, lm.logger, username, l.ID)
+	session := client.NewWsClient(ws, lm.clientRepo, lm.ps, lm.logger, id.PlayerID, id.Username, l.ID, client.Limits{
+		MaxMessageSize: lm.limits.MaxMessageSize,
+		Messages:       lm.limits.WsMessages,
+		RemoteIP:       lm.limits.ClientIP(r),
+	})
 
     // registers to the lobby
     go session.ReadPump()
@@ -92,24 +123,79 @@ func (lm *LobbyHandler) handleCreateGameLobby(w http.ResponseWriter, r *http.Req
 	// get the settings
 	numberOfPlayersString := r.FormValue("num_of_players")
 	maxHandSizeString := r.FormValue("max_hand_size")
+	visibility := internal.Visibility(r.FormValue("visibility"))
+	password := r.FormValue("password")
+	ranked := r.FormValue("ranked") == "true"
+	bestOfString := r.FormValue("best_of")
+	rulesPreset := r.FormValue("rules")
+	mode := r.FormValue("mode")
+	// password protected lobbies are never listed
+	if visibility != internal.VisibilityPublic || password != "" {
+		visibility = internal.VisibilityPrivate
+	}
 
 	numOfPlayers, err := strconv.Atoi(numberOfPlayersString)
 	if err != nil {
+		writeError(w, r, services.WrapErrorf(err, services.ErrorCodeInvalidArgument, "the number of players must be a number"))
 		return
 	}
 	maxHandSize, err := strconv.Atoi(maxHandSizeString)
 	if err != nil {
+		writeError(w, r, services.WrapErrorf(err, services.ErrorCodeInvalidArgument, "the hand size must be a number"))
 		return
 	}
+	var bestOf int
+	if bestOfString != "" {
+		if bestOf, err = strconv.Atoi(bestOfString); err != nil {
+			writeError(w, r, services.WrapErrorf(err, services.ErrorCodeInvalidArgument, "the series length must be a number"))
+			return
+		}
+	}
 
-	// create the lobby
-	lobbyId := lm.LobbyManager.NewLobby(internal.Settings{
+	// lobbies play the standard rules unless a preset is picked
+	var rules game.Rules
+	if rulesPreset != "" {
+		if rules, err = game.PresetRules(rulesPreset); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+
+	settings := internal.Settings{
 		NumOfPlayers: numOfPlayers,
 		MaxHandSize:  maxHandSize,
-	})
+		Visibility:   visibility,
+		Ranked:       ranked,
+		BestOf:       bestOf,
+		Rules:        rules,
+		Mode:         mode,
+	}
+	if err := settings.Validate(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	// create the lobby
+	lobbyId, err := lm.LobbyManager.NewLobby(settings, password)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
 
 	lm.logger.Info("New game lobby", slog.String("lobby-id", lobbyId))
 
+	// the creator doesn't need to type the password they just set
+	if password != "" {
+		l, ok := lm.LobbyManager.LobbyExists(lobbyId)
+		if !ok {
+			writeError(w, r, lobby.ErrLobbyNotFound)
+			return
+		}
+		if id, err := lm.sessions.Identity(r); err == nil {
+			l.Admit(id.PlayerID)
+		}
+	}
+
 	// Redirect to the lobby page after it has been created
 	w.Header().Set("HX-Redirect", fmt.Sprintf("/lobby/%s", lobbyId))
 
@@ -120,16 +206,24 @@ func (lm *LobbyHandler) handleJoinLobby(w http.ResponseWriter, r *http.Request)
 
 	l, exists := lm.LobbyManager.LobbyExists(lobbyID)
 	if !exists {
-		content := "make sure you entered a valid lobby id"
-		topic := "Lobby not found"
-		components.ToastComponent(topic, content).Render(r.Context(), w)
+		writeError(w, r, lobby.ErrLobbyNotFound)
+		return
+	}
+
+	id, err := lm.sessions.Identity(r)
+	if err != nil {
+		lm.handlePromptUserToGenerateUsername(w, r)
+		return
+	}
+
+	if err := l.CanJoin(id.PlayerID); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	if len(l.Players) == l.Settings.NumOfPlayers {
-		topic := "Lobby full"
-		content := "cannot join lobby, already at max capacity"
-		components.ToastComponent(topic, content).Render(r.Context(), w)
+	err = lm.LobbyManager.Authorize(l, id.PlayerID, r.FormValue("password"), r.FormValue("invite"))
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
 
@@ -140,17 +234,86 @@ func (lm *LobbyHandler) handleJoinLobby(w http.ResponseWriter, r *http.Request)
 
 // GenerateUsername generates a username and stores the value in the session.
 func (lm *LobbyHandler) handleGenerateUsername(w http.ResponseWriter, r *http.Request) {
-	_, userCookie := generateUserCookie()
-
-	http.SetCookie(w, userCookie)
 	// add the username to the session
+	id, err := lm.sessions.NewIdentity(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	lm.touchProfile(id)
+	sendIdentity(w, id)
+}
 
+// handleSetDisplayName lets a player pick the name other players see, the name
+// is kept in the session and used for every lobby they join after
+func (lm *LobbyHandler) handleSetDisplayName(w http.ResponseWriter, r *http.Request) {
+	name, err := lobby.ValidateDisplayName(r.FormValue("display_name"))
+	if err != nil {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		components.DisplayNameForm(r.FormValue("display_name"), err.Error()).Render(r.Context(), w)
+		return
+	}
+
+	id, err := lm.sessions.SetDisplayName(r.Context(), name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	lm.touchProfile(id)
+	sendIdentity(w, id)
+}
+
+// touchProfile keeps the stored profile in sync with the session, a failure
+// only means the profile page shows an older name
+func (lm *LobbyHandler) touchProfile(id Identity) {
+	if err := lm.LobbyManager.TouchProfile(id.PlayerID, id.Username); err != nil {
+		lm.logger.Error("LobbyHandler.touchProfile",
+			slog.Group("failed to save profile",
+				slog.String("player_id", id.PlayerID),
+				slog.String("reason", err.Error())))
+	}
+}
+
+// sendIdentity sends the player back to the home page. The browser reads the
+// name from the page, other clients only get an opaque session cookie so the
+// identity is sent along as headers.
+func sendIdentity(w http.ResponseWriter, id Identity) {
+	w.Header().Set("X-Player-Id", id.PlayerID)
+	w.Header().Set("X-Username", id.Username)
 	w.Header().Set("HX-Redirect", "/")
 
 	// send the response back to the client
 	render.Text(w, http.StatusSeeOther, "")
 }
 
+// handleInviteLink sends a fresh signed invite link to a player already in the
+// lobby
+func (lm *LobbyHandler) handleInviteLink(w http.ResponseWriter, r *http.Request) {
+	id, err := lm.sessions.Identity(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	l, ok := lm.LobbyManager.LobbyExists(r.URL.Query().Get("lobby-id"))
+	if !ok || !l.CanEnter(id.PlayerID) {
+		writeError(w, r, lobby.ErrLobbyNotFound)
+		return
+	}
+
+	link := lm.absoluteURL(lm.LobbyManager.InviteLink(l.ID))
+
+	components.InviteLink(link).Render(r.Context(), w)
+}
+
+// handleSchema publishes the JSON schema of the sequence.v1+json subprotocol
+func (lm *LobbyHandler) handleSchema(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.Write(lobby.SchemaV1)
+}
+
 func (lm *LobbyHandler) handlePromptUserToGenerateUsername(w http.ResponseWriter, r *http.Request) {
 	topic := "Generate a username first."
 	content := `this site work better when you have a username click on "generate username" to get yours`
@@ -1,10 +1,16 @@
 package handlers
 
-import "net/http"
+import (
+	"net/http"
 
-func CheckUsernameCookie(next http.Handler) http.Handler {
+	"github.com/gorilla/websocket"
+)
+
+// RequireIdentity sends players without an identity in their session back to
+// the home page
+func (s *Sessions) RequireIdentity(next http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
-		_, err := r.Cookie("username")
+		_, err := s.Identity(r)
 		if err != nil {
 			http.Redirect(w, r, "/", http.StatusSeeOther)
 		} else {
@@ -14,3 +20,32 @@ func CheckUsernameCookie(next http.Handler) http.Handler {
 
 	return http.HandlerFunc(fn)
 }
+
+// LoadAndSave loads the request session and saves any changes made to it.
+// Websocket upgrades only load the session, the connection is hijacked so
+// nothing can be written to the response once the handler returns.
+func (s *Sessions) LoadAndSave(next http.Handler) http.Handler {
+	save := s.SessionManager.LoadAndSave(next)
+
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if !websocket.IsWebSocketUpgrade(r) {
+			save.ServeHTTP(w, r)
+			return
+		}
+
+		var token string
+		if cookie, err := r.Cookie(s.Cookie.Name); err == nil {
+			token = cookie.Value
+		}
+
+		ctx, err := s.Load(r.Context(), token)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+
+	return http.HandlerFunc(fn)
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"encoding"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spacesedan/go-sequence/internal/lobby"
+)
+
+// apiRoute is a route of the JSON api, the router and the OpenAPI document
+// are both built from the routes so they can't drift apart
+type apiRoute struct {
+	method  string
+	pattern string
+	summary string
+	// auth routes need a player identity in the session
+	auth bool
+	// limit names the rate limit of the route, empty for none
+	limit string
+	// request and response are zero values of the body types, nil when the
+	// route has no body
+	request  any
+	response any
+	status   int
+	handler  http.HandlerFunc
+}
+
+// pathParam matches the chi url parameters of a route pattern
+var pathParam = regexp.MustCompile(`{([^}:]+)(:[^}]*)?}`)
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// openAPIDocument describes the routes mounted under prefix as an OpenAPI 3.1
+// document, the schemas are generated from the request and response types
+func openAPIDocument(prefix string, routes []apiRoute) map[string]any {
+	g := schemaGenerator{schemas: map[string]any{}}
+	errorSchema := g.schema(reflect.TypeOf(ErrorResponse{}))
+
+	paths := map[string]map[string]any{}
+	for _, rt := range routes {
+		path := prefix + pathParam.ReplaceAllString(rt.pattern, "{$1}")
+
+		responses := map[string]any{
+			"default": map[string]any{
+				"description": "error",
+				"content":     jsonContent(errorSchema),
+			},
+		}
+		response := map[string]any{"description": http.StatusText(rt.status)}
+		if rt.response != nil {
+			response["content"] = jsonContent(g.schema(reflect.TypeOf(rt.response)))
+		}
+		responses[strconv.Itoa(rt.status)] = response
+
+		op := map[string]any{
+			"summary":     rt.summary,
+			"operationId": operationID(rt),
+			"responses":   responses,
+		}
+
+		var params []map[string]any
+		for _, m := range pathParam.FindAllStringSubmatch(rt.pattern, -1) {
+			params = append(params, map[string]any{
+				"name":     m[1],
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]any{"type": "string"},
+			})
+		}
+		if params != nil {
+			op["parameters"] = params
+		}
+
+		if rt.request != nil {
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content":  jsonContent(g.schema(reflect.TypeOf(rt.request))),
+			}
+		}
+		if rt.auth {
+			op["security"] = []map[string][]string{{"session": {}}}
+		}
+
+		if paths[path] == nil {
+			paths[path] = map[string]any{}
+		}
+		paths[path][strings.ToLower(rt.method)] = op
+	}
+
+	return map[string]any{
+		"openapi": "3.1.0",
+		"info": map[string]any{
+			"title":   "sequence",
+			"version": lobby.SchemaVersion,
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": g.schemas,
+			"securitySchemes": map[string]any{
+				"session": map[string]any{
+					"type": "apiKey",
+					"in":   "cookie",
+					"name": "session",
+				},
+			},
+		},
+	}
+}
+
+// operationID names a route after its method and the static parts of its
+// path, POST /lobbies/{lobbyID}/join becomes postLobbiesJoin
+func operationID(rt apiRoute) string {
+	id := strings.ToLower(rt.method)
+	for _, part := range strings.FieldsFunc(pathParam.ReplaceAllString(rt.pattern, ""), func(r rune) bool {
+		return r == '/' || r == '.' || r == '-'
+	}) {
+		id += strings.ToUpper(part[:1]) + part[1:]
+	}
+	return id
+}
+
+func jsonContent(schema any) map[string]any {
+	return map[string]any{"application/json": map[string]any{"schema": schema}}
+}
+
+// schemaGenerator builds JSON schemas from go types the same way
+// encoding/json encodes them, named structs are kept in schemas and
+// referenced
+type schemaGenerator struct {
+	schemas map[string]any
+}
+
+func (g schemaGenerator) schema(t reflect.Type) any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t.Implements(textMarshalerType):
+		return map[string]any{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		if _, ok := g.schemas[t.Name()]; !ok {
+			// reserve the name first so recursive types end
+			g.schemas[t.Name()] = nil
+			g.schemas[t.Name()] = g.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	default:
+		return map[string]any{}
+	}
+}
+
+// object builds the schema of a struct, fields without omitempty are required
+// and embedded structs without a json name are flattened
+func (g schemaGenerator) object(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	var required []string
+
+	var addFields func(t reflect.Type)
+	addFields = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if tag == "-" || (!f.IsExported() && !f.Anonymous) {
+				continue
+			}
+
+			name, opts, _ := strings.Cut(tag, ",")
+			if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+				addFields(f.Type)
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+
+			properties[name] = g.schema(f.Type)
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+	}
+	addFields(t)
+
+	schema := map[string]any{"type": "object", "properties": properties}
+	if required != nil {
+		schema["required"] = required
+	}
+	return schema
+}
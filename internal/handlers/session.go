@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Pallinder/go-randomdata"
+	"github.com/alexedwards/scs/redisstore"
+	"github.com/alexedwards/scs/v2"
+	"github.com/alexedwards/scs/v2/memstore"
+	"github.com/gomodule/redigo/redis"
+	"github.com/google/uuid"
+
+	"github.com/spacesedan/go-sequence/internal/services"
+)
+
+const (
+	sessionPlayerIDKey = "player_id"
+	sessionUsernameKey = "username"
+)
+
+var ErrNoIdentity = services.NewErrorf(services.ErrorCodeUnauthorized, "no player identity in session")
+
+// Identity who a request belongs to. The PlayerID never changes for the life
+// of the session, the Username is the display name the player picked.
+type Identity struct {
+	PlayerID string `json:"player_id"`
+	Username string `json:"username"`
+}
+
+// Sessions keeps player identity in server side sessions, the browser only
+// holds an opaque session token so it can't pretend to be somebody else
+type Sessions struct {
+	*scs.SessionManager
+}
+
+// NewRedisSessionStore keeps the sessions in redis so every replica shares them
+func NewRedisSessionStore(pool *redis.Pool) scs.Store {
+	return redisstore.New(pool)
+}
+
+// NewMemorySessionStore keeps the sessions in the process, they are lost on
+// restart
+func NewMemorySessionStore() scs.Store {
+	return memstore.New()
+}
+
+// NewSessions keeps player identities for lifetime after they were last set,
+// secure cookies are only sent over https
+func NewSessions(store scs.Store, lifetime time.Duration, secure bool) *Sessions {
+	sm := scs.New()
+	sm.Store = store
+	sm.Lifetime = lifetime
+	sm.Cookie.Name = "session"
+	sm.Cookie.HttpOnly = true
+	sm.Cookie.Secure = secure
+	sm.Cookie.SameSite = http.SameSiteLaxMode
+	sm.Cookie.Persist = true
+
+	return &Sessions{sm}
+}
+
+// Identity returns the identity stored in the request session
+func (s *Sessions) Identity(r *http.Request) (Identity, error) {
+	id := Identity{
+		PlayerID: s.GetString(r.Context(), sessionPlayerIDKey),
+		Username: s.GetString(r.Context(), sessionUsernameKey),
+	}
+
+	if id.PlayerID == "" || id.Username == "" {
+		return Identity{}, ErrNoIdentity
+	}
+
+	return id, nil
+}
+
+// NewIdentity gives the session a fresh random username, a player id is only
+// created when the session doesn't have one yet
+func (s *Sessions) NewIdentity(ctx context.Context) (Identity, error) {
+	return s.SetDisplayName(ctx, generateUsername())
+}
+
+// SetDisplayName stores an already validated display name in the session, a
+// player id is created when the session doesn't have one yet
+func (s *Sessions) SetDisplayName(ctx context.Context, username string) (Identity, error) {
+	// new token on every identity change to prevent session fixation
+	if err := s.RenewToken(ctx); err != nil {
+		return Identity{}, err
+	}
+
+	playerID := s.GetString(ctx, sessionPlayerIDKey)
+	if playerID == "" {
+		playerID = uuid.NewString()
+		s.Put(ctx, sessionPlayerIDKey, playerID)
+	}
+
+	s.Put(ctx, sessionUsernameKey, username)
+
+	return Identity{PlayerID: playerID, Username: username}, nil
+}
+
+func generateUsername() string {
+	randomNumber := randomdata.Number(42069)
+	randomName := randomdata.SillyName()
+
+	return fmt.Sprintf("%s%d", randomName, randomNumber)
+}
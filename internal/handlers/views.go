@@ -2,12 +2,14 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-redis/redis/v8"
+	"github.com/spacesedan/go-sequence/internal/db"
 	"github.com/spacesedan/go-sequence/internal/lobby"
 	"github.com/spacesedan/go-sequence/internal/views"
 )
@@ -17,15 +19,25 @@ import (
 type ViewHandler struct {
 	LobbyManager *lobby.LobbyManager
 	redisClient  *redis.Client
+	sessions     *Sessions
+	store        db.Store
+	// websocketURL returns the url the browser connects to a lobby with
+	websocketURL func(lobbyID string) string
 }
 
-func NewViewHandler(r *redis.Client, lm *lobby.LobbyManager) *ViewHandler {
+func NewViewHandler(r *redis.Client, lm *lobby.LobbyManager, s *Sessions, store db.Store, websocketURL func(lobbyID string) string) *ViewHandler {
 	return &ViewHandler{
 		LobbyManager: lm,
 		redisClient:  r,
+		sessions:     s,
+		store:        store,
+		websocketURL: websocketURL,
 	}
 }
 
+// number of matches shown on a profile page
+const profileMatchLimit = 20
+
 // valid lobby ids are made up of 4 characters that contain any configuration
 // of this regex
 const lobbyIdRegex string = `[0-9A-Z]{4}`
@@ -34,20 +46,23 @@ func (v ViewHandler) Register(r *chi.Mux) {
 	r.Get("/", v.handleIndexPage)
 
 	lobbyGroup := r.Group(nil)
-	lobbyGroup.Use(CheckUsernameCookie)
+	lobbyGroup.Use(v.sessions.RequireIdentity)
 	lobbyGroup.Get("/lobby-create", v.handleCreateLobbyPage)
 	lobbyGroup.Get(fmt.Sprintf("/lobby/{lobbyID:%s}", lobbyIdRegex), v.handleLobbyPage)
+	lobbyGroup.Get("/profile", v.handleOwnProfilePage)
+
+	r.Get("/profile/{playerID}", v.handleProfilePage)
+	r.Get("/leaderboard", v.handleLeaderboardPage)
+	r.Get("/leaderboard/{period}", v.handleLeaderboard)
 }
 
 func (v ViewHandler) handleIndexPage(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content/Type", "text/html; charset=utf-8")
 
-	userCookie, _ := r.Cookie("username")
-
 	var userName string
 
-	if userCookie != nil {
-		userName = userCookie.Value
+	if id, err := v.sessions.Identity(r); err == nil {
+		userName = id.Username
 	}
 
 	err := views.MainLayout("Sequence Web", views.IndexPage(userName)).
@@ -70,21 +85,27 @@ func (v ViewHandler) handleCreateLobbyPage(w http.ResponseWriter, r *http.Reques
 }
 
 func (v ViewHandler) handleLobbyPage(w http.ResponseWriter, r *http.Request) {
-	_, err := getUsernameFromCookie(r)
+	id, err := v.sessions.Identity(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
 	}
-
 	lobbyID := chi.URLParam(r, "lobbyID")
 	lobbyID = strings.Trim(lobbyID, " ")
-	_, exists := v.LobbyManager.LobbyExists(lobbyID)
+	l, exists := v.LobbyManager.LobbyExists(lobbyID)
 
 	if !exists {
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
-	connectionUrl := createWebsocketConnectionString(lobbyID)
+	// invite links carry a token that skips the lobby password
+	if err := v.LobbyManager.Authorize(l, id.PlayerID, "", r.URL.Query().Get("invite")); err != nil {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	connectionUrl := v.websocketURL(lobbyID)
 
 	// err = views.
 	// 	MainLayoutWithWs(fmt.Sprintf("Lobby %s", lobbyID), views.LobbyPage(connectionUrl, lobbyID, username)).
@@ -97,3 +118,49 @@ func (v ViewHandler) handleLobbyPage(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
+
+// handleOwnProfilePage sends the player to their own profile
+func (v ViewHandler) handleOwnProfilePage(w http.ResponseWriter, r *http.Request) {
+	id, err := v.sessions.Identity(r)
+	if err != nil {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	http.Redirect(w, r, "/profile/"+id.PlayerID, http.StatusSeeOther)
+}
+
+// handleProfilePage shows a player's name and their recent matches
+func (v ViewHandler) handleProfilePage(w http.ResponseWriter, r *http.Request) {
+	playerID := chi.URLParam(r, "playerID")
+
+	profile, err := v.store.GetProfile(playerID)
+	if errors.Is(err, db.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	matches, err := v.store.ListMatches(playerID, profileMatchLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rating, err := v.LobbyManager.Rating(playerID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	err = views.MainLayout(profile.DisplayName, views.ProfilePage(profile, rating, matches)).
+		Render(r.Context(), w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
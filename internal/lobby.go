@@ -1,32 +1,82 @@
 package internal
 
+import (
+	"time"
+
+	"github.com/spacesedan/go-sequence/internal/game"
+)
+
 // Current state ... are the players in the lobby still choosing thier colors,
-// or are they in the game
+// or are they in the game. A lobby goes from created to waiting (InLobby) once
+// the first player joins, to the game and to finished once the game ends, it
+// can be closed from any state.
 type CurrentState uint
 
+// the values are stored with the lobby, new states go at the end
 const (
 	Unknown CurrentState = iota
 	InLobby
 	InGame
+	Created
+	Finished
+	Closed
 )
 
 // String get a stringified version of the current game state
 func (c CurrentState) String() string {
 	switch c {
+	case Created:
+		return "created"
 	case InLobby:
 		return "lobby"
 	case InGame:
 		return "game"
+	case Finished:
+		return "finished"
+	case Closed:
+		return "closed"
 	default:
 		return "unknown"
 
 	}
 }
 
+// Waiting reports whether the players are in the lobby choosing their colors
+// and getting ready, which they do before the first game and after every game
+func (c CurrentState) Waiting() bool {
+	return c == Created || c == InLobby || c == Finished
+}
+
 type Lobby struct {
 	ID              string
 	CurrentState    CurrentState
 	Players         map[string]*Player
 	ColorsAvailable map[string]bool
 	Settings        Settings
+	// Host is the player allowed to moderate the lobby, the first player to
+	// join becomes the host
+	Host  string
+	Muted map[string]bool
+	// PasswordHash is empty for lobbies anyone with the id can join, the
+	// players that got past it are kept in a separate set
+	PasswordHash string `json:",omitempty"`
+	// Board and Turn, the id of the player that plays next, are only set
+	// during a game
+	Board *game.Board `json:",omitempty"`
+	Turn  string      `json:",omitempty"`
+	// Game, Seats, which map game player ids to player ids, and MatchStartedAt
+	// let a game be resumed after a restart
+	Game           *game.State       `json:",omitempty"`
+	Seats          map[string]string `json:",omitempty"`
+	MatchStartedAt time.Time         `json:",omitempty"`
+	// CreatedAt and LastActivity, the last time a player sent something, are
+	// shown in the admin area
+	CreatedAt    time.Time `json:",omitempty"`
+	LastActivity time.Time `json:",omitempty"`
+	// Series is the score of the games played so far, SeatOrder the player
+	// ids in the turn order of the last game and Rematch the players that
+	// voted to play again
+	Series    *Series         `json:",omitempty"`
+	SeatOrder []string        `json:",omitempty"`
+	Rematch   map[string]bool `json:",omitempty"`
 }
@@ -0,0 +1,183 @@
+package lobby
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/spacesedan/go-sequence/internal/services"
+)
+
+var (
+	ErrPasswordRequired = services.NewErrorf(services.ErrorCodeForbidden, "this lobby is private, enter its password to join")
+	ErrWrongPassword    = services.NewErrorf(services.ErrorCodeForbidden, "the password you entered is not correct")
+	ErrInvalidInvite    = services.NewErrorf(services.ErrorCodeForbidden, "the invite link you used is not valid")
+	ErrExpiredInvite    = services.NewErrorf(services.ErrorCodeForbidden, "the invite link has expired, ask the host for a new one")
+	ErrPasswordTooLong  = services.NewErrorf(services.ErrorCodeInvalidArgument, "a lobby password can be at most %v bytes long", MaxPasswordLength)
+)
+
+// MaxPasswordLength is the longest password bcrypt hashes
+const MaxPasswordLength = 72
+
+// DefaultInviteTTL how long an invite link stays valid
+const DefaultInviteTTL = 24 * time.Hour
+
+// InviteSigner creates and checks signed invite tokens, a valid token lets a
+// player into a lobby without knowing its password
+type InviteSigner struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// NewInviteSigner creates a signer using secret, a random secret is generated
+// when none is given which means links stop working after a restart
+func NewInviteSigner(secret []byte, ttl time.Duration) (*InviteSigner, error) {
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+	}
+
+	return &InviteSigner{secret: secret, ttl: ttl}, nil
+}
+
+// Sign returns an invite token for the lobby that expires after the signer ttl
+func (s *InviteSigner) Sign(lobbyID string, now time.Time) string {
+	payload := fmt.Sprintf("%v|%v", lobbyID, now.Add(s.ttl).Unix())
+
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) +
+		"." +
+		base64.RawURLEncoding.EncodeToString(s.mac(payload))
+}
+
+// Verify checks that token was signed by us for the lobby and hasn't expired
+func (s *InviteSigner) Verify(token, lobbyID string, now time.Time) error {
+	encPayload, encMac, ok := strings.Cut(token, ".")
+	if !ok {
+		return ErrInvalidInvite
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encPayload)
+	if err != nil {
+		return ErrInvalidInvite
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(encMac)
+	if err != nil {
+		return ErrInvalidInvite
+	}
+
+	if !hmac.Equal(mac, s.mac(string(payload))) {
+		return ErrInvalidInvite
+	}
+
+	id, exp, ok := strings.Cut(string(payload), "|")
+	if !ok || id != lobbyID {
+		return ErrInvalidInvite
+	}
+
+	expiresAt, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return ErrInvalidInvite
+	}
+
+	if now.Unix() > expiresAt {
+		return ErrExpiredInvite
+	}
+
+	return nil
+}
+
+func (s *InviteSigner) mac(payload string) []byte {
+	m := hmac.New(sha256.New, s.secret)
+	m.Write([]byte(payload))
+	return m.Sum(nil)
+}
+
+// hashPassword returns a bcrypt hash of the password
+func hashPassword(password string) (string, error) {
+	if len(password) > MaxPasswordLength {
+		return "", ErrPasswordTooLong
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", services.WrapErrorf(err, services.ErrorCodeUnknown, "bcrypt.GenerateFromPassword")
+	}
+	return string(hash), nil
+}
+
+// checkPassword compares a password with a hash created by hashPassword, in
+// constant time
+func checkPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// HasPassword reports whether the lobby is password protected
+func (l *Lobby) HasPassword() bool {
+	l.accessMu.Lock()
+	defer l.accessMu.Unlock()
+
+	return l.PasswordHash != ""
+}
+
+// Admit lets a player into the lobby without asking for the password again,
+// admissions are stored in redis so every replica sees them
+func (l *Lobby) Admit(playerID string) error {
+	return l.lobbyRepo.Admit(l.ID, playerID)
+}
+
+// CanEnter reports whether a player already got past the lobby password
+func (l *Lobby) CanEnter(playerID string) bool {
+	if !l.HasPassword() {
+		return true
+	}
+
+	ok, err := l.lobbyRepo.IsAdmitted(l.ID, playerID)
+	return err == nil && ok
+}
+
+// Authorize checks a player's password or invite token and admits them to the
+// lobby when one of them is valid
+func (m *LobbyManager) Authorize(l *Lobby, playerID, password, invite string) error {
+	if l.CanEnter(playerID) {
+		return nil
+	}
+
+	// a stale invite still lets the player in with the password
+	if invite != "" {
+		err := m.invites.Verify(invite, l.ID, time.Now())
+		if err == nil {
+			return l.Admit(playerID)
+		}
+		if password == "" {
+			return err
+		}
+	}
+
+	if password == "" {
+		return ErrPasswordRequired
+	}
+
+	l.accessMu.Lock()
+	ok := checkPassword(l.PasswordHash, password)
+	l.accessMu.Unlock()
+
+	if !ok {
+		return ErrWrongPassword
+	}
+
+	return l.Admit(playerID)
+}
+
+// InviteLink returns a signed path that lets anyone holding it into the lobby
+func (m *LobbyManager) InviteLink(lobbyID string) string {
+	return fmt.Sprintf("/lobby/%v?invite=%v", lobbyID, m.invites.Sign(lobbyID, time.Now()))
+}
@@ -0,0 +1,99 @@
+package lobby
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spacesedan/go-sequence/internal/db"
+	"github.com/spacesedan/go-sequence/internal/pubsub"
+)
+
+func TestInviteSigner(t *testing.T) {
+	s, err := NewInviteSigner([]byte("secret"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	token := s.Sign("ABCD", now)
+
+	if err := s.Verify(token, "ABCD", now); err != nil {
+		t.Errorf("Expected token to be valid, got %v", err)
+	}
+
+	if err := s.Verify(token, "WXYZ", now); !errors.Is(err, ErrInvalidInvite) {
+		t.Errorf("Expected token to be rejected for another lobby, got %v", err)
+	}
+
+	if err := s.Verify(token, "ABCD", now.Add(2*time.Hour)); !errors.Is(err, ErrExpiredInvite) {
+		t.Errorf("Expected token to expire, got %v", err)
+	}
+
+	other, _ := NewInviteSigner([]byte("other secret"), time.Hour)
+	if err := other.Verify(token, "ABCD", now); !errors.Is(err, ErrInvalidInvite) {
+		t.Errorf("Expected token signed with another secret to be rejected, got %v", err)
+	}
+
+	if err := s.Verify("garbage", "ABCD", now); !errors.Is(err, ErrInvalidInvite) {
+		t.Errorf("Expected garbage to be rejected, got %v", err)
+	}
+}
+
+func TestPasswordHash(t *testing.T) {
+	hash, err := hashPassword("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !checkPassword(hash, "hunter2") {
+		t.Error("Expected the password to match its hash")
+	}
+
+	if checkPassword(hash, "hunter3") {
+		t.Error("Expected a different password not to match")
+	}
+
+	other, _ := hashPassword("hunter2")
+	if other == hash {
+		t.Error("Expected hashes of the same password to be salted differently")
+	}
+
+	if _, err := hashPassword(strings.Repeat("a", MaxPasswordLength+1)); !errors.Is(err, ErrPasswordTooLong) {
+		t.Errorf("Expected a long password to be rejected, got %v", err)
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	invites, err := NewInviteSigner([]byte("secret"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewLobbyManager(db.NewMemoryRepos(logger), pubsub.NewMemory(), logger, DefaultChatPolicy, invites, nil)
+	t.Cleanup(func() { m.Shutdown(context.Background()) })
+
+	id, err := m.NewLobby(DevLobbySettings, "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, _ := m.LobbyExists(id)
+	expired := invites.Sign(id, time.Now().Add(-2*time.Hour))
+
+	if err := m.Authorize(l, "ada", "", expired); !errors.Is(err, ErrExpiredInvite) {
+		t.Errorf("Expected the expired invite to be reported, got %v", err)
+	}
+	if err := m.Authorize(l, "ada", "hunter3", expired); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("Expected the password to be checked, got %v", err)
+	}
+	if err := m.Authorize(l, "ada", "hunter2", expired); err != nil || !l.CanEnter("ada") {
+		t.Errorf("Expected the password to let ada in, got %v", err)
+	}
+	if err := m.Authorize(l, "grace", "", invites.Sign(id, time.Now())); err != nil || !l.CanEnter("grace") {
+		t.Errorf("Expected the invite to let grace in, got %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package lobby
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/spacesedan/go-sequence/internal"
+	"github.com/spacesedan/go-sequence/internal/pubsub"
+	"github.com/spacesedan/go-sequence/internal/services"
+)
+
+// AdminLobby is a lobby as listed in the admin area
+type AdminLobby struct {
+	ID    string `json:"id"`
+	State string `json:"state"`
+	// Owner is the replica running the lobby, empty while nobody does
+	Owner        string             `json:"owner"`
+	Host         string             `json:"host"`
+	Settings     internal.Settings  `json:"settings"`
+	Players      []*internal.Player `json:"players"`
+	CreatedAt    time.Time          `json:"created_at"`
+	Age          string             `json:"age"`
+	LastActivity time.Time          `json:"last_activity"`
+}
+
+// AdminLobbies lists every stored lobby, whichever replica runs it
+func (m *LobbyManager) AdminLobbies() ([]AdminLobby, error) {
+	ids, err := m.lobbyRepo.ListLobbyIDs()
+	if err != nil {
+		return nil, services.WrapErrorf(err, services.ErrorCodeUnknown, "lobbyRepo.ListLobbyIDs")
+	}
+	sort.Strings(ids)
+
+	lobbies := make([]AdminLobby, 0, len(ids))
+	for _, id := range ids {
+		state, err := m.lobbyRepo.GetLobby(id)
+		if err != nil {
+			// the lobby closed while listing
+			continue
+		}
+
+		owner, err := m.registry.LeaseOwner(id)
+		if err != nil {
+			m.logger.Error("LobbyManager.AdminLobbies",
+				slog.Group("failed to read lease owner",
+					slog.String("lobby_id", id),
+					slog.String("reason", err.Error())))
+		}
+
+		lobbies = append(lobbies, AdminLobby{
+			ID:           state.ID,
+			State:        state.CurrentState.String(),
+			Owner:        owner,
+			Host:         state.Host,
+			Settings:     state.Settings,
+			Players:      sortedPlayers(state.Players),
+			CreatedAt:    state.CreatedAt,
+			Age:          time.Since(state.CreatedAt).Round(time.Second).String(),
+			LastActivity: state.LastActivity,
+		})
+	}
+
+	return lobbies, nil
+}
+
+// AdminLobby returns the full stored state of a lobby, the password hash is
+// left out
+func (m *LobbyManager) AdminLobby(id string) (*internal.Lobby, error) {
+	state, err := m.LobbyState(id)
+	if err != nil {
+		return nil, err
+	}
+	state.PasswordHash = ""
+
+	return state, nil
+}
+
+// AdminCloseLobby closes a lobby and disconnects its players. The replica
+// running the lobby closes it, lobbies nobody runs are deleted right away.
+func (m *LobbyManager) AdminCloseLobby(id string) error {
+	state, err := m.AdminLobby(id)
+	if err != nil {
+		return err
+	}
+
+	owner, err := m.registry.LeaseOwner(id)
+	if err != nil {
+		return services.WrapErrorf(err, services.ErrorCodeUnknown, "registry.LeaseOwner")
+	}
+	if owner == "" {
+		playerIDs := make([]string, 0, len(state.Players))
+		for playerID := range state.Players {
+			playerIDs = append(playerIDs, playerID)
+		}
+		m.deleteLobby(id, playerIDs)
+		m.publishDirectoryUpdate(id)
+		return nil
+	}
+
+	return m.publishPayload(id, pubsub.AdminChannel, WsPayload{Action: AdminClosePayloadEvent})
+}
+
+// AdminKickPlayer removes a player from a lobby and disconnects them
+func (m *LobbyManager) AdminKickPlayer(id, playerID string) error {
+	state, err := m.AdminLobby(id)
+	if err != nil {
+		return err
+	}
+	if _, ok := state.Players[playerID]; !ok {
+		return ErrPlayerNotFound
+	}
+
+	return m.publishPayload(id, pubsub.AdminChannel, WsPayload{Action: AdminKickPayloadEvent, PlayerID: playerID})
+}
+
+// publishPayload sends a payload to the replica running the lobby
+func (m *LobbyManager) publishPayload(id string, c pubsub.LobbyChannel, p WsPayload) error {
+	b, err := p.MarshalBinary()
+	if err != nil {
+		return services.WrapErrorf(err, services.ErrorCodeUnknown, "WsPayload.MarshalBinary")
+	}
+
+	if err := m.ps.Publish(context.Background(), pubsub.LobbyTopic(id, c), b); err != nil {
+		return services.WrapErrorf(err, services.ErrorCodeUnknown, "pubsub.Publish")
+	}
+	return nil
+}
+
+func sortedPlayers(players map[string]*internal.Player) []*internal.Player {
+	sorted := make([]*internal.Player, 0, len(players))
+	for _, ps := range players {
+		sorted = append(sorted, ps)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Username < sorted[j].Username })
+
+	return sorted
+}
+
+// AdminAction handles the actions sent from the admin area, it reports whether
+// the lobby should close
+func (h *lobbyHandler) AdminAction(p WsPayload) bool {
+	h.logger.Info("lobbyHandler.AdminAction",
+		slog.Group("handling admin action",
+			slog.String("lobby_id", h.lobby.ID),
+			slog.String("action", string(p.Action))))
+
+	switch p.Action {
+	case AdminClosePayloadEvent:
+		h.NotifyClosed("The lobby was closed by an admin")
+		return true
+	case AdminKickPayloadEvent:
+		h.kick(p.PlayerID)
+	}
+
+	return false
+}
+
+// kick removes a player for good, they lose their seat instead of keeping it
+// for a reconnect
+func (h *lobbyHandler) kick(playerID string) {
+	h.removePlayer(playerID, PlayerKickedResponseEvent, "%v was removed by an admin")
+}
+
+// removePlayer drops a player and their stored data and tells everyone with
+// action, format gets the player's name
+func (h *lobbyHandler) removePlayer(playerID string, action ResponseEvent, format string) {
+	if !h.lobby.HasPlayer(playerID) {
+		return
+	}
+	name := h.displayName(playerID)
+
+	h.DeregisterPlayer(WsPayload{PlayerID: playerID})
+	h.lobby.lobbyRepo.DeletePlayer(h.lobby.ID, playerID)
+
+	if err := h.publishResponse(WsResponse{
+		Action:         action,
+		Message:        fmt.Sprintf(format, name),
+		Sender:         playerID,
+		ConnectedUsers: h.svc.GetPlayerIDs(),
+	}); err != nil {
+		h.lobby.errorChan <- err
+	}
+
+	h.forfeit(playerID, name)
+}
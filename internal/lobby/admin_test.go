@@ -0,0 +1,43 @@
+package lobby
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/spacesedan/go-sequence/internal"
+	"github.com/spacesedan/go-sequence/internal/db"
+	"github.com/spacesedan/go-sequence/internal/pubsub"
+)
+
+func TestAdminCloseOrphanedLobby(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	repos := db.NewMemoryRepos(logger)
+	m := NewLobbyManager(repos, pubsub.NewMemory(), logger, DefaultChatPolicy, nil, nil)
+
+	// a lobby left behind by a replica that went away
+	ada := &internal.Player{ID: "ada", Username: "ada"}
+	if err := repos.Lobby.SetLobby(&internal.Lobby{ID: "ABCD", Players: map[string]*internal.Player{ada.ID: ada}}); err != nil {
+		t.Fatal(err)
+	}
+	repos.Lobby.SetPlayer("ABCD", ada)
+	repos.Chat.AddMessage("ABCD", &internal.ChatMessage{SenderID: ada.ID, Sender: ada.Username, Message: "hi"}, 10)
+	repos.Registry.AddLobby("ABCD")
+
+	if err := m.AdminCloseLobby("ABCD"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := repos.Lobby.GetLobby("ABCD"); err == nil {
+		t.Error("Expected the lobby to be deleted")
+	}
+	if _, err := repos.Lobby.GetPlayer("ABCD", ada.ID); err == nil {
+		t.Error("Expected the players to be deleted")
+	}
+	if msgs, _ := repos.Chat.GetMessages("ABCD"); len(msgs) != 0 {
+		t.Errorf("Expected the chat to be deleted, got %v messages", len(msgs))
+	}
+	if ids, _ := repos.Registry.ListLobbies(); len(ids) != 0 {
+		t.Errorf("Expected the lobby to be unregistered, got %v", ids)
+	}
+}
@@ -0,0 +1,127 @@
+package lobby
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/spacesedan/go-sequence/internal/ratelimit"
+)
+
+// ChatPolicy controls what players are allowed to send to the lobby chat
+type ChatPolicy struct {
+	// MaxLength the max number of characters in a single message
+	MaxLength int
+	// HistorySize the number of messages kept per lobby and shown on join
+	HistorySize int
+	// Burst the number of messages a player can send back to back
+	Burst int
+	// Refill how long it takes to earn back a single message
+	Refill time.Duration
+	// BlockedWords words that get masked before a message is sent
+	BlockedWords []string
+}
+
+var DefaultChatPolicy = ChatPolicy{
+	MaxLength:   280,
+	HistorySize: 50,
+	Burst:       5,
+	Refill:      2 * time.Second,
+}
+
+// rate is the chat limit as a token bucket rate
+func (p ChatPolicy) rate() ratelimit.Rate {
+	return ratelimit.Rate{Burst: p.Burst, Every: time.Duration(p.Burst) * p.Refill}
+}
+
+var (
+	ErrChatEmpty        = errors.New("message is empty")
+	ErrChatTooLong      = errors.New("message is too long")
+	ErrChatControlChars = errors.New("message contains control characters")
+	ErrChatRateLimited  = errors.New("slow down, you are sending messages too fast")
+	ErrChatMuted        = errors.New("the host muted you")
+)
+
+// LoadBlockedWords reads a file with one blocked word per line, blank lines and
+// lines starting with # are ignored
+func LoadBlockedWords(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var words []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		w := strings.TrimSpace(sc.Text())
+		if w == "" || strings.HasPrefix(w, "#") {
+			continue
+		}
+		words = append(words, strings.ToLower(w))
+	}
+
+	return words, sc.Err()
+}
+
+// validate checks a message against the policy and returns the trimmed message
+func (c ChatPolicy) validate(msg string) (string, error) {
+	msg = strings.TrimSpace(msg)
+	if msg == "" {
+		return "", ErrChatEmpty
+	}
+
+	if !utf8.ValidString(msg) {
+		return "", ErrChatControlChars
+	}
+
+	if utf8.RuneCountInString(msg) > c.MaxLength {
+		return "", ErrChatTooLong
+	}
+
+	for _, r := range msg {
+		if r == '\n' || r == '\t' {
+			continue
+		}
+		if unicode.IsControl(r) {
+			return "", ErrChatControlChars
+		}
+	}
+
+	return msg, nil
+}
+
+// chatFilter masks blocked words with asterisks
+type chatFilter struct {
+	re *regexp.Regexp
+}
+
+func newChatFilter(words []string) *chatFilter {
+	if len(words) == 0 {
+		return &chatFilter{}
+	}
+
+	quoted := make([]string, 0, len(words))
+	for _, w := range words {
+		quoted = append(quoted, regexp.QuoteMeta(w))
+	}
+
+	return &chatFilter{
+		re: regexp.MustCompile(`(?i)\b(` + strings.Join(quoted, "|") + `)\b`),
+	}
+}
+
+func (f *chatFilter) clean(msg string) string {
+	if f.re == nil {
+		return msg
+	}
+
+	return f.re.ReplaceAllStringFunc(msg, func(w string) string {
+		return strings.Repeat("*", utf8.RuneCountInString(w))
+	})
+}
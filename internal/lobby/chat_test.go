@@ -0,0 +1,48 @@
+package lobby
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestChatPolicyValidate(t *testing.T) {
+	policy := ChatPolicy{MaxLength: 10}
+
+	testCases := []struct {
+		name string
+		msg  string
+		want string
+		err  error
+	}{
+		{name: "trims whitespace", msg: "  hello  ", want: "hello"},
+		{name: "allows newlines", msg: "hi\nthere", want: "hi\nthere"},
+		{name: "empty", msg: "   ", err: ErrChatEmpty},
+		{name: "too long", msg: strings.Repeat("a", 11), err: ErrChatTooLong},
+		{name: "control characters", msg: "bell\a", err: ErrChatControlChars},
+		{name: "invalid utf8", msg: "\xff", err: ErrChatControlChars},
+	}
+
+	for _, tc := range testCases {
+		got, err := policy.validate(tc.msg)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%v: expected error %v but got %v", tc.name, tc.err, err)
+		}
+		if got != tc.want {
+			t.Errorf("%v: expected %q but got %q", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestChatFilter(t *testing.T) {
+	f := newChatFilter([]string{"darn"})
+
+	got := f.clean("Darn it, darned")
+	if got != "**** it, darned" {
+		t.Errorf("Expected blocked words to be masked, got %q", got)
+	}
+
+	if newChatFilter(nil).clean("darn") != "darn" {
+		t.Error("Expected an empty filter to leave messages alone")
+	}
+}
@@ -0,0 +1,99 @@
+package lobby
+
+import (
+	"context"
+	"sort"
+
+	"github.com/spacesedan/go-sequence/internal"
+	"github.com/spacesedan/go-sequence/internal/pubsub"
+)
+
+// DefaultQuickMatchSettings are used when quick match can't find an open lobby
+var DefaultQuickMatchSettings = internal.Settings{
+	NumOfPlayers: 2,
+	MaxHandSize:  7,
+	Visibility:   internal.VisibilityPublic,
+}
+
+// LobbySummary is what the lobby directory shows about a lobby
+type LobbySummary struct {
+	ID           string                `json:"id"`
+	Players      int                   `json:"players"`
+	CurrentState internal.CurrentState `json:"current_state"`
+	Settings     internal.Settings     `json:"settings"`
+}
+
+// Open reports whether a player can still join the lobby
+func (s LobbySummary) Open() bool {
+	return s.CurrentState.Waiting() && s.Players < s.Settings.NumOfPlayers
+}
+
+// ListPublicLobbies returns every public lobby on every replica, open lobbies
+// come first and the fullest lobbies are listed before emptier ones
+func (m *LobbyManager) ListPublicLobbies() []LobbySummary {
+	m.lobbiesMu.Lock()
+	var lobbies []LobbySummary
+	for _, l := range m.Lobbies {
+		if !l.Settings.IsPublic() {
+			continue
+		}
+		lobbies = append(lobbies, l.Summary())
+	}
+	m.lobbiesMu.Unlock()
+
+	lobbies = append(lobbies, m.remoteSummaries()...)
+
+	sort.Slice(lobbies, func(i, j int) bool {
+		a, b := lobbies[i], lobbies[j]
+		if a.Open() != b.Open() {
+			return a.Open()
+		}
+		if a.Players != b.Players {
+			return a.Players > b.Players
+		}
+		return a.ID < b.ID
+	})
+
+	return lobbies
+}
+
+// QuickMatch returns the id of the fullest open public lobby that is
+// compatible with the requested number of players, a new public lobby is
+// created when none are found. A numOfPlayers of 0 matches any lobby.
+func (m *LobbyManager) QuickMatch(numOfPlayers int) (string, error) {
+	for _, l := range m.ListPublicLobbies() {
+		if !l.Open() {
+			continue
+		}
+		if numOfPlayers != 0 && l.Settings.NumOfPlayers != numOfPlayers {
+			continue
+		}
+		return l.ID, nil
+	}
+
+	settings := DefaultQuickMatchSettings
+	if numOfPlayers != 0 {
+		settings.NumOfPlayers = numOfPlayers
+	}
+	if err := settings.Validate(); err != nil {
+		return "", err
+	}
+
+	return m.NewLobby(settings, "")
+}
+
+// Summary returns the directory listing for the lobby
+func (l *Lobby) Summary() LobbySummary {
+	return LobbySummary{
+		ID:           l.ID,
+		Players:      l.numPlayers(),
+		CurrentState: l.State(),
+		Settings:     l.Settings,
+	}
+}
+
+// publishDirectoryUpdate lets lobby listings know something about a lobby
+// changed
+func (m *LobbyManager) publishDirectoryUpdate(lobbyID string) {
+	m.ps.Publish(context.Background(), pubsub.DirectoryTopic, []byte(lobbyID))
+}
@@ -11,6 +11,15 @@ const (
 	ChatPayloadEvent                        = "chat_message"
 	ChooseColorPayloadEvent                 = "choose_color"
 	SetReadyStatusPayloadEvent              = "set_ready_status"
+	MutePayloadEvent                        = "mute_player"
+	UnmutePayloadEvent                      = "unmute_player"
+	ChangeNamePayloadEvent                  = "change_name"
+	PlayCardPayloadEvent                    = "play_card"
+	ExchangeCardPayloadEvent                = "exchange_card"
+	RematchPayloadEvent                     = "rematch"
+	// sent on the admin channel
+	AdminClosePayloadEvent = "admin_close"
+	AdminKickPayloadEvent  = "admin_kick"
 )
 
 const (
@@ -22,4 +31,18 @@ const (
 	ChooseColorResponseEvent                  = "choose_color"
 	SetReadyStatusResponseEvent               = "set_ready_status"
 	StartGameResponseEvent                    = "start_game"
+	ChatHistoryResponseEvent                  = "chat_history"
+	ChatRejectedResponseEvent                 = "chat_rejected"
+	PlayerMutedResponseEvent                  = "player_muted"
+	PlayerUnmutedResponseEvent                = "player_unmuted"
+	PlayerRenamedResponseEvent                = "player_renamed"
+	NameRejectedResponseEvent                 = "name_rejected"
+	ReadyRejectedResponseEvent                = "ready_rejected"
+	ColorRejectedResponseEvent                = "color_rejected"
+	MoveResponseEvent                         = "move"
+	MoveRejectedResponseEvent                 = "move_rejected"
+	GameOverResponseEvent                     = "game_over"
+	LobbyClosedResponseEvent                  = "lobby_closed"
+	PlayerKickedResponseEvent                 = "player_kicked"
+	RematchVoteResponseEvent                  = "rematch_vote"
 )
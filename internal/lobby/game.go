@@ -0,0 +1,516 @@
+package lobby
+
+import (
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spacesedan/go-sequence/internal"
+	"github.com/spacesedan/go-sequence/internal/game"
+	"github.com/spacesedan/go-sequence/internal/metrics"
+	"github.com/spacesedan/go-sequence/internal/services"
+)
+
+// seatID returns the game player id for a lobby player, session player ids are
+// uuids already, anything else is hashed into one
+func seatID(playerID string) uuid.UUID {
+	if id, err := uuid.Parse(playerID); err == nil {
+		return id
+	}
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte(playerID))
+}
+
+// startGame seats the players and deals their cards. The players of the last
+// game move one seat so someone else goes first, a new table is seated in a
+// random order and starts a new series.
+func (h *lobbyHandler) startGame() error {
+	playerIDs, rotated := h.nextSeatOrder()
+	if !rotated || h.lobby.Series.Over() {
+		h.lobby.Series = internal.NewSeries(h.lobby.Settings.BestOf)
+	}
+
+	mode, err := game.ModeByName(h.lobby.Settings.Mode)
+	if err != nil {
+		return err
+	}
+
+	h.lobby.Game = game.NewModeGameService(game.BoardCellsJSONPath, mode)
+	h.lobby.seats = make(map[uuid.UUID]string, len(playerIDs))
+
+	var order []uuid.UUID
+	for _, id := range playerIDs {
+		ps := h.lobby.Players[id]
+		seat := seatID(id)
+		err := h.lobby.Game.AddPlayer(&game.Player{
+			ID:    seat,
+			Name:  ps.Username,
+			Color: ps.Color,
+		})
+		if err != nil {
+			return err
+		}
+
+		h.lobby.seats[seat] = id
+		order = append(order, seat)
+	}
+
+	if err := h.lobby.Game.StartGame(order, h.lobby.Settings.MaxHandSize, h.lobby.Settings.Rules); err != nil {
+		return err
+	}
+	h.lobby.seatOrder = playerIDs
+	clear(h.lobby.Rematch)
+
+	for seat, id := range h.lobby.seats {
+		h.syncHand(id, seat)
+	}
+
+	h.lobby.Turn = h.lobby.seats[h.lobby.Game.CurrentTurn().ID]
+	h.lobby.matchStartedAt = time.Now().UTC()
+
+	return nil
+}
+
+// nextSeatOrder returns the lobby player ids in the turn order of the next
+// game, it reports whether the same players as last game were rotated
+func (h *lobbyHandler) nextSeatOrder() ([]string, bool) {
+	last := h.lobby.seatOrder
+	same := len(last) == len(h.lobby.Players)
+	for _, id := range last {
+		same = same && h.lobby.HasPlayer(id)
+	}
+	if same && len(last) > 0 {
+		return append(append([]string{}, last[1:]...), last[0]), true
+	}
+
+	order := make([]string, 0, len(h.lobby.Players))
+	for id := range h.lobby.Players {
+		order = append(order, id)
+	}
+	rand.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+	if h.lobby.Settings.Teams {
+		order = h.alternateTeams(order)
+	}
+
+	return order, false
+}
+
+// alternateTeams orders the players so the teams take turns, partners never
+// play one after the other
+func (h *lobbyHandler) alternateTeams(order []string) []string {
+	var colors []string
+	teams := make(map[string][]string)
+	for _, id := range order {
+		color := h.lobby.Players[id].Color
+		if _, ok := teams[color]; !ok {
+			colors = append(colors, color)
+		}
+		teams[color] = append(teams[color], id)
+	}
+
+	alternated := make([]string, 0, len(order))
+	for len(alternated) < len(order) {
+		for _, color := range colors {
+			if len(teams[color]) > 0 {
+				alternated = append(alternated, teams[color][0])
+				teams[color] = teams[color][1:]
+			}
+		}
+	}
+	return alternated
+}
+
+// beginGame starts a game and takes every player to the board
+func (h *lobbyHandler) beginGame() {
+	if err := h.startGame(); err != nil {
+		h.lobby.errorChan <- err
+		return
+	}
+
+	h.lobby.setState(internal.InGame)
+
+	// a mode can end the game before anyone played, nobody could play a card
+	if winner := h.lobby.Game.Winner(); winner != "" {
+		h.lobby.Turn = ""
+		h.finishGame(winner)
+		return
+	}
+
+	h.svc.SetLobby(toLobbyState(h.lobby))
+	h.lobby.lobbyManager.publishDirectoryUpdate(h.lobby.ID)
+
+	err := h.publishResponse(WsResponse{
+		Action:         JoinGameResponseEvent,
+		Turn:           h.lobby.Turn,
+		ConnectedUsers: h.svc.GetPlayerIDs(),
+	})
+	if err != nil {
+		h.lobby.errorChan <- err
+	}
+}
+
+// RematchAction records a player's vote to play again after a game, the next
+// game starts right away with the same colors once every seat voted
+func (h *lobbyHandler) RematchAction(p WsPayload) {
+	if h.lobby.CurrentState != internal.Finished || !h.lobby.HasPlayer(p.PlayerID) || h.lobby.Rematch[p.PlayerID] {
+		return
+	}
+
+	h.lobby.Rematch[p.PlayerID] = true
+	h.svc.SetLobby(toLobbyState(h.lobby))
+
+	err := h.publishResponse(WsResponse{
+		Action: RematchVoteResponseEvent,
+		Sender: p.PlayerID,
+		Message: fmt.Sprintf("%v wants a rematch (%v/%v)",
+			h.displayName(p.PlayerID), len(h.lobby.Rematch), h.lobby.Settings.NumOfPlayers),
+		ConnectedUsers: h.svc.GetPlayerIDs(),
+	})
+	if err != nil {
+		h.lobby.errorChan <- err
+		return
+	}
+
+	if len(h.lobby.Players) < h.lobby.Settings.NumOfPlayers {
+		return
+	}
+	for id, ps := range h.lobby.Players {
+		if !h.lobby.Rematch[id] || ps.Color == "" {
+			return
+		}
+	}
+
+	h.beginGame()
+}
+
+// syncHand copies a player's hand from the game into the player state so their
+// client can draw it, it reports whether the hand changed
+func (h *lobbyHandler) syncHand(playerID string, seat uuid.UUID) bool {
+	gp, err := h.lobby.Game.GetPlayer(seat)
+	if err != nil {
+		return false
+	}
+
+	ps, ok := h.lobby.Players[playerID]
+	if !ok || slices.Equal(ps.Hand, gp.Hand) {
+		return false
+	}
+
+	ps.Hand = append([]game.Card{}, gp.Hand...)
+	h.svc.SetPlayer(ps)
+	return true
+}
+
+// parseMove reads a move sent as "card:x:y" where card is the index of the
+// card in the player's hand
+func parseMove(msg string) (int, game.CellPosition, error) {
+	parts := strings.Split(strings.TrimSpace(msg), ":")
+	if len(parts) != 3 {
+		return 0, game.CellPosition{}, services.NewErrorf(services.ErrorCodeInvalidArgument, "moves are sent as card:x:y")
+	}
+
+	var nums [3]int
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return 0, game.CellPosition{}, services.NewErrorf(services.ErrorCodeInvalidArgument, "%q is not a number", p)
+		}
+		nums[i] = n
+	}
+
+	return nums[0], game.CellPosition{X: nums[1], Y: nums[2]}, nil
+}
+
+// PlayAction plays a card from the player's hand on the board
+func (h *lobbyHandler) PlayAction(p WsPayload) {
+	cardIndex, pos, err := parseMove(p.Message)
+	if err != nil {
+		h.rejectMove(p.PlayerID, err)
+		return
+	}
+
+	seat := seatID(p.PlayerID)
+	move, err := h.lobby.Game.PlayTurn(seat, cardIndex, pos)
+	if err != nil {
+		h.rejectMove(p.PlayerID, err)
+		return
+	}
+
+	h.syncHand(p.PlayerID, seat)
+	board := h.lobby.Game.GetBoard()
+	var r WsResponse
+	for _, c := range move.Changed() {
+		r.Cells = append(r.Cells, board[c.X][c.Y])
+	}
+
+	r.Action = MoveResponseEvent
+	r.Sender = p.PlayerID
+	r.ConnectedUsers = h.svc.GetPlayerIDs()
+
+	name := h.displayName(p.PlayerID)
+	switch {
+	case move.Broken > 0:
+		r.Message = fmt.Sprintf("%v broke a sequence with the %v", name, move.Card)
+	case move.Removed:
+		r.Message = fmt.Sprintf("%v removed a chip with the %v", name, move.Card)
+	case move.Sequences > 0:
+		r.Message = fmt.Sprintf("%v completed a sequence with the %v", name, move.Card)
+	default:
+		r.Message = fmt.Sprintf("%v played the %v", name, move.Card)
+	}
+
+	h.publishTurn(r)
+}
+
+// ExchangeAction swaps a dead card of the player's hand for a new one, the
+// player keeps their turn
+func (h *lobbyHandler) ExchangeAction(p WsPayload) {
+	cardIndex, err := strconv.Atoi(strings.TrimSpace(p.Message))
+	if err != nil {
+		h.rejectMove(p.PlayerID, services.NewErrorf(services.ErrorCodeInvalidArgument, "exchanges are sent as the index of the card"))
+		return
+	}
+
+	seat := seatID(p.PlayerID)
+	card, err := h.lobby.Game.ExchangeDeadCard(seat, cardIndex)
+	if err != nil {
+		h.rejectMove(p.PlayerID, err)
+		return
+	}
+
+	h.syncHand(p.PlayerID, seat)
+
+	h.publishTurn(WsResponse{
+		Action:         MoveResponseEvent,
+		Sender:         p.PlayerID,
+		Message:        fmt.Sprintf("%v exchanged the dead %v", h.displayName(p.PlayerID), card),
+		ConnectedUsers: h.svc.GetPlayerIDs(),
+	})
+}
+
+// forfeit gives up the game seat of a player who left, the turn passes on
+// when it was theirs and the game ends once a single color is left
+func (h *lobbyHandler) forfeit(playerID, name string) {
+	seat := seatID(playerID)
+	if h.lobby.CurrentState != internal.InGame || h.lobby.seats[seat] != playerID {
+		return
+	}
+	h.lobby.clearAway(playerID)
+
+	if err := h.lobby.Game.Forfeit(seat); err != nil {
+		return
+	}
+
+	// nobody is left to win the game
+	if h.lobby.Game.CurrentTurn() == nil {
+		h.lobby.Turn = ""
+		h.svc.SetLobby(toLobbyState(h.lobby))
+		return
+	}
+
+	h.publishTurn(WsResponse{
+		Action:         MoveResponseEvent,
+		Message:        fmt.Sprintf("%v left the game", name),
+		ConnectedUsers: h.svc.GetPlayerIDs(),
+	})
+}
+
+// ForfeitAway forfeits the games of the players that lost their connection
+// before since and didn't come back
+func (h *lobbyHandler) ForfeitAway(since time.Time) {
+	for _, id := range h.lobby.awaySince(since) {
+		name := id
+		if gp, err := h.lobby.Game.GetPlayer(seatID(id)); err == nil {
+			name = gp.Name
+		}
+		h.forfeit(id, name)
+	}
+}
+
+// retakeSeat gives a player that reconnects during a game their color and
+// hand back, the stored player expires when they stay away too long
+func (h *lobbyHandler) retakeSeat(playerID string, ps *internal.Player) {
+	seat := seatID(playerID)
+	if h.lobby.CurrentState != internal.InGame || h.lobby.seats[seat] != playerID {
+		return
+	}
+	gp, err := h.lobby.Game.GetPlayer(seat)
+	if err != nil {
+		return
+	}
+
+	ps.Color, ps.Ready = gp.Color, true
+	h.svc.SetPlayer(ps)
+	h.syncHand(playerID, seat)
+}
+
+// publishTurn saves the game and publishes the outcome of a turn, the game
+// ends once it has a winner
+func (h *lobbyHandler) publishTurn(r WsResponse) {
+	if winner := h.lobby.Game.Winner(); winner != "" {
+		h.lobby.Turn = ""
+		h.svc.SetLobby(toLobbyState(h.lobby))
+		if err := h.publishResponse(r); err != nil {
+			h.lobby.errorChan <- err
+			return
+		}
+		h.finishGame(winner)
+		return
+	}
+
+	next := h.lobby.Game.CurrentTurn()
+	h.lobby.Turn = h.lobby.seats[next.ID]
+	r.Turn = h.lobby.Turn
+	// some modes deal the next player their cards when their turn begins
+	if h.lobby.Turn != r.Sender {
+		r.Dealt = h.syncHand(h.lobby.Turn, next.ID)
+	}
+	h.svc.SetLobby(toLobbyState(h.lobby))
+
+	if err := h.publishResponse(r); err != nil {
+		h.lobby.errorChan <- err
+	}
+}
+
+// rejectMove lets a player know why their move was not played
+func (h *lobbyHandler) rejectMove(playerID string, reason error) {
+	metrics.RejectedMoves.WithLabelValues(services.CodeOf(reason).String()).Inc()
+
+	h.publishResponse(WsResponse{
+		Action:  MoveRejectedResponseEvent,
+		Sender:  playerID,
+		Message: services.Message(reason),
+		Code:    services.CodeOf(reason),
+	})
+}
+
+// finishGame records the match and the series score and sends everyone back
+// to the lobby so they can vote for a rematch or change their name or color
+// before the next game
+func (h *lobbyHandler) finishGame(winner string) {
+	match := h.newMatch(winner)
+	h.recordMatch(match)
+	metrics.GameDuration.Observe(match.EndedAt.Sub(match.StartedAt).Seconds())
+
+	var names []string
+	for _, p := range match.Winners() {
+		names = append(names, p.DisplayName)
+	}
+
+	message := fmt.Sprintf("%v won the game", strings.Join(names, " and "))
+	if len(match.Players) == 1 {
+		message = fmt.Sprintf("%v finished with %v sequences", match.Players[0].DisplayName,
+			h.lobby.Game.Snapshot().Sequences[winner])
+	}
+	decided := h.lobby.Series.Record(winner)
+	switch {
+	case decided && h.lobby.Series.BestOf > 1:
+		message += fmt.Sprintf(" and the series %v", h.lobby.Series.Score())
+	case h.lobby.Series.BestOf > 1:
+		message += fmt.Sprintf(", %v", h.lobby.Series)
+	}
+
+	for _, ps := range h.lobby.Players {
+		ps.Ready = false
+		ps.Hand = nil
+		h.svc.SetPlayer(ps)
+	}
+
+	h.lobby.setState(internal.Finished)
+	h.lobby.Turn = ""
+	h.lobby.seats = nil
+	h.lobby.clearAway()
+	h.svc.SetLobby(toLobbyState(h.lobby))
+	h.lobby.lobbyManager.publishDirectoryUpdate(h.lobby.ID)
+
+	err := h.publishResponse(WsResponse{
+		Action:         GameOverResponseEvent,
+		Message:        message,
+		Winner:         winner,
+		Series:         h.lobby.Series,
+		ConnectedUsers: h.svc.GetPlayerIDs(),
+	})
+	if err != nil {
+		h.lobby.errorChan <- err
+	}
+}
+
+// newMatch builds the match record for the game that just ended
+func (h *lobbyHandler) newMatch(winner string) *internal.Match {
+	match := &internal.Match{
+		ID:          uuid.NewString(),
+		LobbyID:     h.lobby.ID,
+		StartedAt:   h.lobby.matchStartedAt,
+		EndedAt:     time.Now().UTC(),
+		WinnerColor: winner,
+		FinalBoard:  h.lobby.Game.GetBoard(),
+	}
+
+	for seat, id := range h.lobby.seats {
+		gp, err := h.lobby.Game.GetPlayer(seat)
+		if err != nil {
+			continue
+		}
+		match.Players = append(match.Players, internal.MatchPlayer{
+			PlayerID:    id,
+			DisplayName: gp.Name,
+			Color:       gp.Color,
+			Winner:      gp.Color == winner,
+		})
+	}
+
+	for i, m := range h.lobby.Game.GetMoves() {
+		match.Moves = append(match.Moves, internal.MatchMove{
+			Turn:      i + 1,
+			PlayerID:  h.lobby.seats[m.PlayerID],
+			Card:      m.Card,
+			X:         m.Position.X,
+			Y:         m.Position.Y,
+			Removed:   m.Removed,
+			Sequences: m.Sequences,
+			PlayedAt:  m.PlayedAt,
+		})
+	}
+
+	return match
+}
+
+// recordMatch saves the match and the profiles of everyone that played in it,
+// ranked matches also update the ratings of the players
+func (h *lobbyHandler) recordMatch(match *internal.Match) {
+	store := h.lobby.lobbyManager.store
+	if store == nil {
+		return
+	}
+
+	if err := store.SaveMatch(match); err != nil {
+		h.logger.Error("lobbyHandler.recordMatch",
+			slog.Group("failed to save match",
+				slog.String("lobby_id", h.lobby.ID),
+				slog.String("reason", err.Error())))
+	}
+
+	for _, p := range match.Players {
+		if err := h.lobby.lobbyManager.TouchProfile(p.PlayerID, p.DisplayName); err != nil {
+			h.logger.Error("lobbyHandler.recordMatch",
+				slog.Group("failed to save profile",
+					slog.String("player_id", p.PlayerID),
+					slog.String("reason", err.Error())))
+		}
+	}
+
+	if !h.lobby.Settings.Ranked {
+		return
+	}
+
+	if err := h.lobby.lobbyManager.rateMatch(match); err != nil {
+		h.logger.Error("lobbyHandler.recordMatch",
+			slog.Group("failed to rate match",
+				slog.String("lobby_id", h.lobby.ID),
+				slog.String("reason", err.Error())))
+	}
+}
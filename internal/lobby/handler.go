@@ -2,12 +2,24 @@ package lobby
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
+	"strings"
 	"time"
 
-	"github.com/go-redis/redis/v8"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
 	"github.com/spacesedan/go-sequence/internal"
+	"github.com/spacesedan/go-sequence/internal/db"
+	"github.com/spacesedan/go-sequence/internal/game"
+	"github.com/spacesedan/go-sequence/internal/metrics"
+	"github.com/spacesedan/go-sequence/internal/pubsub"
+	"github.com/spacesedan/go-sequence/internal/ratelimit"
+	"github.com/spacesedan/go-sequence/internal/services"
+	"github.com/spacesedan/go-sequence/internal/tracing"
 )
 
 type LobbyHandler interface {
@@ -20,26 +32,46 @@ type LobbyHandler interface {
 	JoinAction(WsPayload)
 	LeaveAction(WsPayload)
 	ChatAction(WsPayload)
+	MuteAction(WsPayload)
+	UnmuteAction(WsPayload)
+	RenameAction(WsPayload)
 	ColorSelectionAction(WsPayload)
 	ReadyAction(WsPayload)
+	PlayAction(WsPayload)
+	ExchangeAction(WsPayload)
+	RematchAction(WsPayload)
+	// ForfeitAway forfeits the games of the players that lost their
+	// connection before the time given
+	ForfeitAway(time.Time)
+
+	AdminAction(WsPayload) bool
 
 	EmptyLobby() bool
+	NotifyClosed(message string)
 }
 
 type lobbyHandler struct {
 	lobby  *Lobby
 	logger *slog.Logger
-	rdb    *redis.Client
+	ps     pubsub.Publisher
 
-	svc LobbyService
+	svc         LobbyService
+	chatPolicy  ChatPolicy
+	chatFilter  *chatFilter
+	chatLimiter *ratelimit.Buckets
 }
 
-func NewLobbyHandler(r *redis.Client, l *Lobby, logger *slog.Logger) LobbyHandler {
+func NewLobbyHandler(repos db.Repos, ps pubsub.Publisher, l *Lobby, logger *slog.Logger) LobbyHandler {
+	policy := l.lobbyManager.chatPolicy
+
 	return &lobbyHandler{
-		rdb:    r,
-		lobby:  l,
-		logger: logger,
-		svc:    NewLobbyService(r, l, logger),
+		ps:          ps,
+		lobby:       l,
+		logger:      logger,
+		svc:         NewLobbyService(repos, l, logger),
+		chatPolicy:  policy,
+		chatFilter:  newChatFilter(policy.BlockedWords),
+		chatLimiter: ratelimit.NewBuckets(policy.rate()),
 	}
 }
 
@@ -51,60 +83,118 @@ func (h *lobbyHandler) RegisterPlayer(p WsPayload) {
 	var ps *internal.Player
 	var r WsResponse
 
-    time.Sleep(3 * time.Second)
-
-	ps, err := h.svc.GetPlayer(p.Username)
+	ps, err := h.svc.GetPlayer(p.PlayerID)
 	if ps == nil {
-		ps = &internal.Player{
-			Username: p.Username,
-			LobbyId:  h.lobby.ID,
-		}
+		// two players asking for the same display name get a numbered suffix,
+		// reconnecting players keep the name they were given
+		name := uniqueDisplayName(p.Username, func(name string) bool {
+			return h.lobby.displayNameTaken(name, p.PlayerID)
+		})
 
-		ps, err = h.svc.NewPlayer(p.Username)
+		ps, err = h.svc.NewPlayer(p.PlayerID, name)
 		if err != nil {
 			h.lobby.errorChan <- fmt.Errorf("handleRegisterPlayer error reason: %v", err)
+			return
 		}
 
 	}
 
-	h.lobby.Players[p.Username] = ps
-    h.svc.SetLobby(toLobbyState(h.lobby))
+	h.lobby.setPlayer(p.PlayerID, ps)
+	h.lobby.clearAway(p.PlayerID)
+	h.retakeSeat(p.PlayerID, ps)
+	if h.lobby.Host == "" {
+		h.lobby.Host = p.PlayerID
+	}
+	if h.lobby.CurrentState == internal.Created {
+		h.lobby.setState(internal.InLobby)
+	}
+	h.svc.SetLobby(toLobbyState(h.lobby))
 
 	// get the current state of the lobby
 	cs := h.svc.GetCurrentState()
 
 	// handle the register payload with the current state
-	r.Sender = p.Username
-	r.ConnectedUsers = h.svc.GetPlayerNames()
+	r.Sender = p.PlayerID
+	r.ConnectedUsers = h.svc.GetPlayerIDs()
 
-	switch cs {
-	case internal.InLobby:
+	switch {
+	case cs.Waiting():
 		r.Action = JoinLobbyResponseEvent
-		r.Message = fmt.Sprintf("%s joined", p.Username)
-	case internal.InGame:
+		r.Message = fmt.Sprintf("%s joined", ps.Username)
+	case cs == internal.InGame:
 		r.Action = JoinGameResponseEvent
-		r.Message = fmt.Sprintf("%s reconnected", p.Username)
+		r.Message = fmt.Sprintf("%s reconnected", ps.Username)
 	}
 
 	// send the response to the player
 	h.publishResponse(r)
+	h.lobby.lobbyManager.publishDirectoryUpdate(h.lobby.ID)
+
+	h.sendChatHistory(p.PlayerID)
+}
+
+// displayName returns the name the lobby knows a player by
+func (h *lobbyHandler) displayName(playerID string) string {
+	if ps, ok := h.lobby.Players[playerID]; ok {
+		return ps.Username
+	}
+	return playerID
+}
+
+// sendChatHistory sends the stored chat messages to a player that just joined
+func (h *lobbyHandler) sendChatHistory(playerID string) {
+	history, err := h.svc.GetChatHistory()
+	if err != nil {
+		h.logger.Error("lobbyHandler.sendChatHistory",
+			slog.Group("failed to read chat history",
+				slog.String("lobby_id", h.lobby.ID),
+				slog.String("reason", err.Error())))
+		return
+	}
 
+	if len(history) == 0 {
+		return
+	}
+
+	h.publishResponse(WsResponse{
+		Action:       ChatHistoryResponseEvent,
+		Sender:       playerID,
+		ChatMessages: history,
+	})
 }
 
 func (h *lobbyHandler) DeregisterPlayer(p WsPayload) {
 	h.logger.Info("lobby.handleUnregisterSession",
 		slog.Group("Unregistering player connection",
 			slog.String("lobby_id", h.lobby.ID),
-			slog.String("user", p.Username)))
+			slog.String("player_id", p.PlayerID)))
+
+	if _, ok := h.lobby.Players[p.PlayerID]; ok {
+		h.lobby.deletePlayer(p.PlayerID)
+		// handle this in the lobby service
+		// instead of calling to delete ill just remove the
+		// the player from the the Player list and let the
+		// unregistered player data to expire.
+		// l.lobbyRepo.DeletePlayer(l.ID, payload.Username)
+		h.svc.SetExpiration(p.PlayerID, h.lobby.lobbyManager.ReconnectTTL)
+		h.chatLimiter.Forget(p.PlayerID)
+		delete(h.lobby.Rematch, p.PlayerID)
+		h.reserveColors()
+		// players keep their seat in a game for a while to reconnect
+		if h.lobby.CurrentState == internal.InGame && h.lobby.seats[seatID(p.PlayerID)] == p.PlayerID {
+			h.lobby.setAway(p.PlayerID, time.Now())
+		}
 
-	if _, ok := h.lobby.Players[p.Username]; ok {
-		delete(h.lobby.Players, p.Username)
-        // handle this in the lobby service
-        // instead of calling to delete ill just remove the
-        // the player from the the Player list and let the
-        // unregistered player data to expire.
-        // l.lobbyRepo.DeletePlayer(l.ID, payload.Username)
-		h.svc.SetExpiration(p.Username, time.Duration(30*time.Second))
+		// hand moderation over to someone that is still in the lobby
+		if h.lobby.Host == p.PlayerID {
+			h.lobby.Host = ""
+			for id := range h.lobby.Players {
+				h.lobby.Host = id
+				break
+			}
+		}
+		h.svc.SetLobby(toLobbyState(h.lobby))
+		h.lobby.lobbyManager.publishDirectoryUpdate(h.lobby.ID)
 	}
 
 }
@@ -118,8 +208,10 @@ func (h *lobbyHandler) ChangeState() {
 }
 
 func (h *lobbyHandler) DispatchAction(p WsPayload) {
-	switch h.lobby.CurrentState {
-	case internal.InLobby:
+	metrics.Payloads.WithLabelValues(payloadLabel(p.Action)).Inc()
+
+	switch {
+	case h.lobby.CurrentState.Waiting():
 		switch p.Action {
 		// case JoinLobbyPayloadEvent:
 		// 	h.JoinAction(p)
@@ -127,12 +219,34 @@ func (h *lobbyHandler) DispatchAction(p WsPayload) {
 			h.LeaveAction(p)
 		case ChatPayloadEvent:
 			h.ChatAction(p)
+		case MutePayloadEvent:
+			h.MuteAction(p)
+		case UnmutePayloadEvent:
+			h.UnmuteAction(p)
+		case ChangeNamePayloadEvent:
+			h.RenameAction(p)
 		case ChooseColorPayloadEvent:
 			h.ColorSelectionAction(p)
 		case SetReadyStatusPayloadEvent:
 			h.ReadyAction(p)
+		case RematchPayloadEvent:
+			h.RematchAction(p)
+		}
+	case h.lobby.CurrentState == internal.InGame:
+		switch p.Action {
+		case LeavePayloadEvent:
+			h.LeaveAction(p)
+		case ChatPayloadEvent:
+			h.ChatAction(p)
+		case MutePayloadEvent:
+			h.MuteAction(p)
+		case UnmutePayloadEvent:
+			h.UnmuteAction(p)
+		case PlayCardPayloadEvent:
+			h.PlayAction(p)
+		case ExchangeCardPayloadEvent:
+			h.ExchangeAction(p)
 		}
-	case internal.InGame:
 	}
 }
 
@@ -140,63 +254,207 @@ func (h *lobbyHandler) JoinAction(p WsPayload) {
 	var r WsResponse
 
 	r.Action = JoinLobbyResponseEvent
-	r.Message = fmt.Sprintf("%v joined", p.Username)
+	r.Message = fmt.Sprintf("%v joined", h.displayName(p.PlayerID))
 	r.SkipSender = true
-	r.Sender = p.Username
-	r.ConnectedUsers = h.svc.GetPlayerNames()
+	r.Sender = p.PlayerID
+	r.ConnectedUsers = h.svc.GetPlayerIDs()
 
-	h.publish(StateChannel, h.lobby.CurrentState)
+	h.publish(pubsub.StateChannel, h.lobby.CurrentState)
 	// if err := h.publish(StateChannel, h.lobby.CurrentState); err != nil {
 	// 	h.lobby.errorChan <- err
 	// }
 }
 
+// LeaveAction gives up the player's seat for good, unlike a dropped
+// connection they can't come back to it
 func (h *lobbyHandler) LeaveAction(p WsPayload) {
+	h.removePlayer(p.PlayerID, LeftResponseEvent, "%v left")
+}
+
+func (h *lobbyHandler) ChatAction(p WsPayload) {
 	var r WsResponse
 
-	r.Action = LeftResponseEvent
-	r.Message = fmt.Sprintf("%v left", p.Username)
-	r.SkipSender = true
-	r.Sender = p.Username
-	r.ConnectedUsers = h.svc.GetPlayerNames()
+	msg, err := h.chatPolicy.validate(p.Message)
+	if err == nil && h.lobby.Muted[p.PlayerID] {
+		err = ErrChatMuted
+	}
+	if err == nil && !h.chatLimiter.Allow(p.PlayerID, time.Now()) {
+		err = ErrChatRateLimited
+	}
+	if err != nil {
+		h.rejectChat(p.PlayerID, err)
+		return
+	}
+
+	cm := &internal.ChatMessage{
+		SenderID: p.PlayerID,
+		Sender:   h.displayName(p.PlayerID),
+		Message:  h.chatFilter.clean(msg),
+		SentAt:   time.Now().UTC(),
+	}
+
+	if err := h.svc.AddChatMessage(cm); err != nil {
+		h.logger.Error("lobbyHandler.ChatAction",
+			slog.Group("failed to store chat message",
+				slog.String("lobby_id", h.lobby.ID),
+				slog.String("reason", err.Error())))
+	}
+
+	r.Action = NewMessageResponseEvent
+	r.Message = cm.Message
+	r.SkipSender = false
+	r.Sender = p.PlayerID
+	r.ConnectedUsers = h.svc.GetPlayerIDs()
+	r.ChatMessages = []*internal.ChatMessage{cm}
 
 	if err := h.publishResponse(r); err != nil {
 		h.lobby.errorChan <- err
 	}
+
 }
 
-func (h *lobbyHandler) ChatAction(p WsPayload) {
+// rejectChat lets the sender know why their message was not sent
+func (h *lobbyHandler) rejectChat(playerID string, reason error) {
+	if errors.Is(reason, ErrChatEmpty) {
+		return
+	}
+
+	h.publishResponse(WsResponse{
+		Action:  ChatRejectedResponseEvent,
+		Sender:  playerID,
+		Message: reason.Error(),
+		Code:    services.ErrorCodeInvalidArgument,
+	})
+}
+
+// MuteAction lets the host stop a player from sending chat messages, the
+// display name of the player is sent as the message
+func (h *lobbyHandler) MuteAction(p WsPayload) {
+	h.setMuted(p, true)
+}
+
+// UnmuteAction lets the host give a muted player their voice back
+func (h *lobbyHandler) UnmuteAction(p WsPayload) {
+	h.setMuted(p, false)
+}
+
+func (h *lobbyHandler) setMuted(p WsPayload, muted bool) {
+	name := strings.TrimSpace(p.Message)
+
+	if p.PlayerID != h.lobby.Host {
+		h.rejectChat(p.PlayerID, errors.New("only the host can mute players"))
+		return
+	}
+
+	target, ok := h.lobby.PlayerByName(name)
+	if !ok || target.ID == h.lobby.Host {
+		h.rejectChat(p.PlayerID, fmt.Errorf("can't mute %v", name))
+		return
+	}
+
 	var r WsResponse
+	r.Sender = target.ID
+	r.ConnectedUsers = h.svc.GetPlayerIDs()
+
+	if muted {
+		h.lobby.Muted[target.ID] = true
+		r.Action = PlayerMutedResponseEvent
+		r.Message = fmt.Sprintf("%v was muted by the host", target.Username)
+	} else {
+		delete(h.lobby.Muted, target.ID)
+		r.Action = PlayerUnmutedResponseEvent
+		r.Message = fmt.Sprintf("%v was unmuted by the host", target.Username)
+	}
+	h.svc.SetLobby(toLobbyState(h.lobby))
 
-	r.Action = NewMessageResponseEvent
-	r.Message = p.Message
-	r.SkipSender = false
-	r.Sender = p.Username
-	r.ConnectedUsers = h.svc.GetPlayerNames()
+	if err := h.publishResponse(r); err != nil {
+		h.lobby.errorChan <- err
+	}
+}
+
+// RenameAction changes the display name of a player, names can only be changed
+// while the players are in the lobby and not during a game
+func (h *lobbyHandler) RenameAction(p WsPayload) {
+	name, err := ValidateDisplayName(p.Message)
+	if err != nil {
+		h.rejectName(p.PlayerID, err)
+		return
+	}
+
+	senderState, err := h.svc.GetPlayer(p.PlayerID)
+	if err != nil {
+		h.lobby.errorChan <- err
+		return
+	}
+
+	if h.lobby.displayNameTaken(name, p.PlayerID) {
+		h.rejectName(p.PlayerID, fmt.Errorf("%v is already used in this lobby", name))
+		return
+	}
+
+	previous := senderState.Username
+	senderState.Username = name
+	h.svc.SetPlayer(senderState)
+
+	h.lobby.setPlayer(p.PlayerID, senderState)
+	h.svc.SetLobby(toLobbyState(h.lobby))
 
+	var r WsResponse
+	r.Action = PlayerRenamedResponseEvent
+	r.Sender = p.PlayerID
+	r.Message = fmt.Sprintf("%v is now %v", previous, name)
+	r.ConnectedUsers = h.svc.GetPlayerIDs()
 	if err := h.publishResponse(r); err != nil {
 		h.lobby.errorChan <- err
 	}
+}
 
+// rejectName lets a player know why their name was not changed
+func (h *lobbyHandler) rejectName(playerID string, reason error) {
+	h.publishResponse(WsResponse{
+		Action:  NameRejectedResponseEvent,
+		Sender:  playerID,
+		Message: reason.Error(),
+		Code:    services.ErrorCodeInvalidArgument,
+	})
 }
 
 func (h *lobbyHandler) ColorSelectionAction(p WsPayload) {
 	var r WsResponse
 
-	senderState, err := h.svc.GetPlayer(p.Username)
+	senderState, err := h.svc.GetPlayer(p.PlayerID)
 	if err != nil {
-		h.lobby.errorChan <- fmt.Errorf("lobby.Subscribe err: ")
+		h.lobby.errorChan <- err
+		return
 	}
+
+	if senderState.Color != p.Message && h.inSeries(p.PlayerID) {
+		h.rejectColor(p.PlayerID, fmt.Sprintf("colors are kept until the series is over, %v", h.lobby.Series))
+		return
+	}
+	if senderState.Color != p.Message {
+		available, ok := h.lobby.ColorsAvailable[p.Message]
+		if !ok {
+			h.rejectColor(p.PlayerID, fmt.Sprintf("%q is not a color", p.Message))
+			return
+		}
+		if !available {
+			h.rejectColor(p.PlayerID, fmt.Sprintf("%v is taken", p.Message))
+			return
+		}
+	}
+
 	senderState.Color = p.Message
 	h.svc.SetPlayer(senderState)
 
-	h.lobby.Players[p.Username] = senderState
+	h.lobby.setPlayer(p.PlayerID, senderState)
+	h.reserveColors()
 	h.svc.SetLobby(toLobbyState(h.lobby))
 
 	r.Action = ChooseColorResponseEvent
-	r.Sender = p.Username
+	r.Sender = p.PlayerID
 	r.Message = p.Message
-	r.ConnectedUsers = h.svc.GetPlayerNames()
+	r.ConnectedUsers = h.svc.GetPlayerIDs()
 	r.SkipSender = false
 	if err := h.publishResponse(r); err != nil {
 		h.lobby.errorChan <- err
@@ -204,18 +462,98 @@ func (h *lobbyHandler) ColorSelectionAction(p WsPayload) {
 
 }
 
+// inSeries reports whether the player played the last game of a series that
+// isn't over yet
+func (h *lobbyHandler) inSeries(playerID string) bool {
+	return h.lobby.CurrentState == internal.Finished &&
+		h.lobby.Series.InProgress() &&
+		slices.Contains(h.lobby.seatOrder, playerID)
+}
+
+// rejectColor lets a player know why they didn't get the color they chose
+func (h *lobbyHandler) rejectColor(playerID, reason string) {
+	h.publishResponse(WsResponse{
+		Action:  ColorRejectedResponseEvent,
+		Sender:  playerID,
+		Message: reason,
+		Code:    services.ErrorCodeInvalidArgument,
+	})
+}
+
+// reserveColors marks the colors chosen by as many players as a color seats as
+// taken, and frees the colors players changed or left
+func (h *lobbyHandler) reserveColors() {
+	chosen := make(map[string]int)
+	for _, ps := range h.lobby.Players {
+		chosen[ps.Color]++
+	}
+
+	seats := h.colorSeats()
+	for color := range h.lobby.ColorsAvailable {
+		h.lobby.ColorsAvailable[color] = chosen[color] < seats
+	}
+}
+
+// colorSeats returns the number of players that can choose the same color,
+// a color seats a whole team in team games
+func (h *lobbyHandler) colorSeats() int {
+	if !h.lobby.Settings.Teams {
+		return 1
+	}
+	mode, err := game.ModeByName(h.lobby.Settings.Mode)
+	if err != nil {
+		return 1
+	}
+	counts := h.lobby.Settings.TeamCounts(mode)
+	if len(counts) == 0 {
+		return 1
+	}
+	return h.lobby.Settings.NumOfPlayers / counts[0]
+}
+
 func (h *lobbyHandler) ReadyAction(p WsPayload) {
 	var r WsResponse
 	var playersReady []bool
 
-	senderState, err := h.svc.GetPlayer(p.Username)
+	senderState, err := h.svc.GetPlayer(p.PlayerID)
 	if err != nil {
 		h.lobby.errorChan <- err
+		return
 	}
+
+	if senderState.Color == "" {
+		h.publishResponse(WsResponse{
+			Action:  ReadyRejectedResponseEvent,
+			Sender:  p.PlayerID,
+			Message: "choose a color before getting ready",
+			Code:    services.ErrorCodeInvalidArgument,
+		})
+		return
+	}
+
+	if err := h.checkSeats(p.PlayerID); err != nil {
+		h.publishResponse(WsResponse{
+			Action:  ReadyRejectedResponseEvent,
+			Sender:  p.PlayerID,
+			Message: services.Message(err),
+			Code:    services.ErrorCodeInvalidArgument,
+		})
+		return
+	}
+
 	senderState.Ready = true
 	h.svc.SetPlayer(senderState)
 
-	h.lobby.Players[p.Username] = senderState
+	h.lobby.setPlayer(p.PlayerID, senderState)
+	h.svc.SetLobby(toLobbyState(h.lobby))
+
+	r.Action = SetReadyStatusResponseEvent
+	r.Sender = p.PlayerID
+	r.Message = fmt.Sprintf("%v is ready", senderState.Username)
+	r.ConnectedUsers = h.svc.GetPlayerIDs()
+	if err := h.publishResponse(r); err != nil {
+		h.lobby.errorChan <- err
+	}
 
 	for _, p := range h.lobby.Players {
 		if p.Ready {
@@ -224,44 +562,63 @@ func (h *lobbyHandler) ReadyAction(p WsPayload) {
 	}
 
 	if len(playersReady) == h.lobby.Settings.NumOfPlayers {
-		h.lobby.CurrentState = internal.InGame
-		h.svc.SetLobby(toLobbyState(h.lobby))
+		h.beginGame()
+	}
 
-        r.Action = JoinGameResponseEvent
-        r.SkipSender = false
-        r.ConnectedUsers = h.svc.GetPlayerNames()
-        if err := h.publishResponse(r); err != nil {
-            h.lobby.errorChan <- err
-        }
+}
 
+// checkSeats reports why the game can't start with the colors chosen once the
+// last player gets ready
+func (h *lobbyHandler) checkSeats(playerID string) error {
+	if len(h.lobby.Players) < h.lobby.Settings.NumOfPlayers {
+		return nil
+	}
+	var colors []string
+	for id, ps := range h.lobby.Players {
+		if id != playerID && !ps.Ready {
+			return nil
+		}
+		colors = append(colors, ps.Color)
 	}
 
+	mode, err := game.ModeByName(h.lobby.Settings.Mode)
+	if err != nil {
+		return err
+	}
+	return game.CheckSeats(mode, colors)
 }
 
-func (h *lobbyHandler) publish(c LobbyChannel, s internal.CurrentState) {
+func (h *lobbyHandler) publish(c pubsub.LobbyChannel, s internal.CurrentState) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	err := h.rdb.Publish(ctx, c.String(h.lobby.ID), WsPayload{
+	pb, err := WsPayload{
 		Action:  "change_state",
 		Message: s.String(),
-	})
-	if err.Err() != nil {
-		h.lobby.errorChan <- err.Err()
+	}.MarshalBinary()
+	if err != nil {
+		h.lobby.errorChan <- err
+		return
+	}
+
+	if err := h.ps.Publish(ctx, pubsub.LobbyTopic(h.lobby.ID, c), pb); err != nil {
+		h.lobby.errorChan <- err
 	}
 
 }
 
-func (h *lobbyHandler) publishResponse(response WsResponse) error {
+func (h *lobbyHandler) publishResponse(response WsResponse) (err error) {
 	h.logger.Info("lobby.publishResponse",
 		slog.Group("sending response to players",
 			slog.String("lobby_id", h.lobby.ID)))
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	responseChanKey := fmt.Sprintf("lobby.%v.responseChannel", h.lobby.ID)
+	ctx, span := tracing.Start(h.lobby.traceContext(), "lobby.publishResponse",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attribute.String("lobby.response", string(response.Action))))
+	defer func() { tracing.End(span, err) }()
 
+	response.PublishedAt = time.Now()
+	response.Trace = tracing.Inject(ctx)
 	rb, err := response.MarshalBinary()
 	if err != nil {
 		h.logger.Error("wsClient.PublishPayloadToLobby",
@@ -270,16 +627,17 @@ func (h *lobbyHandler) publishResponse(response WsResponse) error {
 		return err
 	}
 
-	err = h.rdb.Publish(ctx, responseChanKey, rb).Err()
+	err = h.ps.Publish(ctx, pubsub.LobbyTopic(h.lobby.ID, pubsub.ResponseChannel), rb)
 	if err != nil {
 		h.logger.Error("lobby.publishResponse", slog.Group("error trying to publish", slog.String("lobby_id", h.lobby.ID)))
 		return err
 	}
+	metrics.Responses.WithLabelValues(string(response.Action)).Inc()
 	return nil
 }
 
 func (h *lobbyHandler) EmptyLobby() bool {
-	if len(h.svc.GetPlayerNames()) == 0 {
+	if len(h.svc.GetPlayerIDs()) == 0 {
 		h.logger.Info("lobbyHandler.EmptyLobby",
 			slog.Group("triggering closing lobby",
 				slog.String("reason", "no players in lobby"),
@@ -291,3 +649,17 @@ func (h *lobbyHandler) EmptyLobby() bool {
 	return false
 
 }
+
+// NotifyClosed tells the players the lobby is closing so their clients
+// disconnect
+func (h *lobbyHandler) NotifyClosed(message string) {
+	if err := h.publishResponse(WsResponse{
+		Action:  LobbyClosedResponseEvent,
+		Message: message,
+	}); err != nil {
+		h.logger.Error("lobbyHandler.NotifyClosed",
+			slog.Group("failed to notify players",
+				slog.String("lobby_id", h.lobby.ID),
+				slog.String("reason", err.Error())))
+	}
+}
@@ -0,0 +1,142 @@
+package lobby
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/spacesedan/go-sequence/internal"
+	"github.com/spacesedan/go-sequence/internal/services"
+)
+
+// reapEvery is how often a lobby checks whether it should close
+const reapEvery = time.Minute
+
+// forfeitEvery is how often a lobby checks for players that didn't reconnect
+// within ttl
+func forfeitEvery(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		return time.Second
+	}
+	return min(ttl/2, reapEvery)
+}
+
+var ErrShuttingDown = services.NewErrorf(services.ErrorCodeUnavailable, "The server is restarting; try again in a moment")
+
+// IdlePolicy is how long a lobby stays open without any player sending
+// something, per state. A timeout of 0 never closes a lobby in that state.
+type IdlePolicy struct {
+	// Created lobbies nobody joined yet
+	Created time.Duration
+	// Waiting lobbies whose players are choosing colors and getting ready
+	Waiting time.Duration
+	InGame  time.Duration
+	// Finished lobbies whose game ended
+	Finished time.Duration
+}
+
+// DefaultIdlePolicy is used unless the manager is configured otherwise
+var DefaultIdlePolicy = IdlePolicy{
+	Created:  5 * time.Minute,
+	Waiting:  30 * time.Minute,
+	InGame:   time.Hour,
+	Finished: 10 * time.Minute,
+}
+
+// Timeout returns the idle timeout of a state
+func (p IdlePolicy) Timeout(s internal.CurrentState) time.Duration {
+	switch s {
+	case internal.Created:
+		return p.Created
+	case internal.InLobby:
+		return p.Waiting
+	case internal.InGame:
+		return p.InGame
+	case internal.Finished:
+		return p.Finished
+	}
+	return 0
+}
+
+// Expired reports whether a lobby in state s that was last active at last
+// idled for longer than its timeout
+func (p IdlePolicy) Expired(s internal.CurrentState, last, now time.Time) bool {
+	timeout := p.Timeout(s)
+	return timeout > 0 && now.Sub(last) > timeout
+}
+
+// setState moves the lobby to another state of its lifecycle, only the lobby
+// goroutine changes the state
+func (l *Lobby) setState(s internal.CurrentState) {
+	if l.CurrentState != s && l.CurrentState != internal.Unknown {
+		l.logger.Info("lobby.setState",
+			slog.Group("lobby state changed",
+				slog.String("lobby_id", l.ID),
+				slog.String("from", l.CurrentState.String()),
+				slog.String("to", s.String())))
+	}
+
+	l.CurrentState = s
+	l.state.Store(uint32(s))
+}
+
+// State returns the state of the lobby, it is safe to call from any goroutine
+func (l *Lobby) State() internal.CurrentState {
+	return internal.CurrentState(l.state.Load())
+}
+
+// reap reports why the lobby should close, lobbies close once every player
+// left after someone joined or when nobody sent anything for too long
+func (l *Lobby) reap(now time.Time) (string, bool) {
+	if l.CurrentState != internal.Created && l.handler.EmptyLobby() {
+		return "Every player left the lobby", true
+	}
+
+	if l.lobbyManager.IdlePolicy.Expired(l.CurrentState, l.LastActivity(), now) {
+		return fmt.Sprintf("The lobby closed after %v without activity",
+			l.lobbyManager.IdlePolicy.Timeout(l.CurrentState)), true
+	}
+
+	return "", false
+}
+
+// Shutdown stops every lobby this replica runs and waits until they handled
+// the payloads already sent to them, saved their state and released their
+// leases. Another replica or Recover after a restart picks the lobbies back
+// up. No lobby can be created or claimed once the manager shuts down.
+func (m *LobbyManager) Shutdown(ctx context.Context) error {
+	m.lobbiesMu.Lock()
+	m.draining = true
+	lobbies := make([]*Lobby, 0, len(m.Lobbies))
+	for _, l := range m.Lobbies {
+		lobbies = append(lobbies, l)
+	}
+	m.lobbiesMu.Unlock()
+
+	m.logger.Info("LobbyManager.Shutdown",
+		slog.Group("stopping lobbies",
+			slog.Int("lobbies", len(lobbies))))
+
+	m.cancel()
+
+	for _, l := range lobbies {
+		select {
+		case <-l.done:
+		case <-ctx.Done():
+			return services.WrapErrorf(ctx.Err(), services.ErrorCodeUnavailable, "LobbyManager.Shutdown")
+		}
+	}
+
+	return nil
+}
+
+// persist saves the state of a lobby that stops running on this replica
+func (m *LobbyManager) persist(l *Lobby) {
+	if err := l.lobbyRepo.SetLobby(toLobbyState(l)); err != nil {
+		m.logger.Error("LobbyManager.persist",
+			slog.Group("failed to save lobby",
+				slog.String("lobby_id", l.ID),
+				slog.String("reason", err.Error())))
+	}
+}
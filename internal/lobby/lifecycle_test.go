@@ -0,0 +1,88 @@
+package lobby
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/spacesedan/go-sequence/internal"
+	"github.com/spacesedan/go-sequence/internal/db"
+	"github.com/spacesedan/go-sequence/internal/pubsub"
+)
+
+// lobbies read the board cells relative to the repo root
+func TestMain(m *testing.M) {
+	if err := os.Chdir("../.."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func TestIdlePolicyExpired(t *testing.T) {
+	p := IdlePolicy{Created: time.Minute, InGame: time.Hour}
+	now := time.Now()
+
+	tests := []struct {
+		state internal.CurrentState
+		idle  time.Duration
+		want  bool
+	}{
+		{internal.Created, 30 * time.Second, false},
+		{internal.Created, 2 * time.Minute, true},
+		{internal.InGame, 2 * time.Minute, false},
+		{internal.InGame, 2 * time.Hour, true},
+		// states without a timeout never expire
+		{internal.InLobby, 24 * time.Hour, false},
+		{internal.Closed, 24 * time.Hour, false},
+	}
+
+	for _, test := range tests {
+		if got := p.Expired(test.state, now.Add(-test.idle), now); got != test.want {
+			t.Errorf("Expired(%v, %v idle) = %v, want %v", test.state, test.idle, got, test.want)
+		}
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	repos := db.NewMemoryRepos(logger)
+	m := NewLobbyManager(repos, pubsub.NewMemory(), logger, DefaultChatPolicy, nil, nil)
+
+	id, err := m.NewLobby(DevLobbySettings, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := m.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := m.Lobbies[id]; ok {
+		t.Error("Expected the lobby to stop running")
+	}
+
+	// the lobby is kept for the next replica
+	state, err := repos.Lobby.GetLobby(id)
+	if err != nil {
+		t.Fatalf("Expected the lobby to be saved: %v", err)
+	}
+	if state.CurrentState != internal.Created {
+		t.Errorf("Expected the saved lobby to be created, got %v", state.CurrentState)
+	}
+	if owner, _ := repos.Registry.LeaseOwner(id); owner != "" {
+		t.Errorf("Expected the lease to be released, owned by %q", owner)
+	}
+	if ids, _ := repos.Registry.ListLobbies(); len(ids) != 1 {
+		t.Errorf("Expected the lobby to stay registered, got %v", ids)
+	}
+
+	if _, err := m.NewLobby(DevLobbySettings, ""); !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("Expected no lobby to be created after shutting down, got %v", err)
+	}
+}
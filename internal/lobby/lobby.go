@@ -2,43 +2,31 @@ package lobby
 
 import (
 	"context"
-	"fmt"
 	"log/slog"
+	"path"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
 	"github.com/spacesedan/go-sequence/internal"
 	"github.com/spacesedan/go-sequence/internal/db"
 	"github.com/spacesedan/go-sequence/internal/game"
+	"github.com/spacesedan/go-sequence/internal/pubsub"
+	"github.com/spacesedan/go-sequence/internal/services"
+	"github.com/spacesedan/go-sequence/internal/tracing"
 )
 
-type LobbyChannel uint
-
-const (
-	UnknownChannel LobbyChannel = iota
-	RegisterChannel
-	DeregisterChannel
-	PayloadChannel
-	StateChannel
+var (
+	ErrLobbyNotFound  = services.NewErrorf(services.ErrorCodeNotFound, "Lobby not found; make sure you entered a valid lobby id")
+	ErrPlayerNotFound = services.NewErrorf(services.ErrorCodeNotFound, "Player not found; they are not in the lobby")
+	ErrLobbyFull      = services.NewErrorf(services.ErrorCodeLobbyFull, "cannot join lobby, already at max capacity")
+	ErrTooManyLobbies = services.NewErrorf(services.ErrorCodeUnavailable, "Too many lobbies are open right now; join one or try again later")
 )
 
-func (c LobbyChannel) String(lobby_id string) string {
-	switch c {
-	case UnknownChannel:
-		return "unknown"
-	case RegisterChannel:
-		return fmt.Sprintf("lobby.%v.registerChannel", lobby_id)
-	case DeregisterChannel:
-		return fmt.Sprintf("lobby.%v.unregisterChannel", lobby_id)
-	case PayloadChannel:
-		return fmt.Sprintf("lobby.%v.payloadChannel", lobby_id)
-	case StateChannel:
-		return fmt.Sprintf("lobby.%v.stateChannel", lobby_id)
-	default:
-		return ""
-	}
-}
-
 type Lobby struct {
 	// game data
 	ID              string
@@ -47,100 +35,253 @@ type Lobby struct {
 	Settings        internal.Settings
 	Players         map[string]*internal.Player
 	CurrentState    internal.CurrentState
+	Host            string
+	Muted           map[string]bool
+	PasswordHash    string
+	// Series is the score of the games played in the lobby, Rematch holds
+	// the players that voted to play again after a game
+	Series  *internal.Series
+	Rematch map[string]bool
+
+	// accessMu guards PasswordHash which is read by the http handlers
+	accessMu sync.Mutex
+	// playersMu guards Players and away for the http handlers, only the lobby
+	// goroutine changes them and it holds the lock while it does
+	playersMu sync.RWMutex
+	// away holds the players that lost their connection during a game and
+	// when they did, they keep their seat for ReconnectTTL
+	away map[string]time.Time
+
+	// Turn is the id of the player that plays next, seats maps the game
+	// player ids back to the lobby player ids
+	Turn           string
+	seats          map[uuid.UUID]string
+	matchStartedAt time.Time
+	// seatOrder is the turn order of the last game by lobby player id
+	seatOrder []string
+
+	// createdAt and lastActivity, unix nanoseconds of the last payload, are
+	// read by the admin area while the lobby runs
+	createdAt    time.Time
+	lastActivity atomic.Int64
+	// state mirrors CurrentState, which only the lobby goroutine changes with
+	// setState, for the other goroutines
+	state atomic.Uint32
+
+	// ctx is cancelled when the lobby has to stop, done is closed once it did
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
 
 	handler      LobbyHandler
 	lobbyRepo    db.LobbyRepo
 	lobbyManager *LobbyManager
 	logger       *slog.Logger
-	redisClient  *redis.Client
+	ps           pubsub.PubSub
+	sub          pubsub.Subscription
+	// spanCtx is the trace of the payload being handled, the responses it
+	// causes continue it
+	spanCtx context.Context
 
 	errorChan chan error
 }
 
-// Create a new lobby
-func (m *LobbyManager) NewLobby(settings internal.Settings, id ...string) string {
+// Create a new lobby, this replica owns it until it closes. A lobby with the
+// requested id that is owned by another replica is left as it is. Lobbies
+// without a requested id count against MaxLobbies. A lobby with a password is
+// protected by it from the start.
+func (m *LobbyManager) NewLobby(settings internal.Settings, password string, id ...string) (string, error) {
+	var hash string
+	if password != "" {
+		var err error
+		if hash, err = hashPassword(password); err != nil {
+			return "", err
+		}
+	}
+
 	var lobbyId string
 	m.lobbiesMu.Lock()
 	defer m.lobbiesMu.Unlock()
 
-	colors := make(map[string]bool, 3)
+	if m.draining {
+		return "", ErrShuttingDown
+	}
+	if len(id) == 0 {
+		if err := m.checkLobbyCap(); err != nil {
+			return "", err
+		}
+	}
+
+	for {
+		if len(id) != 0 {
+			lobbyId = id[0]
+		} else {
+			lobbyId = generateUniqueLobbyId()
+		}
 
-	if len(id) != 0 {
-		lobbyId = id[0]
-	} else {
-		lobbyId = generateUniqueLobbyId()
+		ok, err := m.registry.AcquireLease(lobbyId, m.ReplicaID, LeaseTTL)
+		if err != nil {
+			// without redis no other replica can own the lobby either
+			m.logger.Error("lobbyManager.NewLobby",
+				slog.Group("failed to acquire lease",
+					slog.String("lobbyId", lobbyId),
+					slog.String("reason", err.Error())))
+			break
+		}
+		if ok {
+			break
+		}
+		if len(id) != 0 {
+			return lobbyId, nil
+		}
 	}
 
 	m.logger.Info("lobbyManager.NewLobby",
 		slog.Group("Creating new lobby",
 			slog.String("lobbyId", lobbyId)))
 
+	l := m.newLobby(lobbyId, settings)
+	l.PasswordHash = hash
+
+	l.lobbyRepo.SetLobby(toLobbyState(l))
+	m.registry.AddLobby(lobbyId)
+
+	m.startLobby(l)
+
+	return lobbyId, nil
+}
+
+// checkLobbyCap returns ErrTooManyLobbies once MaxLobbies are running, the
+// caller must hold lobbiesMu
+func (m *LobbyManager) checkLobbyCap() error {
+	if m.MaxLobbies <= 0 {
+		return nil
+	}
+
+	ids, err := m.registry.ListLobbies()
+	if err != nil {
+		return services.WrapErrorf(err, services.ErrorCodeUnknown, "registry.ListLobbies")
+	}
+	if len(ids) >= m.MaxLobbies {
+		return ErrTooManyLobbies
+	}
+	return nil
+}
+
+// newLobby creates an empty lobby without starting it
+func (m *LobbyManager) newLobby(lobbyId string, settings internal.Settings) *Lobby {
+	colors := make(map[string]bool, 3)
+
 	colors["red"] = true
 	colors["blue"] = true
 	colors["green"] = true
 
 	l := &Lobby{
 		ID:              lobbyId,
-		Game:            game.NewGameService(),
+		Game:            game.NewGameService(game.BoardCellsJSONPath),
 		Settings:        settings,
-		CurrentState:    internal.InLobby,
 		ColorsAvailable: colors,
 		Players:         make(map[string]*internal.Player),
+		Muted:           make(map[string]bool),
+		Series:          internal.NewSeries(settings.BestOf),
+		Rematch:         make(map[string]bool),
+		away:            make(map[string]time.Time),
+		createdAt:       time.Now().UTC(),
 		lobbyManager:    m,
 		logger:          m.logger,
-		redisClient:     m.redisClient,
-		lobbyRepo:       db.NewLobbyRepo(m.redisClient, m.logger),
+		ps:              m.ps,
+		lobbyRepo:       m.lobbyRepo,
 		errorChan:       make(chan error, 1),
+		done:            make(chan struct{}),
 	}
+	l.setState(internal.Created)
+	l.touch(l.createdAt)
 
-	l.lobbyRepo.SetLobby(&internal.Lobby{
-		ID:              l.ID,
-		Players:         l.Players,
-		Settings:        l.Settings,
-		ColorsAvailable: l.ColorsAvailable,
-		CurrentState:    l.CurrentState,
-	})
+	return l
+}
 
-	l.handler = NewLobbyHandler(m.redisClient, l, l.logger)
+// startLobby registers the lobby and starts listening for its payloads, the
+// caller must hold lobbiesMu
+func (m *LobbyManager) startLobby(l *Lobby) {
+	l.handler = NewLobbyHandler(m.repos, m.ps, l, l.logger)
+	l.ctx, l.cancel = context.WithCancel(m.ctx)
 
-	m.Lobbies[lobbyId] = l
+	// subscribe before anyone can find the lobby so no payload is missed
+	l.sub = l.ps.PSubscribe(context.Background(), pubsub.LobbyPattern(l.ID))
 
-	l.redisClient.Publish(context.Background(), "lobby_manager.create", fmt.Sprintf("created a new lobby id: %v ", l.ID))
+	m.Lobbies[l.ID] = l
 
-	go l.Subscribe()
+	m.publishDirectoryUpdate(l.ID)
 
-	return lobbyId
+	go l.Subscribe()
 }
 
 func (m *LobbyManager) CloseLobby(id string) {
 	m.lobbiesMu.Lock()
-	defer m.lobbiesMu.Unlock()
-
-	lobby := m.Lobbies[id]
+	lobby, ok := m.Lobbies[id]
+	if ok {
+		delete(m.Lobbies, id)
+	}
+	m.lobbiesMu.Unlock()
 
-	lobby.lobbyRepo.DeleteLobby(lobby.ID)
+	if !ok {
+		return
+	}
 
 	m.logger.Info("lobbyManager.CloseLobby",
 		slog.Group("Closing Lobby",
 			slog.String("lobby_id", id)))
 
-	delete(m.Lobbies, id)
+	// the other lobbies aren't held up while redis is called
+	lobby.setState(internal.Closed)
+	playerIDs := make([]string, 0, len(lobby.Players)+len(lobby.away))
+	for playerID := range lobby.Players {
+		playerIDs = append(playerIDs, playerID)
+	}
+	for playerID := range lobby.away {
+		playerIDs = append(playerIDs, playerID)
+	}
+	m.deleteLobby(id, playerIDs)
+	m.registry.ReleaseLease(lobby.ID, m.ReplicaID)
+
+	m.publishDirectoryUpdate(id)
+}
+
+// deleteLobby removes a closed lobby from redis along with its players and
+// chat history
+func (m *LobbyManager) deleteLobby(id string, playerIDs []string) {
+	m.lobbyRepo.DeleteLobby(id)
+	for _, playerID := range playerIDs {
+		m.lobbyRepo.DeletePlayer(id, playerID)
+	}
+	m.repos.Chat.DeleteMessages(id)
+	m.registry.RemoveLobby(id)
 }
 
 // Subscribe listens to the lobby payload channel and once it recieves a payload it
-// sends a response to the appropriate channel
+// sends a response to the appropriate channel. It renews the lobby lease while
+// it runs, closes the lobby once it is empty or idle and hands the lobby back
+// to the lobby manager when it stops. Payloads sent before the lobby context
+// is cancelled are still handled.
 func (l *Lobby) Subscribe() {
-	var payload WsPayload
-	chanKey := fmt.Sprintf("lobby.%v.*", l.ID)
-	ctx, cancel := context.WithCancel(context.Background())
-	ticker := time.NewTicker(time.Minute)
-	sub := l.redisClient.PSubscribe(ctx, chanKey)
+	ctx := l.ctx
+	ticker := time.NewTicker(reapEvery)
+	lease := time.NewTicker(LeaseTTL / 3)
+	away := time.NewTicker(forfeitEvery(l.lobbyManager.ReconnectTTL))
+	sub := l.sub
+
+	exit := exitFailed
 
 	defer func() {
 		sub.Close()
 
 		ticker.Stop()
-		cancel()
+		lease.Stop()
+		away.Stop()
+		l.cancel()
+
+		l.lobbyManager.stopLobby(l, exit)
+		close(l.done)
 	}()
 
 	ch := sub.Channel()
@@ -151,35 +292,57 @@ func (l *Lobby) Subscribe() {
 			if !ok {
 				return
 			}
-			if err := payload.Unmarshal(msg.Payload); err != nil {
-				l.logger.Error("lobby.Subscribe",
-					slog.Group("failed to unmarshal payload",
-						slog.Any("reason", err)))
+			closed, err := l.handle(msg)
+			if err != nil {
 				return
 			}
-			switch msg.Channel {
-			case RegisterChannel.String(l.ID):
-				l.handler.RegisterPlayer(payload)
-			case StateChannel.String(l.ID):
-				l.handler.ChangeState()
-			case DeregisterChannel.String(l.ID):
-				l.handler.DeregisterPlayer(payload)
-			case PayloadChannel.String(l.ID):
-				l.handler.DispatchAction(payload)
+			if closed {
+				exit = exitClosed
+				return
 			}
 
+		case <-ctx.Done():
+			exit = l.drain(ch)
+			return
+
 		case err := <-l.errorChan:
 			l.logger.Error("lobby.Subscribe",
 				slog.Group("something went wrong",
 					slog.Any("reason", err)))
 
 			return
-		case <-ticker.C:
+		case now := <-ticker.C:
 			err := sub.Ping(ctx)
 			if err != nil {
 				return
 			}
-			if l.handler.EmptyLobby() {
+			if reason, ok := l.reap(now); ok {
+				l.logger.Info("lobby.Subscribe",
+					slog.Group("closing lobby",
+						slog.String("lobby_id", l.ID),
+						slog.String("state", l.CurrentState.String()),
+						slog.String("reason", reason)))
+				l.handler.NotifyClosed(reason)
+				exit = exitClosed
+				return
+			}
+		case now := <-away.C:
+			l.handler.ForfeitAway(now.Add(-l.lobbyManager.ReconnectTTL))
+		case <-lease.C:
+			ok, err := l.lobbyManager.renewLease(l.ID)
+			if err != nil {
+				// keep going, the ping fails too if redis is really gone
+				l.logger.Error("lobby.Subscribe",
+					slog.Group("failed to renew lease",
+						slog.String("lobby_id", l.ID),
+						slog.Any("reason", err)))
+				continue
+			}
+			if !ok {
+				l.logger.Info("lobby.Subscribe",
+					slog.Group("lease taken by another replica",
+						slog.String("lobby_id", l.ID)))
+				exit = exitLeaseLost
 				return
 			}
 		}
@@ -187,19 +350,234 @@ func (l *Lobby) Subscribe() {
 	}
 }
 
-func (l *Lobby) HasPlayer(username string) bool {
-	if _, ok := l.Players[username]; ok {
-		return true
+// drain handles the payloads that reached the lobby before it stopped
+func (l *Lobby) drain(ch <-chan *pubsub.Message) lobbyExit {
+	for {
+		select {
+		case msg, ok := <-ch:
+			if !ok {
+				return exitShutdown
+			}
+			closed, err := l.handle(msg)
+			if closed {
+				return exitClosed
+			}
+			if err != nil {
+				return exitShutdown
+			}
+		default:
+			return exitShutdown
+		}
+	}
+}
+
+// handle dispatches a payload to the lobby handler, it reports whether the
+// lobby should close. Payloads are handled to the end even when the lobby is
+// stopping.
+func (l *Lobby) handle(msg *pubsub.Message) (bool, error) {
+	var payload WsPayload
+	if err := payload.Unmarshal(msg.Payload); err != nil {
+		l.logger.Error("lobby.Subscribe",
+			slog.Group("failed to unmarshal payload",
+				slog.Any("reason", err)))
+		return false, err
+	}
+
+	l.touch(time.Now())
+
+	var span trace.Span
+	l.spanCtx, span = tracing.Start(tracing.Extract(context.Background(), payload.Trace), "lobby."+lobbyChannel(msg.Topic),
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("lobby.id", l.ID),
+			attribute.String("lobby.action", payloadLabel(payload.Action)),
+			attribute.String("player.id", payload.PlayerID)))
+	defer func() {
+		span.End()
+		l.spanCtx = nil
+	}()
+
+	switch msg.Topic {
+	case pubsub.LobbyTopic(l.ID, pubsub.AdminChannel):
+		return l.handler.AdminAction(payload), nil
+	case pubsub.LobbyTopic(l.ID, pubsub.RegisterChannel):
+		l.handler.RegisterPlayer(payload)
+	case pubsub.LobbyTopic(l.ID, pubsub.StateChannel):
+		l.handler.ChangeState()
+	case pubsub.LobbyTopic(l.ID, pubsub.UnregisterChannel):
+		l.handler.DeregisterPlayer(payload)
+	case pubsub.LobbyTopic(l.ID, pubsub.PayloadChannel):
+		l.handler.DispatchAction(payload)
+	}
+
+	return false, nil
+}
+
+// lobbyChannel returns the channel part of a lobby topic
+func lobbyChannel(t pubsub.Topic) string {
+	return path.Ext(string(t))[1:]
+}
+
+// traceContext returns the trace responses should continue
+func (l *Lobby) traceContext() context.Context {
+	if l.spanCtx == nil {
+		return context.Background()
+	}
+	return l.spanCtx
+}
+
+// touch records activity in the lobby
+func (l *Lobby) touch(at time.Time) {
+	l.lastActivity.Store(at.UnixNano())
+}
+
+// LastActivity returns when a player last sent something to the lobby
+func (l *Lobby) LastActivity() time.Time {
+	return time.Unix(0, l.lastActivity.Load()).UTC()
+}
+
+// HasPlayer reports whether the player has a seat, it is safe to call from any
+// goroutine
+func (l *Lobby) HasPlayer(playerID string) bool {
+	l.playersMu.RLock()
+	defer l.playersMu.RUnlock()
+
+	_, ok := l.Players[playerID]
+	return ok
+}
+
+// CanJoin returns ErrLobbyFull when every seat is taken, players that already
+// have a seat can always get back in. The seats of players that lost their
+// connection during a game are kept for them.
+func (l *Lobby) CanJoin(playerID string) error {
+	l.playersMu.RLock()
+	defer l.playersMu.RUnlock()
+
+	_, seated := l.Players[playerID]
+	_, away := l.away[playerID]
+	if !seated && !away && len(l.Players)+len(l.away) >= l.Settings.NumOfPlayers {
+		return ErrLobbyFull
+	}
+	return nil
+}
+
+// setPlayer seats the player or updates their seat
+func (l *Lobby) setPlayer(playerID string, ps *internal.Player) {
+	l.playersMu.Lock()
+	l.Players[playerID] = ps
+	l.playersMu.Unlock()
+}
+
+// deletePlayer gives up the player's seat
+func (l *Lobby) deletePlayer(playerID string) {
+	l.playersMu.Lock()
+	delete(l.Players, playerID)
+	l.playersMu.Unlock()
+}
+
+// setAway keeps the seat of a player that lost their connection during a
+// game
+func (l *Lobby) setAway(playerID string, at time.Time) {
+	l.playersMu.Lock()
+	l.away[playerID] = at
+	l.playersMu.Unlock()
+}
+
+// clearAway gives up the seats kept for the players, every kept seat when no
+// player is given
+func (l *Lobby) clearAway(playerIDs ...string) {
+	l.playersMu.Lock()
+	defer l.playersMu.Unlock()
+
+	if len(playerIDs) == 0 {
+		clear(l.away)
+	}
+	for _, id := range playerIDs {
+		delete(l.away, id)
+	}
+}
+
+// awaySince returns the players that lost their connection before at
+func (l *Lobby) awaySince(at time.Time) []string {
+	var ids []string
+	for id, since := range l.away {
+		if since.Before(at) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// numPlayers returns the number of seated players, it is safe to call from
+// any goroutine
+func (l *Lobby) numPlayers() int {
+	l.playersMu.RLock()
+	defer l.playersMu.RUnlock()
+
+	return len(l.Players) + len(l.away)
+}
+
+// LobbyState returns the stored state of a lobby, whichever replica runs it
+func (m *LobbyManager) LobbyState(id string) (*internal.Lobby, error) {
+	state, err := m.lobbyRepo.GetLobby(id)
+	if err != nil {
+		return nil, ErrLobbyNotFound
 	}
-	return false
+	return state, nil
+}
+
+// Leave gives up a player's seat, the other players are told they left and
+// the player's connections are closed
+func (m *LobbyManager) Leave(id, playerID string) error {
+	state, err := m.LobbyState(id)
+	if err != nil {
+		return err
+	}
+	if _, ok := state.Players[playerID]; !ok {
+		return ErrPlayerNotFound
+	}
+
+	return m.publishPayload(id, pubsub.PayloadChannel, WsPayload{Action: LeavePayloadEvent, PlayerID: playerID})
 }
 
 func toLobbyState(l *Lobby) *internal.Lobby {
+	l.accessMu.Lock()
+	defer l.accessMu.Unlock()
+
+	var board *game.Board
+	var gameState *game.State
+	var seats map[string]string
+	if l.CurrentState == internal.InGame {
+		b := l.Game.GetBoard()
+		board = &b
+
+		gs := l.Game.Snapshot()
+		gameState = &gs
+
+		seats = make(map[string]string, len(l.seats))
+		for seat, playerID := range l.seats {
+			seats[seat.String()] = playerID
+		}
+	}
+
 	return &internal.Lobby{
 		ID:              l.ID,
 		Players:         l.Players,
 		ColorsAvailable: l.ColorsAvailable,
 		Settings:        l.Settings,
 		CurrentState:    l.CurrentState,
+		Host:            l.Host,
+		Muted:           l.Muted,
+		PasswordHash:    l.PasswordHash,
+		Board:           board,
+		Turn:            l.Turn,
+		Game:            gameState,
+		Seats:           seats,
+		MatchStartedAt:  l.matchStartedAt,
+		CreatedAt:       l.createdAt,
+		LastActivity:    l.LastActivity(),
+		Series:          l.Series,
+		SeatOrder:       l.seatOrder,
+		Rematch:         l.Rematch,
 	}
 }
@@ -1,23 +1,50 @@
 package lobby
 
 import (
+	"context"
 	"encoding/json"
 	"log/slog"
 	"math/rand"
 	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
 	"github.com/spacesedan/go-sequence/internal"
+	"github.com/spacesedan/go-sequence/internal/db"
+	"github.com/spacesedan/go-sequence/internal/game"
+	"github.com/spacesedan/go-sequence/internal/pubsub"
+	"github.com/spacesedan/go-sequence/internal/services"
 )
 
 const charset = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 
 type WsResponse struct {
-	Action         ResponseEvent `json:"action"`
-	Message        string        `json:"message"`
-	Sender         string        `json:"sender"`
-	SkipSender     bool          `json:"skip_sender"`
-	ConnectedUsers []string      `json:"connected_users"`
+	Action  ResponseEvent `json:"action"`
+	Message string        `json:"message"`
+	// Sender and ConnectedUsers hold player ids, display names are looked up
+	// from the player state
+	Sender         string   `json:"sender"`
+	SkipSender     bool     `json:"skip_sender"`
+	ConnectedUsers []string `json:"connected_users"`
+	// ChatMessages holds the new message for chat responses or the whole
+	// history for chat history responses
+	ChatMessages []*internal.ChatMessage `json:"chat_messages,omitempty"`
+	// Cells are the board cells changed by a move, Turn is the id of the
+	// player that plays next and Winner the winning color once a game ends
+	Cells  []*game.BoardCell `json:"cells,omitempty"`
+	Turn   string            `json:"turn,omitempty"`
+	Winner string            `json:"winner,omitempty"`
+	// Dealt is set when the player whose turn begins was dealt new cards
+	Dealt bool `json:"dealt,omitempty"`
+	// Series is the score after a game
+	Series *internal.Series `json:"series,omitempty"`
+	// Code is the error code of a rejected action
+	Code services.ErrorCode `json:"code,omitempty"`
+	// PublishedAt is set when the lobby publishes the response, Trace carries
+	// the trace of the payload that caused it back to the clients
+	PublishedAt time.Time         `json:"published_at"`
+	Trace       map[string]string `json:"trace,omitempty"`
 }
 
 func (r WsResponse) MarshalBinary() ([]byte, error) {
@@ -29,9 +56,14 @@ func (r *WsResponse) Unmarshal(s string) error {
 }
 
 type WsPayload struct {
-	Action        PayloadEvent `json:"action"`
-	Message       string       `json:"message"`
-	Username      string       `json:"username"`
+	Action  PayloadEvent `json:"action"`
+	Message string       `json:"message"`
+	// PlayerID and Username are filled in by the server from the player
+	// session, Username is the display name the player asked for
+	PlayerID string `json:"player_id"`
+	Username string `json:"username"`
+	// Trace carries the trace context from the client to the lobby
+	Trace map[string]string `json:"trace,omitempty"`
 }
 
 func (p WsPayload) MarshalBinary() ([]byte, error) {
@@ -42,35 +74,72 @@ func (p *WsPayload) Unmarshal(s string) error {
 	return json.Unmarshal([]byte(s), &p)
 }
 
-
 type LobbyManager struct {
 	logger      *slog.Logger
-	redisClient *redis.Client
-
-	lobbiesMu      sync.Mutex
-	Lobbies        map[string]*Lobby
-	RegisterChan   chan *Lobby
-	UnregisterChan chan *Lobby
+	repos       db.Repos
+	ps          pubsub.PubSub
+	chatPolicy  ChatPolicy
+	invites     *InviteSigner
+	store       db.Store
+	leaderboard db.LeaderboardRepo
+
+	// ReplicaID identifies this server among the replicas sharing redis, it
+	// is the owner written on the lobby leases
+	ReplicaID string
+	registry  db.RegistryRepo
+	lobbyRepo db.LobbyRepo
+
+	// ReconnectTTL how long a player that disconnected keeps their seat
+	ReconnectTTL time.Duration
+	// MaxLobbies caps the lobbies running on every replica together, 0 means
+	// no cap
+	MaxLobbies int
+	// IdlePolicy closes lobbies nobody plays in
+	IdlePolicy IdlePolicy
+
+	// running is set while Run is handling lobbies
+	running atomic.Bool
+
+	// ctx is the parent of the lobby contexts, Shutdown cancels it
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	lobbiesMu sync.Mutex
+	Lobbies   map[string]*Lobby
+	// draining is set once Shutdown started, no lobby starts after that
+	draining bool
 }
 
-func NewLobbyManager(r *redis.Client, l *slog.Logger) *LobbyManager {
+// DefaultReconnectTTL how long a disconnected player keeps their seat unless
+// the manager is configured otherwise
+const DefaultReconnectTTL = 30 * time.Second
+
+func NewLobbyManager(repos db.Repos, ps pubsub.PubSub, l *slog.Logger, chat ChatPolicy, invites *InviteSigner, store db.Store) *LobbyManager {
 	l.Info("NewLobbyManager", slog.String("reason", "starting up lobby manager"))
-	devSettings := internal.Settings{
-		NumOfPlayers: 2,
-		MaxHandSize:  7,
-	}
+
+	ctx, cancel := context.WithCancel(context.Background())
 
 	lm := &LobbyManager{
 		logger:      l,
-		redisClient: r,
+		repos:       repos,
+		ps:          ps,
+		chatPolicy:  chat,
+		invites:     invites,
+		store:       store,
+		leaderboard: repos.Leaderboard,
 
-		Lobbies:        make(map[string]*Lobby),
-		RegisterChan:   make(chan *Lobby),
-		UnregisterChan: make(chan *Lobby),
-	}
+		ReplicaID: uuid.NewString(),
+		registry:  repos.Registry,
+		lobbyRepo: repos.Lobby,
 
-	lm.NewLobby(devSettings, "ASDA")
-	lm.NewLobby(devSettings, "JKLK")
+		ReconnectTTL: DefaultReconnectTTL,
+		IdlePolicy:   DefaultIdlePolicy,
+
+		ctx:    ctx,
+		cancel: cancel,
+
+		Lobbies: make(map[string]*Lobby),
+	}
 
 	return lm
 }
@@ -83,25 +152,56 @@ func generateUniqueLobbyId() string {
 	return string(result)
 }
 
+// Run takes over the lobbies of replicas that stopped renewing their leases
+// until Shutdown is called, every lobby runs and closes itself
 func (m *LobbyManager) Run() {
-	defer func() {
-		for _, lobby := range m.Lobbies {
-			m.CloseLobby(lobby.ID)
-		}
-		close(m.RegisterChan)
-		close(m.UnregisterChan)
-	}()
+	m.running.Store(true)
+	defer m.running.Store(false)
+
+	orphans := time.NewTicker(LeaseTTL)
+	defer orphans.Stop()
+
 	for {
 		select {
-		case lobby := <-m.RegisterChan:
-			m.Lobbies[lobby.ID] = lobby
-		case lobby := <-m.UnregisterChan:
-			m.CloseLobby(lobby.ID)
+		case <-m.ctx.Done():
+			return
+		case <-orphans.C:
+			m.claimOrphans()
 		}
 	}
 }
 
+// Running reports whether the manager is handling lobbies
+func (m *LobbyManager) Running() bool {
+	return m.running.Load()
+}
+
+// LobbyExists returns the lobby with the id, lobbies owned by another replica
+// are returned as a read only view of their state in redis
 func (m *LobbyManager) LobbyExists(lobbyId string) (*Lobby, bool) {
+	m.lobbiesMu.Lock()
 	l, ok := m.Lobbies[lobbyId]
-	return l, ok
+	m.lobbiesMu.Unlock()
+
+	if ok {
+		return l, true
+	}
+
+	return m.remoteLobby(lobbyId)
+}
+
+// TouchProfile saves the profile of a player under their current display name,
+// profiles are only kept when the lobby manager has a store
+func (m *LobbyManager) TouchProfile(playerID, displayName string) error {
+	if m.store == nil {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	return m.store.SaveProfile(&internal.Profile{
+		PlayerID:    playerID,
+		DisplayName: displayName,
+		CreatedAt:   now,
+		LastSeenAt:  now,
+	})
 }
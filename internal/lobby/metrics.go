@@ -0,0 +1,50 @@
+package lobby
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spacesedan/go-sequence/internal"
+)
+
+var lobbiesDesc = prometheus.NewDesc(
+	"sequence_lobbies",
+	"Lobbies owned by this replica by state, lobbies in the game state have a game in progress.",
+	[]string{"state"}, nil,
+)
+
+// Describe and Collect let the manager report its lobbies when the metrics are
+// scraped
+func (lm *LobbyManager) Describe(ch chan<- *prometheus.Desc) {
+	ch <- lobbiesDesc
+}
+
+func (lm *LobbyManager) Collect(ch chan<- prometheus.Metric) {
+	counts := map[internal.CurrentState]int{
+		internal.Created:  0,
+		internal.InLobby:  0,
+		internal.InGame:   0,
+		internal.Finished: 0,
+	}
+
+	lm.lobbiesMu.Lock()
+	for _, l := range lm.Lobbies {
+		counts[l.State()]++
+	}
+	lm.lobbiesMu.Unlock()
+
+	for state, n := range counts {
+		ch <- prometheus.MustNewConstMetric(lobbiesDesc, prometheus.GaugeValue, float64(n), state.String())
+	}
+}
+
+// payloadLabel keeps the action label of the payload metric to the known
+// actions, the action is sent by the client and could be anything
+func payloadLabel(action PayloadEvent) string {
+	switch action {
+	case JoinLobbyPayloadEvent, JoinGamePayloadEvent, LeavePayloadEvent,
+		ChatPayloadEvent, ChooseColorPayloadEvent, SetReadyStatusPayloadEvent,
+		MutePayloadEvent, UnmutePayloadEvent, ChangeNamePayloadEvent,
+		PlayCardPayloadEvent, ExchangeCardPayloadEvent, RematchPayloadEvent:
+		return string(action)
+	}
+	return string(UnknownPayloadEvent)
+}
@@ -0,0 +1,93 @@
+package lobby
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/spacesedan/go-sequence/internal"
+	"github.com/spacesedan/go-sequence/internal/services"
+)
+
+const (
+	MinDisplayNameLength = 3
+	MaxDisplayNameLength = 24
+)
+
+var (
+	ErrDisplayNameTooShort = services.NewErrorf(services.ErrorCodeInvalidArgument, "display name must be at least %d characters", MinDisplayNameLength)
+	ErrDisplayNameTooLong  = services.NewErrorf(services.ErrorCodeInvalidArgument, "display name must be at most %d characters", MaxDisplayNameLength)
+	ErrDisplayNameInvalid  = services.NewErrorf(services.ErrorCodeInvalidArgument, "display name can only contain letters, numbers, spaces, '-', '_' and '.'")
+)
+
+// ValidateDisplayName checks a player chosen display name and returns it with
+// surrounding whitespace removed and inner whitespace collapsed
+func ValidateDisplayName(name string) (string, error) {
+	name = strings.Join(strings.Fields(name), " ")
+
+	if !utf8.ValidString(name) {
+		return "", ErrDisplayNameInvalid
+	}
+
+	for _, r := range name {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r):
+		case r == ' ', r == '-', r == '_', r == '.':
+		default:
+			return "", ErrDisplayNameInvalid
+		}
+	}
+
+	switch n := utf8.RuneCountInString(name); {
+	case n < MinDisplayNameLength:
+		return "", ErrDisplayNameTooShort
+	case n > MaxDisplayNameLength:
+		return "", ErrDisplayNameTooLong
+	}
+
+	return name, nil
+}
+
+// uniqueDisplayName adds a numbered suffix to name until taken reports it as
+// free, names are compared without case
+func uniqueDisplayName(name string, taken func(string) bool) string {
+	if !taken(name) {
+		return name
+	}
+
+	for n := 2; ; n++ {
+		suffix := fmt.Sprintf("-%d", n)
+
+		base := []rune(name)
+		if max := MaxDisplayNameLength - len(suffix); len(base) > max {
+			base = base[:max]
+		}
+
+		candidate := string(base) + suffix
+		if !taken(candidate) {
+			return candidate
+		}
+	}
+}
+
+// displayNameTaken reports whether a player other than playerID already uses
+// name in the lobby
+func (l *Lobby) displayNameTaken(name, playerID string) bool {
+	for id, p := range l.Players {
+		if id != playerID && strings.EqualFold(p.Username, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// PlayerByName finds a player in the lobby using their display name
+func (l *Lobby) PlayerByName(name string) (*internal.Player, bool) {
+	for _, p := range l.Players {
+		if strings.EqualFold(p.Username, name) {
+			return p, true
+		}
+	}
+	return nil, false
+}
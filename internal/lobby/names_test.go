@@ -0,0 +1,55 @@
+package lobby
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateDisplayName(t *testing.T) {
+	testCases := []struct {
+		name string
+		in   string
+		want string
+		err  error
+	}{
+		{name: "valid", in: "Ada", want: "Ada"},
+		{name: "collapses whitespace", in: "  Ada   Lovelace ", want: "Ada Lovelace"},
+		{name: "allows punctuation", in: "ada_l.-1", want: "ada_l.-1"},
+		{name: "allows unicode letters", in: "Zoë", want: "Zoë"},
+		{name: "too short", in: " ab ", err: ErrDisplayNameTooShort},
+		{name: "too long", in: strings.Repeat("a", MaxDisplayNameLength+1), err: ErrDisplayNameTooLong},
+		{name: "markup", in: "<b>ada</b>", err: ErrDisplayNameInvalid},
+		{name: "control characters", in: "ada\tl", want: "ada l"},
+		{name: "invalid utf8", in: "ada\xff", err: ErrDisplayNameInvalid},
+	}
+
+	for _, tc := range testCases {
+		got, err := ValidateDisplayName(tc.in)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%v: expected error %v but got %v", tc.name, tc.err, err)
+		}
+		if got != tc.want {
+			t.Errorf("%v: expected %q but got %q", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestUniqueDisplayName(t *testing.T) {
+	taken := map[string]bool{"ada": true, "ada-2": true}
+	isTaken := func(name string) bool { return taken[strings.ToLower(name)] }
+
+	if got := uniqueDisplayName("bob", isTaken); got != "bob" {
+		t.Errorf("Expected a free name to be kept, got %q", got)
+	}
+
+	if got := uniqueDisplayName("Ada", isTaken); got != "Ada-3" {
+		t.Errorf("Expected the first free suffix, got %q", got)
+	}
+
+	long := strings.Repeat("a", MaxDisplayNameLength)
+	got := uniqueDisplayName(long, func(name string) bool { return name == long })
+	if len(got) != MaxDisplayNameLength || !strings.HasSuffix(got, "-2") {
+		t.Errorf("Expected the suffix to fit within the max length, got %q", got)
+	}
+}
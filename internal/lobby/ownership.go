@@ -0,0 +1,220 @@
+package lobby
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/spacesedan/go-sequence/internal"
+)
+
+// LeaseTTL is how long a replica owns a lobby without renewing its lease, the
+// owner renews it three times per TTL and other replicas take over lobbies
+// whose lease expired
+const LeaseTTL = 15 * time.Second
+
+// lobbyExit is why a lobby stopped listening for payloads
+type lobbyExit uint
+
+const (
+	// exitFailed the subscription broke, the lobby is handed to whichever
+	// replica claims it first
+	exitFailed lobbyExit = iota
+	// exitClosed every player left, the lobby idled or an admin closed it
+	exitClosed
+	// exitLeaseLost another replica owns the lobby now
+	exitLeaseLost
+	// exitShutdown the replica is shutting down, the lobby is saved for the
+	// next replica
+	exitShutdown
+)
+
+// stopLobby cleans up after a lobby stopped listening for payloads
+func (m *LobbyManager) stopLobby(l *Lobby, reason lobbyExit) {
+	if reason == exitClosed {
+		m.CloseLobby(l.ID)
+		return
+	}
+	if reason == exitShutdown {
+		m.persist(l)
+	}
+
+	m.lobbiesMu.Lock()
+	if m.Lobbies[l.ID] == l {
+		delete(m.Lobbies, l.ID)
+	}
+	m.lobbiesMu.Unlock()
+
+	m.logger.Info("LobbyManager.stopLobby",
+		slog.Group("dropped lobby",
+			slog.String("lobby_id", l.ID),
+			slog.Bool("lease_lost", reason == exitLeaseLost),
+			slog.Bool("shutdown", reason == exitShutdown)))
+
+	if reason == exitLeaseLost {
+		return
+	}
+
+	// the state is still in redis, releasing the lease lets the next orphan
+	// check pick it back up
+	if err := m.registry.ReleaseLease(l.ID, m.ReplicaID); err != nil {
+		m.logger.Error("LobbyManager.stopLobby",
+			slog.Group("failed to release lease",
+				slog.String("lobby_id", l.ID),
+				slog.String("reason", err.Error())))
+	}
+}
+
+// renewLease keeps the lobby owned by this replica, a lease that expired
+// without another replica taking it is acquired again
+func (m *LobbyManager) renewLease(lobbyID string) (bool, error) {
+	ok, err := m.registry.RenewLease(lobbyID, m.ReplicaID, LeaseTTL)
+	if err != nil || ok {
+		return ok, err
+	}
+
+	return m.registry.AcquireLease(lobbyID, m.ReplicaID, LeaseTTL)
+}
+
+// claim takes ownership of a lobby stored in redis and starts it on this
+// replica, it returns false when another replica owns the lobby
+func (m *LobbyManager) claim(lobbyID string) (bool, error) {
+	ok, err := m.registry.AcquireLease(lobbyID, m.ReplicaID, LeaseTTL)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	state, err := m.lobbyRepo.GetLobby(lobbyID)
+	if err != nil {
+		// the lobby expired while nobody owned it
+		m.registry.RemoveLobby(lobbyID)
+		m.registry.ReleaseLease(lobbyID, m.ReplicaID)
+		return false, err
+	}
+
+	m.lobbiesMu.Lock()
+	defer m.lobbiesMu.Unlock()
+
+	if m.draining {
+		m.registry.ReleaseLease(lobbyID, m.ReplicaID)
+		return false, nil
+	}
+	if _, ok := m.Lobbies[lobbyID]; ok {
+		return false, nil
+	}
+
+	l := m.restoreLobby(state)
+	l.lobbyRepo.SetLobby(toLobbyState(l))
+	m.startLobby(l)
+
+	m.logger.Info("LobbyManager.claim",
+		slog.Group("claimed lobby",
+			slog.String("lobby_id", l.ID),
+			slog.String("replica_id", m.ReplicaID),
+			slog.String("state", l.CurrentState.String()),
+			slog.Int("players", len(l.Players))))
+
+	return true, nil
+}
+
+// claimOrphans takes over the registered lobbies that have no owner, their
+// replica either crashed or lost its connection to redis
+func (m *LobbyManager) claimOrphans() {
+	ids, err := m.registry.ListLobbies()
+	if err != nil {
+		m.logger.Error("LobbyManager.claimOrphans",
+			slog.Group("failed to list lobbies",
+				slog.String("reason", err.Error())))
+		return
+	}
+
+	for _, id := range m.remoteIDs(ids) {
+		if _, err := m.claim(id); err != nil {
+			m.logger.Error("LobbyManager.claimOrphans",
+				slog.Group("failed to claim lobby",
+					slog.String("lobby_id", id),
+					slog.String("reason", err.Error())))
+		}
+	}
+}
+
+// remoteIDs returns the ids of the lobbies this replica doesn't own
+func (m *LobbyManager) remoteIDs(ids []string) []string {
+	m.lobbiesMu.Lock()
+	defer m.lobbiesMu.Unlock()
+
+	var remote []string
+	for _, id := range ids {
+		if _, ok := m.Lobbies[id]; !ok {
+			remote = append(remote, id)
+		}
+	}
+
+	return remote
+}
+
+// remoteLobby returns a read only view of a lobby owned by another replica,
+// it is enough to check whether a player can join. Players still join through
+// redis so the owner handles everything they send.
+func (m *LobbyManager) remoteLobby(lobbyID string) (*Lobby, bool) {
+	if lobbyID == "" {
+		return nil, false
+	}
+
+	state, err := m.lobbyRepo.GetLobby(lobbyID)
+	if err != nil {
+		return nil, false
+	}
+
+	return m.lobbyView(state), true
+}
+
+// lobbyView builds a lobby from its stored state without starting it
+func (m *LobbyManager) lobbyView(state *internal.Lobby) *Lobby {
+	players := state.Players
+	if players == nil {
+		players = make(map[string]*internal.Player)
+	}
+
+	l := &Lobby{
+		ID:              state.ID,
+		Settings:        state.Settings,
+		ColorsAvailable: state.ColorsAvailable,
+		Players:         players,
+		Host:            state.Host,
+		Muted:           state.Muted,
+		PasswordHash:    state.PasswordHash,
+		Turn:            state.Turn,
+		Series:          state.Series,
+		lobbyManager:    m,
+		logger:          m.logger,
+		ps:              m.ps,
+		lobbyRepo:       m.lobbyRepo,
+	}
+	l.CurrentState = state.CurrentState
+	l.state.Store(uint32(state.CurrentState))
+
+	return l
+}
+
+// remoteSummaries returns the directory listing of the public lobbies owned by
+// other replicas
+func (m *LobbyManager) remoteSummaries() []LobbySummary {
+	ids, err := m.registry.ListLobbies()
+	if err != nil {
+		m.logger.Error("LobbyManager.remoteSummaries",
+			slog.Group("failed to list lobbies",
+				slog.String("reason", err.Error())))
+		return nil
+	}
+
+	var lobbies []LobbySummary
+	for _, id := range m.remoteIDs(ids) {
+		state, err := m.lobbyRepo.GetLobby(id)
+		if err != nil || !state.Settings.IsPublic() {
+			continue
+		}
+		lobbies = append(lobbies, m.lobbyView(state).Summary())
+	}
+
+	return lobbies
+}
@@ -0,0 +1,186 @@
+package lobby
+
+import (
+	_ "embed"
+	"encoding/json"
+	"time"
+
+	"github.com/spacesedan/go-sequence/internal"
+	"github.com/spacesedan/go-sequence/internal/game"
+	"github.com/spacesedan/go-sequence/internal/services"
+)
+
+// ProtocolJSONV1 is the websocket subprotocol non browser clients negotiate to
+// receive typed JSON events instead of htmx fragments. Connections that don't
+// ask for a subprotocol keep getting html.
+const ProtocolJSONV1 = "sequence.v1+json"
+
+// SchemaVersion is the version of the published payload, response and event
+// shapes
+const SchemaVersion = "v1"
+
+// SchemaV1 is the JSON schema describing WsPayload, WsResponse and every
+// Event sent over the sequence.v1+json subprotocol
+//
+//go:embed schema/v1.json
+var SchemaV1 []byte
+
+type EventType string
+
+const (
+	RosterEvent        EventType = "lobby_roster"
+	PlayerUpdatedEvent EventType = "player_updated"
+	PlayerStatusEvent  EventType = "player_status"
+	ChatEvent          EventType = "chat_message"
+	ChatHistoryEvent   EventType = "chat_history"
+	BoardEvent         EventType = "board"
+	HandEvent          EventType = "hand"
+	ToastEvent         EventType = "toast"
+	TurnEvent          EventType = "turn"
+	GameOverEvent      EventType = "game_over"
+	ErrorEvent         EventType = "error"
+)
+
+// Event is the envelope every message sent to a JSON client is wrapped in
+type Event struct {
+	Version string    `json:"version"`
+	Type    EventType `json:"type"`
+	Data    any       `json:"data"`
+}
+
+func NewEvent(t EventType, data any) Event {
+	return Event{
+		Version: SchemaVersion,
+		Type:    t,
+		Data:    data,
+	}
+}
+
+func (e Event) MarshalBinary() ([]byte, error) {
+	return json.Marshal(e)
+}
+
+// ErrorData is sent when something a player did was rejected, Code is one
+// of the services error codes
+type ErrorData struct {
+	Code    services.ErrorCode `json:"code"`
+	Title   string             `json:"title"`
+	Message string             `json:"message"`
+}
+
+// NewErrorData translates err into what players are shown
+func NewErrorData(err error) ErrorData {
+	code := services.CodeOf(err)
+	return ErrorData{
+		Code:    code,
+		Title:   code.Title(),
+		Message: services.Message(err),
+	}
+}
+
+// RosterData lists every player currently in the lobby
+type RosterData struct {
+	LobbyID string             `json:"lobby_id"`
+	Players []*internal.Player `json:"players"`
+}
+
+// PlayerData is sent when a single player changes their color or ready status
+type PlayerData struct {
+	Player *internal.Player `json:"player"`
+}
+
+// StatusData is a lobby notice like "x joined"
+type StatusData struct {
+	Message string `json:"message"`
+}
+
+type ChatData struct {
+	SenderID string    `json:"sender_id"`
+	Sender   string    `json:"sender"`
+	Message  string    `json:"message"`
+	SentAt   time.Time `json:"sent_at"`
+}
+
+func NewChatData(m *internal.ChatMessage) ChatData {
+	return ChatData{
+		SenderID: m.SenderID,
+		Sender:   m.Sender,
+		Message:  m.Message,
+		SentAt:   m.SentAt,
+	}
+}
+
+// ChatHistoryData holds the recent chat messages sent to a player on join
+type ChatHistoryData struct {
+	Messages []ChatData `json:"messages"`
+}
+
+// CellData is the wire shape of a single board cell
+type CellData struct {
+	X          int    `json:"x"`
+	Y          int    `json:"y"`
+	Type       string `json:"type"`
+	Suit       string `json:"suit"`
+	IsCorner   bool   `json:"is_corner"`
+	CellLocked bool   `json:"cell_locked"`
+	ChipPlaced bool   `json:"chip_placed"`
+	ChipColor  string `json:"chip_color"`
+}
+
+// BoardData carries board cells, when Full is true Cells holds the whole board
+// otherwise it only holds the cells that changed
+type BoardData struct {
+	Full  bool       `json:"full"`
+	Cells []CellData `json:"cells"`
+}
+
+type HandData struct {
+	Cards []game.Card `json:"cards"`
+}
+
+// TurnData names the player that plays next
+type TurnData struct {
+	PlayerID string `json:"player_id"`
+	Username string `json:"username"`
+}
+
+// GameOverData is sent once a player or team completes enough sequences,
+// Series is the score of the lobby after the game
+type GameOverData struct {
+	WinnerColor string           `json:"winner_color"`
+	Message     string           `json:"message"`
+	Series      *internal.Series `json:"series,omitempty"`
+}
+
+type ToastData struct {
+	Title   string `json:"title"`
+	Content string `json:"content"`
+}
+
+// NewBoardData converts the whole board into BoardData
+func NewBoardData(b game.Board) BoardData {
+	var cells []CellData
+	for i := 0; i < game.BoardSize; i++ {
+		for j := 0; j < game.BoardSize; j++ {
+			if b[i][j] == nil {
+				continue
+			}
+			cells = append(cells, NewCellData(b[i][j]))
+		}
+	}
+
+	return BoardData{Full: true, Cells: cells}
+}
+
+func NewCellData(c *game.BoardCell) CellData {
+	return CellData{
+		X:          c.X,
+		Y:          c.Y,
+		Type:       c.Type,
+		Suit:       c.Suit,
+		IsCorner:   c.IsCorner,
+		CellLocked: c.CellLocked,
+		ChipPlaced: c.ChipPlaced,
+		ChipColor:  c.ChipColor,
+	}
+}
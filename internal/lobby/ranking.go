@@ -0,0 +1,116 @@
+package lobby
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/spacesedan/go-sequence/internal"
+	"github.com/spacesedan/go-sequence/internal/db"
+	"github.com/spacesedan/go-sequence/internal/ranking"
+)
+
+// rateMatch updates the ratings of everyone that played a ranked match and
+// adds them to the leaderboards
+func (m *LobbyManager) rateMatch(match *internal.Match) error {
+	if m.store == nil {
+		return nil
+	}
+
+	ids := make([]string, 0, len(match.Players))
+	for _, p := range match.Players {
+		ids = append(ids, p.PlayerID)
+	}
+
+	stored, err := m.store.GetRatings(ids)
+	if err != nil {
+		return err
+	}
+
+	current := make(map[string]float64, len(stored))
+	for id, r := range stored {
+		current[id] = r.Rating
+	}
+
+	deltas := ranking.Update(match.Players, current)
+	if len(deltas) == 0 {
+		return nil
+	}
+
+	var ratings []*internal.Rating
+	for _, p := range match.Players {
+		r, ok := stored[p.PlayerID]
+		if !ok {
+			r = &internal.Rating{PlayerID: p.PlayerID, Rating: ranking.DefaultRating}
+		}
+
+		r.Rating += deltas[p.PlayerID]
+		r.Games++
+		if p.Winner {
+			r.Wins++
+		}
+		r.UpdatedAt = match.EndedAt
+		ratings = append(ratings, r)
+	}
+
+	if err := m.store.SaveRatings(ratings); err != nil {
+		return err
+	}
+
+	for _, r := range ratings {
+		if err := m.leaderboard.Record(r.PlayerID, r.Rating, deltas[r.PlayerID], match.EndedAt); err != nil {
+			m.logger.Error("LobbyManager.rateMatch",
+				slog.Group("failed to update leaderboard",
+					slog.String("player_id", r.PlayerID),
+					slog.String("reason", err.Error())))
+		}
+	}
+
+	return nil
+}
+
+// Leaderboard returns the best players of the current period with their
+// display names
+func (m *LobbyManager) Leaderboard(period internal.LeaderboardPeriod, limit int) ([]internal.LeaderboardEntry, error) {
+	entries, err := m.leaderboard.Top(period, time.Now(), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range entries {
+		entries[i].DisplayName = entries[i].PlayerID
+		if m.store == nil {
+			continue
+		}
+
+		p, err := m.store.GetProfile(entries[i].PlayerID)
+		if errors.Is(err, db.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries[i].DisplayName = p.DisplayName
+	}
+
+	return entries, nil
+}
+
+// Rating returns the rating of a player, players that never played a ranked
+// game get the default rating
+func (m *LobbyManager) Rating(playerID string) (*internal.Rating, error) {
+	r := &internal.Rating{PlayerID: playerID, Rating: ranking.DefaultRating}
+	if m.store == nil {
+		return r, nil
+	}
+
+	ratings, err := m.store.GetRatings([]string{playerID})
+	if err != nil {
+		return nil, err
+	}
+	if stored, ok := ratings[playerID]; ok {
+		r = stored
+	}
+
+	return r, nil
+}
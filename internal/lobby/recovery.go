@@ -0,0 +1,131 @@
+package lobby
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spacesedan/go-sequence/internal"
+	"github.com/spacesedan/go-sequence/internal/game"
+)
+
+// DevLobbyIDs are the lobbies created by NewDevLobbies
+var DevLobbyIDs = []string{"ASDA", "JKLK"}
+
+// DevLobbySettings are the settings of the dev lobbies
+var DevLobbySettings = internal.Settings{
+	NumOfPlayers: 2,
+	MaxHandSize:  7,
+	Visibility:   internal.VisibilityPublic,
+}
+
+// NewDevLobbies creates lobbies with well known ids so they can be joined
+// without creating one first, only meant for local development
+func (m *LobbyManager) NewDevLobbies() {
+	for _, id := range DevLobbyIDs {
+		if _, ok := m.LobbyExists(id); ok {
+			continue
+		}
+		m.NewLobby(DevLobbySettings, "", id)
+	}
+}
+
+// Recover rebuilds the lobbies stored in redis that no replica owns, games in
+// progress resume where they left off and players get their seat back when
+// they reconnect. It is called once on startup and returns the number of
+// lobbies recovered.
+func (m *LobbyManager) Recover() (int, error) {
+	ids, err := m.lobbyRepo.ListLobbyIDs()
+	if err != nil {
+		return 0, err
+	}
+
+	var recovered int
+	for _, id := range ids {
+		// lobbies stored before the registry existed are registered here
+		if err := m.registry.AddLobby(id); err != nil {
+			return recovered, err
+		}
+
+		ok, err := m.claim(id)
+		if err != nil {
+			m.logger.Error("LobbyManager.Recover",
+				slog.Group("failed to read lobby",
+					slog.String("lobby_id", id),
+					slog.String("reason", err.Error())))
+			continue
+		}
+		if ok {
+			recovered++
+		}
+	}
+
+	return recovered, nil
+}
+
+// restoreLobby rebuilds a lobby from its stored state
+func (m *LobbyManager) restoreLobby(state *internal.Lobby) *Lobby {
+	l := m.newLobby(state.ID, state.Settings)
+
+	l.setState(state.CurrentState)
+	l.Host = state.Host
+	l.PasswordHash = state.PasswordHash
+	l.Turn = state.Turn
+
+	if !state.CreatedAt.IsZero() {
+		l.createdAt = state.CreatedAt
+	}
+	if !state.LastActivity.IsZero() {
+		l.touch(state.LastActivity)
+	}
+
+	if state.ColorsAvailable != nil {
+		l.ColorsAvailable = state.ColorsAvailable
+	}
+	if state.Players != nil {
+		l.Players = state.Players
+	}
+	if state.Muted != nil {
+		l.Muted = state.Muted
+	}
+	if state.Series != nil {
+		l.Series = state.Series
+	}
+	if state.Rematch != nil {
+		l.Rematch = state.Rematch
+	}
+	l.seatOrder = state.SeatOrder
+
+	if l.CurrentState != internal.InGame {
+		return l
+	}
+
+	// a game can't be resumed without its state, send the players back to
+	// the lobby instead
+	if state.Game == nil {
+		l.setState(internal.InLobby)
+		l.Turn = ""
+		for _, ps := range l.Players {
+			ps.Ready = false
+			ps.Hand = nil
+		}
+		return l
+	}
+
+	l.Game = game.RestoreGameService(*state.Game)
+	l.matchStartedAt = state.MatchStartedAt
+	l.seats = make(map[uuid.UUID]string, len(state.Seats))
+	for seat, playerID := range state.Seats {
+		id, err := uuid.Parse(seat)
+		if err != nil {
+			continue
+		}
+		l.seats[id] = playerID
+		// players that lost their connection get ReconnectTTL to come back
+		if _, ok := l.Players[playerID]; !ok {
+			l.away[playerID] = time.Now()
+		}
+	}
+
+	return l
+}
@@ -5,14 +5,12 @@ import (
 	"log/slog"
 	"time"
 
-	"github.com/go-redis/redis/v8"
 	"github.com/spacesedan/go-sequence/internal"
 	"github.com/spacesedan/go-sequence/internal/db"
 )
 
-
 type LobbyService interface {
-	NewPlayer(string) (*internal.Player, error)
+	NewPlayer(id, username string) (*internal.Player, error)
 
 	SetLobby(*internal.Lobby) error
 
@@ -20,33 +18,39 @@ type LobbyService interface {
 	GetPlayer(string) (*internal.Player, error)
 	SetExpiration(string, time.Duration)
 
-	GetPlayerNames() []string
-    GetCurrentState() internal.CurrentState
+	GetPlayerIDs() []string
+	GetCurrentState() internal.CurrentState
+
+	AddChatMessage(*internal.ChatMessage) error
+	GetChatHistory() ([]*internal.ChatMessage, error)
 }
 
 type lobbyService struct {
-	lobby  *Lobby
-	repo   db.LobbyRepo
-	logger *slog.Logger
+	lobby    *Lobby
+	repo     db.LobbyRepo
+	chatRepo db.ChatRepo
+	logger   *slog.Logger
 }
 
-func NewLobbyService(r *redis.Client, l *Lobby, logger *slog.Logger) LobbyService {
+func NewLobbyService(repos db.Repos, l *Lobby, logger *slog.Logger) LobbyService {
 	return &lobbyService{
-		lobby:  l,
-		repo:   db.NewLobbyRepo(r, logger),
-		logger: logger,
+		lobby:    l,
+		repo:     repos.Lobby,
+		chatRepo: repos.Chat,
+		logger:   logger,
 	}
 }
 
 func (s *lobbyService) SetLobby(l *internal.Lobby) error {
-    return s.repo.SetLobby(l)
+	return s.repo.SetLobby(l)
 }
 
-func (s *lobbyService) NewPlayer(username string) (*internal.Player, error) {
+func (s *lobbyService) NewPlayer(id, username string) (*internal.Player, error) {
 	s.logger.Info("lobbyService.NewPlayer",
 		fmt.Sprintf("player: %s joined: %s", username, s.lobby.ID), "OK")
 
 	err := s.repo.SetPlayer(s.lobby.ID, &internal.Player{
+		ID:       id,
 		Username: username,
 		LobbyId:  s.lobby.ID,
 	})
@@ -54,7 +58,7 @@ func (s *lobbyService) NewPlayer(username string) (*internal.Player, error) {
 		return nil, err
 	}
 
-	ps, err := s.repo.GetPlayer(s.lobby.ID, username)
+	ps, err := s.repo.GetPlayer(s.lobby.ID, id)
 	if err != nil {
 		return nil, err
 	}
@@ -66,34 +70,44 @@ func (s *lobbyService) SetPlayer(state *internal.Player) error {
 	return s.repo.SetPlayer(s.lobby.ID, state)
 }
 
-func (s *lobbyService) GetPlayer(username string) (*internal.Player, error) {
+func (s *lobbyService) GetPlayer(id string) (*internal.Player, error) {
 	s.logger.Info("lobbyService.GetPlayer")
-	ps, err := s.repo.GetPlayer(s.lobby.ID, username)
+	ps, err := s.repo.GetPlayer(s.lobby.ID, id)
 	if err != nil {
 		return nil, err
 	}
 
-	s.SetExpiration(username, time.Duration(30*time.Minute))
+	s.SetExpiration(id, time.Duration(30*time.Minute))
 	return ps, nil
 }
 
-func (s *lobbyService) GetPlayerNames() []string {
-	var playerNames []string
-	for p := range s.lobby.Players {
-		playerNames = append(playerNames, p)
+func (s *lobbyService) GetPlayerIDs() []string {
+	var playerIDs []string
+	for id := range s.lobby.Players {
+		playerIDs = append(playerIDs, id)
 	}
-	return playerNames
+	return playerIDs
 }
 
 func (s lobbyService) GetCurrentState() internal.CurrentState {
-    return s.lobby.CurrentState
+	return s.lobby.CurrentState
 }
 
-func (s *lobbyService) SetExpiration(username string, dur time.Duration) {
+func (s *lobbyService) SetExpiration(id string, dur time.Duration) {
 	// in order to prevent having tons of unused data store in the db
 	// i could shorten the expiration of unregistered users to 30 secs
 	// if a user reconnects in that time span it the expiration time goes back
 	// to the regular expiration time
-	s.repo.Expire(s.lobby.ID, username, dur)
+	s.repo.Expire(s.lobby.ID, id, dur)
+
+}
+
+// AddChatMessage stores a message in the lobby chat history
+func (s *lobbyService) AddChatMessage(m *internal.ChatMessage) error {
+	return s.chatRepo.AddMessage(s.lobby.ID, m, s.lobby.lobbyManager.chatPolicy.HistorySize)
+}
 
+// GetChatHistory gets the most recent messages sent to the lobby
+func (s *lobbyService) GetChatHistory() ([]*internal.ChatMessage, error) {
+	return s.chatRepo.GetMessages(s.lobby.ID)
 }
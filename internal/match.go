@@ -0,0 +1,74 @@
+package internal
+
+import (
+	"time"
+
+	"github.com/spacesedan/go-sequence/internal/game"
+)
+
+// Profile is what we remember about a player across lobbies
+type Profile struct {
+	PlayerID    string    `json:"player_id"`
+	DisplayName string    `json:"display_name"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+}
+
+// Match a finished game
+type Match struct {
+	ID          string        `json:"id"`
+	LobbyID     string        `json:"lobby_id"`
+	StartedAt   time.Time     `json:"started_at"`
+	EndedAt     time.Time     `json:"ended_at"`
+	WinnerColor string        `json:"winner_color"`
+	Players     []MatchPlayer `json:"players"`
+	// FinalBoard and Moves are only loaded when a single match is read
+	FinalBoard game.Board  `json:"final_board"`
+	Moves      []MatchMove `json:"moves,omitempty"`
+}
+
+// MatchPlayer a player that took part in a match
+type MatchPlayer struct {
+	PlayerID    string `json:"player_id"`
+	DisplayName string `json:"display_name"`
+	Color       string `json:"color"`
+	Winner      bool   `json:"winner"`
+}
+
+// MatchMove a single turn of a match
+type MatchMove struct {
+	Turn      int       `json:"turn"`
+	PlayerID  string    `json:"player_id"`
+	Card      game.Card `json:"card"`
+	X         int       `json:"x"`
+	Y         int       `json:"y"`
+	Removed   bool      `json:"removed"`
+	Sequences int       `json:"sequences"`
+	PlayedAt  time.Time `json:"played_at"`
+}
+
+// Player returns the match player with the id
+func (m *Match) Player(playerID string) (MatchPlayer, bool) {
+	for _, p := range m.Players {
+		if p.PlayerID == playerID {
+			return p, true
+		}
+	}
+	return MatchPlayer{}, false
+}
+
+// Winners returns the players on the winning color
+func (m *Match) Winners() []MatchPlayer {
+	var winners []MatchPlayer
+	for _, p := range m.Players {
+		if p.Winner {
+			winners = append(winners, p)
+		}
+	}
+	return winners
+}
+
+// Duration how long the match took
+func (m *Match) Duration() time.Duration {
+	return m.EndedAt.Sub(m.StartedAt)
+}
@@ -0,0 +1,152 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "sequence"
+
+var (
+	// WsClients is the number of open lobby websocket connections
+	WsClients = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "websocket_clients",
+		Help:      "Number of connected websocket clients.",
+	})
+
+	// Payloads counts the payloads players sent to their lobby by action
+	Payloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "payloads_total",
+		Help:      "Payloads received by the lobbies by action.",
+	}, []string{"action"})
+
+	// Responses counts the responses lobbies published by action
+	Responses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "responses_total",
+		Help:      "Responses published by the lobbies by action.",
+	}, []string{"action"})
+
+	// ResponseDelivery is the time from a lobby publishing a response to the
+	// response being written to a websocket
+	ResponseDelivery = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "response_delivery_seconds",
+		Help:      "Time from publishing a response to writing it to a websocket.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"action"})
+
+	// GameDuration is how long finished games took
+	GameDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "game_duration_seconds",
+		Help:      "Duration of finished games.",
+		Buckets:   []float64{60, 180, 300, 600, 900, 1200, 1800, 2700, 3600},
+	})
+
+	// RejectedMoves counts the moves that were not played by error code
+	RejectedMoves = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rejected_moves_total",
+		Help:      "Moves rejected by the game by error code.",
+	}, []string{"code"})
+
+	// RateLimited counts the requests and messages turned away by the rate
+	// limits by what was limited
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_total",
+		Help:      "Requests and websocket messages rejected by the rate limits.",
+	}, []string{"limit"})
+
+	// RedisDuration and RedisErrors are collected for every redis command
+	// sent by the repos and the pubsub
+	RedisDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "redis_command_duration_seconds",
+		Help:      "Latency of redis commands by command.",
+		Buckets:   []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25},
+	}, []string{"command"})
+
+	RedisErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "redis_command_errors_total",
+		Help:      "Failed redis commands by command.",
+	}, []string{"command"})
+)
+
+// NewRegistry creates a registry with the server metrics, the go runtime
+// metrics and any extra collectors
+func NewRegistry(extra ...prometheus.Collector) *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		WsClients,
+		Payloads,
+		Responses,
+		ResponseDelivery,
+		GameDuration,
+		RejectedMoves,
+		RateLimited,
+		RedisDuration,
+		RedisErrors,
+	)
+	reg.MustRegister(extra...)
+
+	return reg
+}
+
+// Handler serves the metrics of reg in the prometheus text format
+func Handler(reg *prometheus.Registry) http.Handler {
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{Registry: reg})
+}
+
+type startKey struct{}
+
+// RedisHook times every command sent through a redis client
+type RedisHook struct{}
+
+func (RedisHook) BeforeProcess(ctx context.Context, cmd goredis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, startKey{}, time.Now()), nil
+}
+
+func (RedisHook) AfterProcess(ctx context.Context, cmd goredis.Cmder) error {
+	observeRedis(ctx, cmd.Name(), cmd.Err())
+	return nil
+}
+
+func (RedisHook) BeforeProcessPipeline(ctx context.Context, cmds []goredis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, startKey{}, time.Now()), nil
+}
+
+func (RedisHook) AfterProcessPipeline(ctx context.Context, cmds []goredis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if err = cmd.Err(); err != nil && !errors.Is(err, goredis.Nil) {
+			break
+		}
+	}
+	observeRedis(ctx, "pipeline", err)
+	return nil
+}
+
+func observeRedis(ctx context.Context, command string, err error) {
+	if start, ok := ctx.Value(startKey{}).(time.Time); ok {
+		RedisDuration.WithLabelValues(command).Observe(time.Since(start).Seconds())
+	}
+
+	// a missing key is an answer, not a failure
+	if err != nil && !errors.Is(err, goredis.Nil) {
+		RedisErrors.WithLabelValues(command).Inc()
+	}
+}
@@ -1,8 +1,15 @@
 package internal
 
+import "github.com/spacesedan/go-sequence/internal/game"
+
 type Player struct {
+	// ID is the stable player id kept in the session, Username is the display
+	// name other players see and can change between games
+	ID       string `json:"id"`
 	LobbyId  string `json:"lobby_id"`
 	Username string `json:"username"`
 	Color    string `json:"color"`
 	Ready    bool   `json:"ready"`
+	// Hand is only set while a game is being played
+	Hand []game.Card `json:"hand,omitempty"`
 }
@@ -0,0 +1,156 @@
+package pubsub
+
+import (
+	"context"
+	"path"
+	"sync"
+)
+
+// memoryPubSub PubSub that delivers messages inside the process, it lets the
+// server run as a single node without redis and makes tests deterministic
+type memoryPubSub struct {
+	mu   sync.Mutex
+	subs map[*memorySubscription]struct{}
+}
+
+func NewMemory() PubSub {
+	return &memoryPubSub{
+		subs: make(map[*memorySubscription]struct{}),
+	}
+}
+
+// Publish queues the message for every matching subscription, it never waits
+// on slow subscribers so a subscriber can publish to a topic it listens to
+func (m *memoryPubSub) Publish(ctx context.Context, topic Topic, payload []byte) error {
+	msg := &Message{Topic: topic, Payload: string(payload)}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for s := range m.subs {
+		if s.matches(topic) {
+			s.push(msg)
+		}
+	}
+
+	return nil
+}
+
+func (m *memoryPubSub) Subscribe(ctx context.Context, topics ...Topic) Subscription {
+	return m.subscribe(topics, nil)
+}
+
+func (m *memoryPubSub) PSubscribe(ctx context.Context, patterns ...Topic) Subscription {
+	return m.subscribe(nil, patterns)
+}
+
+func (m *memoryPubSub) subscribe(topics, patterns []Topic) Subscription {
+	s := &memorySubscription{
+		ps:       m,
+		topics:   topics,
+		patterns: patterns,
+		notify:   make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		ch:       make(chan *Message),
+	}
+
+	m.mu.Lock()
+	m.subs[s] = struct{}{}
+	m.mu.Unlock()
+
+	go s.forward()
+
+	return s
+}
+
+type memorySubscription struct {
+	ps       *memoryPubSub
+	topics   []Topic
+	patterns []Topic
+
+	// queue holds the messages not yet read from ch
+	mu     sync.Mutex
+	queue  []*Message
+	notify chan struct{}
+
+	done chan struct{}
+	once sync.Once
+	ch   chan *Message
+}
+
+func (s *memorySubscription) matches(topic Topic) bool {
+	for _, t := range s.topics {
+		if t == topic {
+			return true
+		}
+	}
+	for _, p := range s.patterns {
+		if ok, _ := path.Match(string(p), string(topic)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *memorySubscription) push(msg *Message) {
+	s.mu.Lock()
+	s.queue = append(s.queue, msg)
+	s.mu.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// forward hands the queued messages to the channel reader one at a time
+func (s *memorySubscription) forward() {
+	defer close(s.ch)
+
+	for {
+		s.mu.Lock()
+		if len(s.queue) == 0 {
+			s.mu.Unlock()
+			select {
+			case <-s.notify:
+				continue
+			case <-s.done:
+				return
+			}
+		}
+		msg := s.queue[0]
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+
+		select {
+		case s.ch <- msg:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *memorySubscription) Channel() <-chan *Message {
+	return s.ch
+}
+
+func (s *memorySubscription) Ping(ctx context.Context) error {
+	select {
+	case <-s.done:
+		return ErrClosed
+	default:
+		return nil
+	}
+}
+
+func (s *memorySubscription) Close() error {
+	s.once.Do(func() {
+		s.ps.mu.Lock()
+		delete(s.ps.subs, s)
+		s.ps.mu.Unlock()
+
+		close(s.done)
+	})
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func receive(t *testing.T, sub Subscription) *Message {
+	t.Helper()
+
+	select {
+	case msg := <-sub.Channel():
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("Expected a message")
+		return nil
+	}
+}
+
+func TestMemoryPubSub(t *testing.T) {
+	ctx := context.Background()
+	ps := NewMemory()
+
+	lobby := ps.PSubscribe(ctx, LobbyPattern("ASDA"))
+	defer lobby.Close()
+
+	players := ps.Subscribe(ctx, LobbyTopic("ASDA", ResponseChannel))
+	defer players.Close()
+
+	ps.Publish(ctx, LobbyTopic("JKLK", PayloadChannel), []byte("other lobby"))
+	ps.Publish(ctx, LobbyTopic("ASDA", RegisterChannel), []byte("first"))
+	ps.Publish(ctx, LobbyTopic("ASDA", ResponseChannel), []byte("second"))
+
+	if msg := receive(t, lobby); msg.Topic != LobbyTopic("ASDA", RegisterChannel) || msg.Payload != "first" {
+		t.Errorf("Expected the first message in order, got %+v", msg)
+	}
+
+	if msg := receive(t, lobby); msg.Payload != "second" {
+		t.Errorf("Expected the pattern to match the response channel, got %+v", msg)
+	}
+
+	if msg := receive(t, players); msg.Payload != "second" {
+		t.Errorf("Expected only the response, got %+v", msg)
+	}
+}
+
+func TestMemoryPubSubClose(t *testing.T) {
+	ctx := context.Background()
+	ps := NewMemory()
+
+	sub := ps.Subscribe(ctx, DirectoryTopic)
+	sub.Close()
+
+	if err := sub.Ping(ctx); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed but got %v", err)
+	}
+
+	if err := ps.Publish(ctx, DirectoryTopic, []byte("ASDA")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := <-sub.Channel(); ok {
+		t.Error("Expected the channel to be closed")
+	}
+}
@@ -1,26 +1,76 @@
 package pubsub
 
 import (
-	"time"
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrClosed is returned when using a subscription after it was closed
+var ErrClosed = errors.New("pubsub: subscription closed")
+
+// Topic is the name of a channel messages are published to, subscribing with a
+// pattern uses glob style topics like lobby.ASDA.*
+type Topic string
 
-	"github.com/go-redis/redis/v8"
+// LobbyChannel is one of the channels of a lobby, the lobby owner listens to
+// every channel but the response channel which the players listen to. Only the
+// server publishes to the admin channel.
+type LobbyChannel string
+
+const (
+	RegisterChannel   LobbyChannel = "registerChannel"
+	UnregisterChannel LobbyChannel = "unregisterChannel"
+	PayloadChannel    LobbyChannel = "payloadChannel"
+	StateChannel      LobbyChannel = "stateChannel"
+	ResponseChannel   LobbyChannel = "responseChannel"
+	AdminChannel      LobbyChannel = "adminChannel"
 )
 
-const healthCheckPerion = time.Minute
+// DirectoryTopic is published to whenever a lobby is created, closed or its
+// player count or state changes so lobby listings can refresh
+const DirectoryTopic Topic = "lobby_manager.create"
 
-type Publisher struct {
-	*redis.Client
+// LobbyTopic returns the topic of one of the lobby channels
+func LobbyTopic(lobbyID string, c LobbyChannel) Topic {
+	return Topic(fmt.Sprintf("lobby.%v.%v", lobbyID, c))
 }
 
-func NewPublisher(r *redis.Client) *Publisher {
-	return &Publisher{r}
+// LobbyPattern returns the pattern matching every channel of a lobby
+func LobbyPattern(lobbyID string) Topic {
+	return Topic(fmt.Sprintf("lobby.%v.*", lobbyID))
 }
 
-type Subscriber struct {
-	*redis.Client
+// Message is a payload received on a topic
+type Message struct {
+	Topic   Topic
+	Payload string
 }
 
+type Publisher interface {
+	Publish(ctx context.Context, topic Topic, payload []byte) error
+}
+
+// Subscriber subscriptions are active once Subscribe or PSubscribe return,
+// every message published after that is delivered
+type Subscriber interface {
+	// Subscribe listens to the given topics
+	Subscribe(ctx context.Context, topics ...Topic) Subscription
+	// PSubscribe listens to every topic matching the given patterns
+	PSubscribe(ctx context.Context, patterns ...Topic) Subscription
+}
+
+// PubSub is the transport lobbies and clients talk through
+type PubSub interface {
+	Publisher
+	Subscriber
+}
 
-func NewSubscriber(r *redis.Client) *Subscriber {
-	return &Subscriber{r}
+type Subscription interface {
+	// Channel delivers the messages in the order they were published, it is
+	// closed once the subscription is closed
+	Channel() <-chan *Message
+	// Ping checks the subscription is still alive
+	Ping(ctx context.Context) error
+	Close() error
 }
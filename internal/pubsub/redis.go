@@ -0,0 +1,93 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// redisPubSub PubSub backed by redis, every replica connected to the same
+// redis sees the same messages
+type redisPubSub struct {
+	redisClient *redis.Client
+}
+
+func NewRedis(r *redis.Client) PubSub {
+	return &redisPubSub{redisClient: r}
+}
+
+func (r *redisPubSub) Publish(ctx context.Context, topic Topic, payload []byte) error {
+	return r.redisClient.Publish(ctx, string(topic), payload).Err()
+}
+
+func (r *redisPubSub) Subscribe(ctx context.Context, topics ...Topic) Subscription {
+	return newRedisSubscription(ctx, r.redisClient.Subscribe(ctx, toStrings(topics)...))
+}
+
+func (r *redisPubSub) PSubscribe(ctx context.Context, patterns ...Topic) Subscription {
+	return newRedisSubscription(ctx, r.redisClient.PSubscribe(ctx, toStrings(patterns)...))
+}
+
+func toStrings(topics []Topic) []string {
+	s := make([]string, len(topics))
+	for i, t := range topics {
+		s[i] = string(t)
+	}
+	return s
+}
+
+type redisSubscription struct {
+	sub  *redis.PubSub
+	ch   chan *Message
+	done chan struct{}
+	once sync.Once
+}
+
+func newRedisSubscription(ctx context.Context, sub *redis.PubSub) *redisSubscription {
+	// wait for redis to confirm the subscription so nothing published after
+	// this returns is missed, a failure shows up on the next Ping
+	sub.Receive(ctx)
+
+	s := &redisSubscription{
+		sub:  sub,
+		ch:   make(chan *Message),
+		done: make(chan struct{}),
+	}
+
+	go s.forward()
+
+	return s
+}
+
+// forward turns the redis messages into Messages until the subscription
+// closes
+func (s *redisSubscription) forward() {
+	defer close(s.ch)
+
+	for msg := range s.sub.Channel() {
+		select {
+		case s.ch <- &Message{Topic: Topic(msg.Channel), Payload: msg.Payload}:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *redisSubscription) Channel() <-chan *Message {
+	return s.ch
+}
+
+func (s *redisSubscription) Ping(ctx context.Context) error {
+	return s.sub.Ping(ctx)
+}
+
+func (s *redisSubscription) Close() error {
+	var err error
+	s.once.Do(func() {
+		close(s.done)
+		err = s.sub.Close()
+	})
+
+	return err
+}
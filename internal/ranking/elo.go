@@ -0,0 +1,98 @@
+// Package ranking rates players with elo, players that share a color play as a
+// team and are rated together
+package ranking
+
+import (
+	"math"
+
+	"github.com/spacesedan/go-sequence/internal"
+)
+
+const (
+	// DefaultRating is the rating of a player that never played a ranked game
+	DefaultRating = 1200.0
+	// KFactor is the most a rating can change against a single opponent
+	KFactor = 32.0
+)
+
+// team players sharing a color and the average of their ratings
+type team struct {
+	players []string
+	rating  float64
+	won     bool
+}
+
+// Expected returns the chance of a player rated a beating a player rated b
+func Expected(a, b float64) float64 {
+	return 1 / (1 + math.Pow(10, (b-a)/400))
+}
+
+// Update returns the rating change of every player in a match. Each team plays
+// every other team once, the changes are averaged over the number of opponents
+// so games with more teams don't swing ratings harder. Players missing from
+// ratings start at DefaultRating. Matches between fewer than two teams don't
+// change any ratings.
+func Update(players []internal.MatchPlayer, ratings map[string]float64) map[string]float64 {
+	teams := groupTeams(players, ratings)
+	deltas := make(map[string]float64, len(players))
+	if len(teams) < 2 {
+		return deltas
+	}
+
+	for _, t := range teams {
+		var delta float64
+		for _, o := range teams {
+			if t == o {
+				continue
+			}
+			delta += KFactor * (score(t, o) - Expected(t.rating, o.rating))
+		}
+		delta /= float64(len(teams) - 1)
+
+		for _, id := range t.players {
+			deltas[id] = delta
+		}
+	}
+
+	return deltas
+}
+
+func score(t, o *team) float64 {
+	switch {
+	case t.won && !o.won:
+		return 1
+	case !t.won && o.won:
+		return 0
+	default:
+		return 0.5
+	}
+}
+
+func groupTeams(players []internal.MatchPlayer, ratings map[string]float64) []*team {
+	byColor := make(map[string]*team)
+	var teams []*team
+
+	for _, p := range players {
+		t, ok := byColor[p.Color]
+		if !ok {
+			t = &team{}
+			byColor[p.Color] = t
+			teams = append(teams, t)
+		}
+
+		r, ok := ratings[p.PlayerID]
+		if !ok {
+			r = DefaultRating
+		}
+
+		t.players = append(t.players, p.PlayerID)
+		t.rating += r
+		t.won = t.won || p.Winner
+	}
+
+	for _, t := range teams {
+		t.rating /= float64(len(t.players))
+	}
+
+	return teams
+}
@@ -0,0 +1,69 @@
+package ranking
+
+import (
+	"math"
+	"testing"
+
+	"github.com/spacesedan/go-sequence/internal"
+)
+
+func TestUpdate(t *testing.T) {
+	players := []internal.MatchPlayer{
+		{PlayerID: "ada", Color: "red", Winner: true},
+		{PlayerID: "grace", Color: "blue"},
+	}
+
+	deltas := Update(players, nil)
+
+	if deltas["ada"] != KFactor/2 || deltas["grace"] != -KFactor/2 {
+		t.Errorf("Expected evenly rated players to move by half the k factor, got %v", deltas)
+	}
+}
+
+func TestUpdateUpset(t *testing.T) {
+	players := []internal.MatchPlayer{
+		{PlayerID: "ada", Color: "red", Winner: true},
+		{PlayerID: "grace", Color: "blue"},
+	}
+
+	deltas := Update(players, map[string]float64{"ada": 1000, "grace": 1400})
+
+	if deltas["ada"] <= KFactor/2 {
+		t.Errorf("Expected beating a stronger player to be worth more, got %v", deltas["ada"])
+	}
+
+	if math.Abs(deltas["ada"]+deltas["grace"]) > 1e-9 {
+		t.Errorf("Expected rating to be zero sum, got %v", deltas)
+	}
+}
+
+func TestUpdateTeams(t *testing.T) {
+	players := []internal.MatchPlayer{
+		{PlayerID: "ada", Color: "red", Winner: true},
+		{PlayerID: "alan", Color: "red", Winner: true},
+		{PlayerID: "grace", Color: "blue"},
+		{PlayerID: "linus", Color: "blue"},
+	}
+
+	deltas := Update(players, map[string]float64{"ada": 1300, "alan": 1100})
+
+	if deltas["ada"] != deltas["alan"] {
+		t.Errorf("Expected team mates to share the change, got %v", deltas)
+	}
+
+	// the red team averages 1200 like the blue team
+	if deltas["ada"] != KFactor/2 {
+		t.Errorf("Expected teams to be rated by their average, got %v", deltas["ada"])
+	}
+}
+
+func TestUpdateSingleTeam(t *testing.T) {
+	players := []internal.MatchPlayer{
+		{PlayerID: "ada", Color: "red", Winner: true},
+		{PlayerID: "alan", Color: "red", Winner: true},
+	}
+
+	if deltas := Update(players, nil); len(deltas) != 0 {
+		t.Errorf("Expected a match without opponents to be unrated, got %v", deltas)
+	}
+}
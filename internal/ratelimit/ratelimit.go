@@ -0,0 +1,196 @@
+// Package ratelimit keeps players from flooding the server with token buckets
+// per session and per ip address
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sweepEvery is how often buckets that refilled are dropped, a bucket that is
+// full again limits nothing
+const sweepEvery = time.Minute
+
+// Rate allows Burst actions per Every, a rate without a burst is unlimited
+type Rate struct {
+	Burst int
+	Every time.Duration
+}
+
+// ParseRate reads a rate written as burst/every like 5/1m, 0 and the empty
+// string are unlimited
+func ParseRate(s string) (Rate, error) {
+	if s == "" || s == "0" {
+		return Rate{}, nil
+	}
+
+	burst, every, ok := strings.Cut(s, "/")
+	if !ok {
+		return Rate{}, fmt.Errorf("rate %q is not written as burst/every like 5/1m", s)
+	}
+
+	var r Rate
+	var err error
+	if r.Burst, err = strconv.Atoi(burst); err != nil || r.Burst < 0 {
+		return Rate{}, fmt.Errorf("rate %q: burst must be a positive number", s)
+	}
+	if r.Every, err = time.ParseDuration(every); err != nil || r.Every <= 0 {
+		return Rate{}, fmt.Errorf("rate %q: every must be a positive duration", s)
+	}
+
+	return r, nil
+}
+
+func (r Rate) String() string {
+	if r.Unlimited() {
+		return "0"
+	}
+	return fmt.Sprintf("%d/%v", r.Burst, r.Every)
+}
+
+// Set lets a rate be read from a flag
+func (r *Rate) Set(s string) error {
+	parsed, err := ParseRate(s)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+func (r Rate) Unlimited() bool {
+	return r.Burst <= 0
+}
+
+// refill is how long it takes to get a single token back
+func (r Rate) refill() time.Duration {
+	return r.Every / time.Duration(r.Burst)
+}
+
+// Buckets is a token bucket of the same rate for every key
+type Buckets struct {
+	mu      sync.Mutex
+	rate    Rate
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func NewBuckets(r Rate) *Buckets {
+	return &Buckets{
+		rate:    r,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow takes a token from the bucket of key, it returns false once the
+// bucket is empty
+func (b *Buckets) Allow(key string, now time.Time) bool {
+	if b == nil || b.rate.Unlimited() {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if now.Sub(b.swept) > sweepEvery {
+		b.sweep(now)
+	}
+
+	bk, ok := b.buckets[key]
+	if !ok {
+		bk = &bucket{tokens: float64(b.rate.Burst), last: now}
+		b.buckets[key] = bk
+	}
+	bk.refill(b.rate, now)
+
+	if bk.tokens < 1 {
+		return false
+	}
+
+	bk.tokens--
+	return true
+}
+
+// Forget drops the bucket of key
+func (b *Buckets) Forget(key string) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.buckets, key)
+}
+
+// Len is the number of buckets being kept
+func (b *Buckets) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.buckets)
+}
+
+func (b *Buckets) sweep(now time.Time) {
+	b.swept = now
+	for key, bk := range b.buckets {
+		bk.refill(b.rate, now)
+		if bk.tokens >= float64(b.rate.Burst) {
+			delete(b.buckets, key)
+		}
+	}
+}
+
+func (bk *bucket) refill(r Rate, now time.Time) {
+	// without an interval the burst is all there is
+	if elapsed := now.Sub(bk.last); elapsed > 0 && r.Every > 0 {
+		bk.tokens += float64(elapsed) / float64(r.refill())
+		if bk.tokens > float64(r.Burst) {
+			bk.tokens = float64(r.Burst)
+		}
+	}
+	bk.last = now
+}
+
+// Rule limits an action per session and per ip address, the ip limit is
+// usually looser since players can share an address
+type Rule struct {
+	Session Rate
+	IP      Rate
+}
+
+// Limiter applies a rule
+type Limiter struct {
+	session *Buckets
+	ip      *Buckets
+}
+
+func NewLimiter(r Rule) *Limiter {
+	return &Limiter{
+		session: NewBuckets(r.Session),
+		ip:      NewBuckets(r.IP),
+	}
+}
+
+// Allow takes a token from the session and the ip bucket, empty keys are not
+// limited. A nil limiter allows everything.
+func (l *Limiter) Allow(session, ip string, now time.Time) bool {
+	if l == nil {
+		return true
+	}
+	if session != "" && !l.session.Allow(session, now) {
+		return false
+	}
+	if ip != "" && !l.ip.Allow(ip, now) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := map[string]struct {
+		in   string
+		want Rate
+		err  bool
+	}{
+		"rate":         {in: "5/1m", want: Rate{Burst: 5, Every: time.Minute}},
+		"unlimited":    {in: "0"},
+		"empty":        {in: ""},
+		"no interval":  {in: "5", err: true},
+		"bad burst":    {in: "x/1s", err: true},
+		"bad interval": {in: "5/0s", err: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseRate(test.in)
+			if (err != nil) != test.err || got != test.want {
+				t.Errorf("Expected %v %v, got %v %v", test.want, test.err, got, err)
+			}
+		})
+	}
+}
+
+func TestBuckets(t *testing.T) {
+	b := NewBuckets(Rate{Burst: 2, Every: 2 * time.Second})
+	now := time.Now()
+
+	if !b.Allow("player", now) || !b.Allow("player", now) {
+		t.Fatal("Expected the burst to be allowed")
+	}
+
+	if b.Allow("player", now) {
+		t.Error("Expected the third action to be rate limited")
+	}
+
+	if !b.Allow("other", now) {
+		t.Error("Expected every key to have its own bucket")
+	}
+
+	if !b.Allow("player", now.Add(time.Second)) {
+		t.Error("Expected a token to be refilled after a second")
+	}
+
+	b.Allow("sweep", now.Add(2*sweepEvery))
+	if n := b.Len(); n != 1 {
+		t.Errorf("Expected refilled buckets to be dropped, %v are left", n)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(Rule{
+		Session: Rate{Burst: 1, Every: time.Minute},
+		IP:      Rate{Burst: 2, Every: time.Minute},
+	})
+	now := time.Now()
+
+	if !l.Allow("ada", "10.0.0.1", now) || l.Allow("ada", "10.0.0.1", now) {
+		t.Error("Expected a session to get a single action")
+	}
+	if !l.Allow("grace", "10.0.0.1", now) || l.Allow("alan", "10.0.0.1", now) {
+		t.Error("Expected the address to be limited across sessions")
+	}
+
+	var unlimited *Limiter
+	if !unlimited.Allow("ada", "10.0.0.1", now) {
+		t.Error("Expected a nil limiter to allow everything")
+	}
+}
@@ -0,0 +1,43 @@
+package internal
+
+import "time"
+
+// Rating is the skill rating of a player, it only changes after ranked games
+type Rating struct {
+	PlayerID  string    `json:"player_id"`
+	Rating    float64   `json:"rating"`
+	Games     int       `json:"games"`
+	Wins      int       `json:"wins"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// LeaderboardPeriod is the span of time a leaderboard covers
+type LeaderboardPeriod string
+
+const (
+	LeaderboardDaily   LeaderboardPeriod = "daily"
+	LeaderboardWeekly  LeaderboardPeriod = "weekly"
+	LeaderboardAllTime LeaderboardPeriod = "all_time"
+)
+
+// LeaderboardPeriods in the order they are shown
+var LeaderboardPeriods = []LeaderboardPeriod{LeaderboardDaily, LeaderboardWeekly, LeaderboardAllTime}
+
+// Valid reports whether p is a known period
+func (p LeaderboardPeriod) Valid() bool {
+	for _, period := range LeaderboardPeriods {
+		if p == period {
+			return true
+		}
+	}
+	return false
+}
+
+// LeaderboardEntry a single row of a leaderboard, the all time leaderboard is
+// ranked by rating and the others by the rating gained during the period
+type LeaderboardEntry struct {
+	Rank        int     `json:"rank"`
+	PlayerID    string  `json:"player_id"`
+	DisplayName string  `json:"display_name"`
+	Score       float64 `json:"score"`
+}
@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MaxBestOf is the longest series a lobby can play
+const MaxBestOf = 7
+
+// Series is the score of the games played in a lobby, a color wins the series
+// once it won more than half of BestOf games
+type Series struct {
+	BestOf int `json:"best_of"`
+	// Wins counts the games won by every color
+	Wins  map[string]int `json:"wins"`
+	Games int            `json:"games"`
+	// Winner is the color that won the series, empty while it goes on
+	Winner string `json:"winner,omitempty"`
+}
+
+// NewSeries starts a series of bestOf games, anything below 1 is a single game
+func NewSeries(bestOf int) *Series {
+	if bestOf < 1 {
+		bestOf = 1
+	}
+	return &Series{BestOf: bestOf, Wins: make(map[string]int)}
+}
+
+// Record counts a game won by color, it reports whether the game decided the
+// series
+func (s *Series) Record(color string) bool {
+	if s.Wins == nil {
+		s.Wins = make(map[string]int)
+	}
+
+	s.Games++
+	s.Wins[color]++
+	if s.Winner == "" && s.Wins[color] > s.BestOf/2 {
+		s.Winner = color
+		return true
+	}
+	return false
+}
+
+// Over reports whether a color won the series
+func (s *Series) Over() bool {
+	return s != nil && s.Winner != ""
+}
+
+// InProgress reports whether games of the series were played and more are to
+// come, wins are counted by color so the players keep their colors until the
+// series is over
+func (s *Series) InProgress() bool {
+	return s != nil && s.BestOf > 1 && s.Games > 0 && s.Winner == ""
+}
+
+// Score writes the wins of every color that won a game like red 2 - blue 1,
+// the leader first
+func (s *Series) Score() string {
+	if s == nil || len(s.Wins) == 0 {
+		return ""
+	}
+
+	colors := make([]string, 0, len(s.Wins))
+	for color := range s.Wins {
+		colors = append(colors, color)
+	}
+	sort.Slice(colors, func(i, j int) bool {
+		if s.Wins[colors[i]] != s.Wins[colors[j]] {
+			return s.Wins[colors[i]] > s.Wins[colors[j]]
+		}
+		return colors[i] < colors[j]
+	})
+
+	score := make([]string, 0, len(colors))
+	for _, color := range colors {
+		score = append(score, fmt.Sprintf("%v %v", color, s.Wins[color]))
+	}
+	return strings.Join(score, " - ")
+}
+
+// String describes the series for the players, like best of 3, red 1 - blue 0
+func (s *Series) String() string {
+	if s == nil {
+		return ""
+	}
+
+	description := fmt.Sprintf("best of %v", s.BestOf)
+	if score := s.Score(); score != "" {
+		description += ", " + score
+	}
+	if s.Winner != "" {
+		description += fmt.Sprintf(", %v won the series", s.Winner)
+	}
+	return description
+}
@@ -1,6 +1,10 @@
 package services
 
-import "fmt"
+import (
+    "errors"
+    "fmt"
+    "net/http"
+)
 
 
 type Error struct {
@@ -17,8 +21,146 @@ const (
     ErrorCodeCellTaken
     ErrorCodeIllegalMove
     ErrorCodeInvalidArgument
+    ErrorCodeNotYourTurn
+    ErrorCodeDeadCard
+    ErrorCodeLobbyFull
+    ErrorCodeForbidden
+    ErrorCodeUnauthorized
+    ErrorCodeRateLimited
+    ErrorCodeUnavailable
 )
 
+// String names the code, used as a metric label
+func (c ErrorCode) String() string {
+    switch c {
+    case ErrorCodeNotFound:
+        return "not_found"
+    case ErrorCodeCellTaken:
+        return "cell_taken"
+    case ErrorCodeIllegalMove:
+        return "illegal_move"
+    case ErrorCodeInvalidArgument:
+        return "invalid_argument"
+    case ErrorCodeNotYourTurn:
+        return "not_your_turn"
+    case ErrorCodeDeadCard:
+        return "dead_card"
+    case ErrorCodeLobbyFull:
+        return "lobby_full"
+    case ErrorCodeForbidden:
+        return "forbidden"
+    case ErrorCodeUnauthorized:
+        return "unauthorized"
+    case ErrorCodeRateLimited:
+        return "rate_limited"
+    case ErrorCodeUnavailable:
+        return "unavailable"
+    default:
+        return "unknown"
+    }
+}
+
+// MarshalText and UnmarshalText send codes by name so clients don't depend on
+// their order
+func (c ErrorCode) MarshalText() ([]byte, error) {
+    return []byte(c.String()), nil
+}
+
+func (c *ErrorCode) UnmarshalText(b []byte) error {
+    for code := ErrorCodeUnknown; code <= ErrorCodeUnavailable; code++ {
+        if code.String() == string(b) {
+            *c = code
+            return nil
+        }
+    }
+    *c = ErrorCodeUnknown
+    return nil
+}
+
+// HTTPStatus is the status code http responses for the code are sent with
+func (c ErrorCode) HTTPStatus() int {
+    switch c {
+    case ErrorCodeNotFound:
+        return http.StatusNotFound
+    case ErrorCodeInvalidArgument:
+        return http.StatusBadRequest
+    case ErrorCodeForbidden:
+        return http.StatusForbidden
+    case ErrorCodeUnauthorized:
+        return http.StatusUnauthorized
+    case ErrorCodeRateLimited:
+        return http.StatusTooManyRequests
+    case ErrorCodeUnavailable:
+        return http.StatusServiceUnavailable
+    case ErrorCodeCellTaken, ErrorCodeIllegalMove, ErrorCodeNotYourTurn, ErrorCodeDeadCard, ErrorCodeLobbyFull:
+        return http.StatusConflict
+    default:
+        return http.StatusInternalServerError
+    }
+}
+
+// Title is the heading players see above the message of an error
+func (c ErrorCode) Title() string {
+    switch c {
+    case ErrorCodeNotFound:
+        return "Not found"
+    case ErrorCodeCellTaken:
+        return "Cell taken"
+    case ErrorCodeIllegalMove:
+        return "Illegal move"
+    case ErrorCodeInvalidArgument:
+        return "Invalid input"
+    case ErrorCodeNotYourTurn:
+        return "Not your turn"
+    case ErrorCodeDeadCard:
+        return "Dead card"
+    case ErrorCodeLobbyFull:
+        return "Lobby full"
+    case ErrorCodeForbidden:
+        return "Access denied"
+    case ErrorCodeUnauthorized:
+        return "Pick a name first"
+    case ErrorCodeRateLimited:
+        return "Slow down"
+    case ErrorCodeUnavailable:
+        return "Try again later"
+    default:
+        return "Something went wrong"
+    }
+}
+
+// AsError finds the first *Error in the chain of err
+func AsError(err error) (*Error, bool) {
+    var e *Error
+    if errors.As(err, &e) {
+        return e, true
+    }
+    return nil, false
+}
+
+// CodeOf returns the code of err, errors that are not an *Error are unknown
+func CodeOf(err error) ErrorCode {
+    if e, ok := AsError(err); ok {
+        return e.Code()
+    }
+    return ErrorCodeUnknown
+}
+
+// IsCode reports whether err carries the code
+func IsCode(err error, code ErrorCode) bool {
+    return CodeOf(err) == code
+}
+
+// Message is the part of err that can be shown to players, errors without a
+// known code may leak internals so they get a generic message instead
+func Message(err error) string {
+    e, ok := AsError(err)
+    if !ok || e.Code() == ErrorCodeUnknown {
+        return "something went wrong, please try again"
+    }
+    return e.msg
+}
+
 func WrapErrorf(orig error, code ErrorCode, format string, a ...interface{}) error{
     return &Error{
         code: code,
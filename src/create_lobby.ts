@@ -1,5 +1,11 @@
 const numOfPlayersInput = document.querySelector<HTMLInputElement>("#num_of_players")
 const maxHandSizeInput = document.querySelector<HTMLInputElement>("#max_hand_size")
+const visibilityInput = document.querySelector<HTMLSelectElement>("#visibility")
+const passwordInput = document.querySelector<HTMLInputElement>("#password")
+const rankedInput = document.querySelector<HTMLInputElement>("#ranked")
+const bestOfInput = document.querySelector<HTMLSelectElement>("#best_of")
+const rulesInput = document.querySelector<HTMLSelectElement>("#rules")
+const modeInput = document.querySelector<HTMLSelectElement>("#mode")
 const createLobbyForm = document.querySelector<HTMLFormElement>("#create-lobby-form")
 
 createLobbyForm?.addEventListener('submit', function(e) {
@@ -13,9 +19,22 @@ createLobbyForm?.addEventListener('submit', function(e) {
             return
         case numOfPlayersInput!.value !== "" && maxHandSizeInput!.value !== "":
             //@ts-ignore
-            htmx.ajax('POST', `/lobby/create?num_of_players=${numOfPlayersInput!.value}&max_hand_size=${maxHandSizeInput!.value}`, "")
+            htmx.ajax('POST', '/lobby/create', {
+                values: {
+                    num_of_players: numOfPlayersInput!.value,
+                    max_hand_size: maxHandSizeInput!.value,
+                    visibility: visibilityInput?.value ?? "public",
+                    // sent in the body so it never shows up in a url
+                    password: passwordInput?.value ?? "",
+                    ranked: rankedInput?.checked ? "true" : "false",
+                    best_of: bestOfInput?.value ?? "",
+                    rules: rulesInput?.value ?? "standard",
+                    mode: modeInput?.value ?? "classic",
+                }
+            })
             numOfPlayersInput!.value = ""
             maxHandSizeInput!.value = ""
+            if (passwordInput) passwordInput.value = ""
             return
     }
 
@@ -1,3 +1,19 @@
+// the card selected from the hand and the cell clicked on the board, a move is
+// sent to the lobby as "card:x:y"
+let selectedCard: string | undefined
+let selectedCell: string | undefined
+
+// the hand is replaced after every move so card clicks are handled on the
+// document
+document.addEventListener("click", function(e) {
+    const card = (e.target as HTMLElement).closest<HTMLImageElement>(".hand-card")
+    if (!card) return
+
+    document.querySelectorAll(".hand-card").forEach(c => c.classList.remove("-translate-y-2", "ring-4"))
+    card.classList.add("-translate-y-2", "ring-4")
+    selectedCard = card.dataset["card_index"]
+})
+
 //@ts-ignore
 htmx.onLoad(function(content) {
     const chatInput = document.querySelector<HTMLTextAreaElement>("#chat-input")
@@ -5,6 +21,7 @@ htmx.onLoad(function(content) {
     const blue = document.body.querySelector<HTMLDivElement>("#blue")
     const green = document.body.querySelector<HTMLDivElement>("#green")
     const playerReady = document.body.querySelector<HTMLButtonElement>("#player_ready")
+    const rematch = document.body.querySelector<HTMLButtonElement>("#rematch")
     const username = document.querySelector<HTMLDivElement>("#username")?.dataset["username"]
     const lobbyId = document.querySelector<HTMLDivElement>("#lobby-id")?.dataset["lobbyId"]
 
@@ -38,6 +55,27 @@ htmx.onLoad(function(content) {
     })
 
     chatInput?.addEventListener("htmx:wsConfigSend", function(e) {
+        const value = chatInput!.value.trim()
+        // the host can moderate the chat with /mute <name> and /unmute <name>,
+        // anyone can change their display name with /name <new name>
+        const command = value.split(/\s+/, 1)[0]
+        const target = value.slice(command.length).trim()
+
+        switch (command) {
+            case "/name":
+                //@ts-ignore
+                e.detail.parameters = { action: "change_name", message: target, username: username }
+                return
+            case "/mute":
+                //@ts-ignore
+                e.detail.parameters = { action: "mute_player", message: target, username: username }
+                return
+            case "/unmute":
+                //@ts-ignore
+                e.detail.parameters = { action: "unmute_player", message: target, username: username }
+                return
+        }
+
         //@ts-ignore
         e.detail.parameters = {
             action: "chat_message",
@@ -114,4 +152,52 @@ htmx.onLoad(function(content) {
         }
     })
 
+    // after a game every player can vote to play again with the same colors
+    rematch?.addEventListener("htmx:wsConfigSend", function(e) {
+        //@ts-ignore
+        e.detail.parameters = {
+            action: "rematch",
+            username
+        }
+    })
+
+    const gameBoard = (content as HTMLElement).querySelector<HTMLDivElement>("#game_board")
+    const exchangeCard = (content as HTMLElement).querySelector<HTMLButtonElement>("#exchange_card")
+
+    gameBoard?.addEventListener("click", function(e) {
+        const cell = (e.target as HTMLElement).closest<HTMLDivElement>(".board-cell")
+        selectedCell = cell ? `${cell.dataset["x"]}:${cell.dataset["y"]}` : undefined
+    }, true)
+
+    gameBoard?.addEventListener("htmx:wsConfigSend", function(e) {
+        if (selectedCard === undefined || selectedCell === undefined) {
+            e.preventDefault()
+            return
+        }
+
+        //@ts-ignore
+        e.detail.parameters = {
+            action: "play_card",
+            message: `${selectedCard}:${selectedCell}`,
+            username
+        }
+        selectedCard = undefined
+    })
+
+    // a card whose cells are both taken is swapped for a new one
+    exchangeCard?.addEventListener("htmx:wsConfigSend", function(e) {
+        if (selectedCard === undefined) {
+            e.preventDefault()
+            return
+        }
+
+        //@ts-ignore
+        e.detail.parameters = {
+            action: "exchange_card",
+            message: selectedCard,
+            username
+        }
+        selectedCard = undefined
+    })
+
 })
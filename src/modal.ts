@@ -9,6 +9,7 @@ htmx.onLoad(function(content) {
     const closeModalBtn = document.querySelector<HTMLButtonElement>("#modal-btn")
     const lobbyIdInput = document.querySelector<HTMLInputElement>("#lobby-id")
     const lobbyIdLabel = document.querySelector<HTMLLabelElement>("#lobby-id-label")
+    const lobbyPasswordInput = document.querySelector<HTMLInputElement>("#lobby-password")
     const lobbyForm = document.querySelector<HTMLFormElement>("#join-lobby-form")
 
 
@@ -49,7 +50,11 @@ htmx.onLoad(function(content) {
                 return
             default:
                 //@ts-ignore
-                htmx.ajax('POST', `/lobby/join?lobby-id=${lobbyIdInput?.value}`, { target: '#body', swap: 'beforeend' })
+                htmx.ajax('POST', '/lobby/join', {
+                    target: '#body',
+                    swap: 'beforeend',
+                    values: { "lobby-id": lobbyIdInput?.value, password: lobbyPasswordInput?.value ?? "" },
+                })
                 lobbyIdInput!.innerText = ""
                 closeModal()
                 return
@@ -14,3 +14,15 @@ htmx.onLoad(function(content) {
 
     setTimeout(closeToast, 5000)
 })
+
+// failed requests answer with a toast saying what went wrong, htmx drops error
+// responses unless it is told to swap them in. Server errors are only swapped
+// when they are a toast, a full lobby server answers 503 with one.
+document.addEventListener("htmx:beforeSwap", function(e: any) {
+    const status = e.detail.xhr.status
+    const isToast = status >= 500 && e.detail.serverResponse.includes('id="toast"')
+    if ((status >= 400 && status < 500) || isToast) {
+        e.detail.shouldSwap = true
+        e.detail.isError = false
+    }
+})